@@ -224,10 +224,13 @@ LOCAL_REQUIRED_MODULES += \
     plat_file_contexts \
     plat_file_contexts_test \
     plat_keystore2_key_contexts \
+    plat_keystore2_key_contexts_test \
     plat_mac_permissions.xml \
     plat_property_contexts \
     plat_property_contexts_test \
     plat_seapp_contexts \
+    plat_seapp_contexts_test \
+    plat_seapp_contexts_resolution_test \
     plat_service_contexts \
     plat_service_contexts_test \
     plat_hwservice_contexts \
@@ -294,11 +297,13 @@ LOCAL_REQUIRED_MODULES += \
     system_ext_file_contexts \
     system_ext_file_contexts_test \
     system_ext_keystore2_key_contexts \
+    system_ext_keystore2_key_contexts_test \
     system_ext_hwservice_contexts \
     system_ext_hwservice_contexts_test \
     system_ext_property_contexts \
     system_ext_property_contexts_test \
     system_ext_seapp_contexts \
+    system_ext_seapp_contexts_test \
     system_ext_service_contexts \
     system_ext_service_contexts_test \
     system_ext_mac_permissions.xml \
@@ -343,11 +348,13 @@ LOCAL_REQUIRED_MODULES += \
     product_file_contexts \
     product_file_contexts_test \
     product_keystore2_key_contexts \
+    product_keystore2_key_contexts_test \
     product_hwservice_contexts \
     product_hwservice_contexts_test \
     product_property_contexts \
     product_property_contexts_test \
     product_seapp_contexts \
+    product_seapp_contexts_test \
     product_service_contexts \
     product_service_contexts_test \
     product_mac_permissions.xml \
@@ -391,11 +398,14 @@ LOCAL_REQUIRED_MODULES += \
 LOCAL_REQUIRED_MODULES += \
     vendor_file_contexts \
     vendor_file_contexts_test \
+    file_contexts_shadowing_test \
     vendor_keystore2_key_contexts \
+    vendor_keystore2_key_contexts_test \
     vendor_mac_permissions.xml \
     vendor_property_contexts \
     vendor_property_contexts_test \
     vendor_seapp_contexts \
+    vendor_seapp_contexts_test \
     vendor_service_contexts \
     vendor_service_contexts_test \
     vendor_hwservice_contexts \
@@ -410,6 +420,7 @@ LOCAL_REQUIRED_MODULES += \
     odm_file_contexts \
     odm_file_contexts_test \
     odm_seapp_contexts \
+    odm_seapp_contexts_test \
     odm_property_contexts \
     odm_property_contexts_test \
     odm_service_contexts \
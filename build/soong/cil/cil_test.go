@@ -0,0 +1,446 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cil
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"android/soong/selinux/srcmap"
+)
+
+// prebuiltsDir is system/sepolicy/prebuilts/api, relative to this package.
+const prebuiltsDir = "../../../prebuilts/api"
+
+func prebuiltCilFiles(t *testing.T) []string {
+	var ret []string
+	for _, pattern := range []string{"*/*.cil", "*/private/*.cil", "*/private/compat/*/*.cil"} {
+		files, err := filepath.Glob(filepath.Join(prebuiltsDir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, files...)
+	}
+	if len(ret) == 0 {
+		t.Fatalf("no CIL files found under %s", prebuiltsDir)
+	}
+	return ret
+}
+
+func TestParsePrebuilts(t *testing.T) {
+	t.Parallel()
+
+	for _, file := range prebuiltCilFiles(t) {
+		file := file
+		t.Run(strings.TrimPrefix(file, prebuiltsDir+"/"), func(t *testing.T) {
+			t.Parallel()
+			p, err := ParseFiles(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Statements) == 0 && !strings.HasSuffix(file, ".compat.cil") {
+				t.Errorf("no statements parsed")
+			}
+		})
+	}
+}
+
+func TestPrebuiltPlatPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseFiles(filepath.Join(prebuiltsDir, "202404", "202404_plat_sepolicy.cil"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		actual   int
+		minCount int
+	}{
+		{"types", len(p.Types), 1000},
+		{"typeattributes", len(p.TypeAttributes), 100},
+		{"typeattributesets", len(p.TypeAttributeSets), 1000},
+		{"avrules", len(p.AvRules), 10000},
+		{"avrulexs", len(p.AvRuleXs), 100},
+		{"typetransitions", len(p.TypeTransitions), 100},
+		{"roles", len(p.Roles), 1},
+		{"roletypes", len(p.RoleTypes), 1},
+		{"sensitivities", len(p.Sensitivities), 1},
+		{"categories", len(p.Categories), 1024},
+		{"orders", len(p.Orders), 4},
+		{"sensitivitycategories", len(p.SensitivityCategories), 1},
+		{"mlsconstrains", len(p.MlsConstrains), 10},
+	}
+	for _, tc := range testCases {
+		if tc.actual < tc.minCount {
+			t.Errorf("expected at least %d %s, got %d", tc.minCount, tc.name, tc.actual)
+		}
+	}
+
+	var origin *Origin
+	for _, r := range p.AvRules {
+		if r.Kind == "neverallow" && r.Source == "hal_configstore_server" && r.Target == "fs_type" {
+			origin = r.Origin
+			if r.Class() != "file" || !reflect.DeepEqual(r.Perms(), []string{"execute_no_trans"}) {
+				t.Errorf("unexpected class and perms of %s", r.Node)
+			}
+		}
+	}
+	if origin == nil || origin.String() != "system/sepolicy/public/hal_configstore.te:15" {
+		t.Errorf("expected origin system/sepolicy/public/hal_configstore.te:15, got %v", origin)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+		origins  []string
+	}{
+		{
+			name:     "whitespace and comments",
+			input:    "; comment\n(allow  a\tb\n  (file (read write))) ; trailing\n",
+			expected: []string{"(allow a b (file (read write)))"},
+			origins:  []string{""},
+		},
+		{
+			name: "lmx markers",
+			input: ";;* lmx 10 foo.te\n" +
+				"(type a)\n" +
+				"(type b)\n" +
+				";;* lme\n" +
+				"(type c)\n",
+			expected: []string{"(type a)", "(type b)", "(type c)"},
+			origins:  []string{"foo.te:10", "foo.te:10", ""},
+		},
+		{
+			name: "nested lms markers",
+			input: ";;* lms 1 foo.te\n" +
+				"(type a)\n" +
+				";;* lmx 20 bar.te\n" +
+				"(type b)\n" +
+				";;* lme\n" +
+				"(type c)\n" +
+				";;* lme\n",
+			expected: []string{"(type a)", "(type b)", "(type c)"},
+			origins:  []string{"foo.te:1", "bar.te:20", "foo.te:5"},
+		},
+		{
+			name:     "quoted strings",
+			input:    `(genfscon proc "/a b;c" (u object_r proc ((s0) (s0))))`,
+			expected: []string{`(genfscon proc "/a b;c" (u object_r proc ((s0) (s0))))`},
+			origins:  []string{""},
+		},
+	}
+
+	for _, tc := range testCases {
+		stmts, err := ParseNodes(strings.NewReader(tc.input), tc.name)
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		var actual, origins []string
+		for _, s := range stmts {
+			actual = append(actual, s.String())
+			if s.Origin == nil {
+				origins = append(origins, "")
+			} else {
+				origins = append(origins, s.Origin.String())
+			}
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+		if !reflect.DeepEqual(origins, tc.origins) {
+			t.Errorf("%s: expected origins %q, got %q", tc.name, tc.origins, origins)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"unbalanced", "(allow a b (file (read))"},
+		{"stray atom", "allow"},
+		{"unterminated marker", ";;* lmx 1 foo.te\n(type a)\n"},
+		{"unmatched lme", ";;* lme\n"},
+		{"malformed rule", "(allow a (file (read)))"},
+	}
+	for _, tc := range testCases {
+		if _, err := Parse(strings.NewReader(tc.input), tc.name); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestExpandType(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`
+		(type a)
+		(type b)
+		(type c)
+		(typeattribute x)
+		(typeattribute y)
+		(typeattribute z)
+		(typeattribute w)
+		(typeattributeset x (a b))
+		(typeattributeset y (and x (not (b))))
+		(typeattributeset z (or y (c)))
+		(typeattributeset w (xor x z))
+	`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		expected []string
+	}{
+		{"a", []string{"a"}},
+		{"x", []string{"a", "b"}},
+		{"y", []string{"a"}},
+		{"z", []string{"a", "c"}},
+		{"w", []string{"b", "c"}},
+	}
+	for _, tc := range testCases {
+		if actual := p.ExpandType(tc.name); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	inputs := []string{
+		";;* lmx 3 foo.te\n" +
+			"(allow b c (file (read)))\n" +
+			";;* lme\n" +
+			"(type  c)\n" +
+			"(allow a c (file (read)))\n" +
+			"; a comment with ;; inside\n" +
+			"(genfscon proc \"/x;;y\" (u object_r c ((s0) (s0))))\n" +
+			"(type b)\n",
+		"(type b)\n" +
+			"(genfscon proc \"/x;;y\" (u object_r c ((s0) (s0))))\n" +
+			"(allow a c\n    (file (read)))\n" +
+			"(type c)\n" +
+			"(allow b c (file (read)))\n",
+	}
+	expected := "(type b)\n" +
+		"(type c)\n" +
+		"(allow a c (file (read)))\n" +
+		"(allow b c (file (read)))\n" +
+		"(genfscon proc \"/x;;y\" (u object_r c ((s0) (s0))))\n"
+
+	for i, input := range inputs {
+		stmts, err := ParseNodes(strings.NewReader(input), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sb strings.Builder
+		m, err := Normalize(&sb, stmts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sb.String() != expected {
+			t.Errorf("input %d: expected %q, got %q", i, expected, sb.String())
+		}
+		if i == 0 {
+			if loc, ok := m.Lookup(4); !ok || loc.String() != "foo.te:3" {
+				t.Errorf("expected line 4 to map to foo.te:3, got %v", loc)
+			}
+			if _, ok := m.Lookup(3); ok {
+				t.Errorf("expected line 3 to have no origin")
+			}
+		}
+	}
+}
+
+func TestDiffPolicies(t *testing.T) {
+	t.Parallel()
+
+	base, err := Parse(strings.NewReader(`
+		(type a)
+		(type b)
+		(type old)
+		(typeattribute attr)
+		(allow a b (file (read write)))
+		(allow a old (file (read)))
+		(typetransition a b process old)
+		(typetransition a b file "name" b)
+	`), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := Parse(strings.NewReader(`
+		(type a)
+		(type b)
+		(type new)
+		(typeattribute attr)
+		(allow a b (file (read)))
+		(allow a b (file (write open)))
+		(allow b new (dir (search)))
+		(typetransition a b process new)
+		(typetransition b a file new)
+	`), "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := DiffPolicies(base, target)
+	if !reflect.DeepEqual(d.Types, SetDiff{Added: []string{"new"}, Removed: []string{"old"}}) {
+		t.Errorf("unexpected types diff %v", d.Types)
+	}
+	if len(d.Attributes.Added) > 0 || len(d.Attributes.Removed) > 0 {
+		t.Errorf("unexpected attributes diff %v", d.Attributes)
+	}
+	expectedAllow := []DomainDiff{
+		{"a", SetDiff{Added: []string{"allow a b:file { open }"}, Removed: []string{"allow a old:file { read }"}}},
+		{"b", SetDiff{Added: []string{"allow b new:dir { search }"}, Removed: []string{}}},
+	}
+	if !reflect.DeepEqual(d.AllowRules, expectedAllow) {
+		t.Errorf("expected allow rules diff %v, got %v", expectedAllow, d.AllowRules)
+	}
+	expectedTransitions := TransitionDiff{
+		SetDiff: SetDiff{Added: []string{"b a:file new"}, Removed: []string{`a b:file "name" b`}},
+		Changed: []TransitionChange{{Transition: "a b:process", Old: "old", New: "new"}},
+	}
+	if !reflect.DeepEqual(d.TypeTransitions, expectedTransitions) {
+		t.Errorf("expected type transitions diff %v, got %v", expectedTransitions, d.TypeTransitions)
+	}
+
+	if !DiffPolicies(base, base).Empty() {
+		t.Errorf("expected no difference between identical policies")
+	}
+}
+
+func TestParseSecilcOutput(t *testing.T) {
+	t.Parallel()
+
+	output := "neverallow check failed at plat.cil:10 from system/sepolicy/public/app.te:5\n" +
+		"  (neverallow appdomain system_data_file (file (write)))\n" +
+		"    <root>\n" +
+		"    booleanif at vendor.cil:3\n" +
+		"    allow at vendor.cil:4\n" +
+		"      (allow vendor_app system_data_file (file (write open)))\n" +
+		"    <root>\n" +
+		"    allow at plat.cil:20 from system/sepolicy/private/su.te:7\n" +
+		"      (allow su system_data_file (file (write)))\n" +
+		"Bad type declaration at vendor.cil:2\n" +
+		"Failed to generate binary\n"
+
+	diags, other, err := ParseSecilcOutput(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(diags))
+	}
+	if !reflect.DeepEqual(other, []string{"Failed to generate binary"}) {
+		t.Errorf("unexpected other lines %q", other)
+	}
+
+	neverallow := diags[0]
+	if neverallow.Kind != "neverallow" || neverallow.File != "plat.cil" || neverallow.Line != 10 ||
+		neverallow.Origin == nil || neverallow.Origin.String() != "system/sepolicy/public/app.te:5" ||
+		neverallow.Rule != "(neverallow appdomain system_data_file (file (write)))" {
+		t.Errorf("unexpected neverallow diagnostic %+v", neverallow)
+	}
+	if len(neverallow.Violations) != 2 || neverallow.Violations[0].File != "vendor.cil" ||
+		neverallow.Violations[0].Line != 4 || neverallow.Violations[1].Origin.String() != "system/sepolicy/private/su.te:7" {
+		t.Errorf("unexpected violations %+v", neverallow.Violations)
+	}
+	if domains := neverallow.Domains(); !reflect.DeepEqual(domains, []string{"vendor_app", "su"}) {
+		t.Errorf("expected domains [vendor_app su], got %q", domains)
+	}
+	if diags[1].Kind != "error" || diags[1].Message != "Bad type declaration" || diags[1].Domains() != nil {
+		t.Errorf("unexpected error diagnostic %+v", diags[1])
+	}
+
+	m, err := LineMarkerMap(strings.NewReader("(type a)\n;;* lms 2 vendor/foo.te\n(type b)\n(allow b a (file (read)))\n;;* lme\n"), "vendor.cil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ResolveOrigins(diags, map[string]*srcmap.Map{"vendor.cil": m})
+	if o := neverallow.Violations[0].Origin; o == nil || o.String() != "vendor/foo.te:3" {
+		t.Errorf("expected vendor.cil:4 to resolve to vendor/foo.te:3, got %v", o)
+	}
+	if o := diags[1].Origin; o != nil {
+		t.Errorf("expected vendor.cil:2 to have no origin, got %v", o)
+	}
+
+	var sb strings.Builder
+	if err := WriteSummary(&sb, diags); err != nil {
+		t.Fatal(err)
+	}
+	expected := "(unknown domain): 1\n" +
+		"  Bad type declaration at vendor.cil:2\n" +
+		"su: 1\n" +
+		"  neverallow check failed at system/sepolicy/public/app.te:5\n" +
+		"    (neverallow appdomain system_data_file (file (write)))\n" +
+		"    violated by (allow su system_data_file (file (write))) at system/sepolicy/private/su.te:7\n" +
+		"vendor_app: 1\n" +
+		"  neverallow check failed at system/sepolicy/public/app.te:5\n" +
+		"    (neverallow appdomain system_data_file (file (write)))\n" +
+		"    violated by (allow vendor_app system_data_file (file (write open))) at vendor/foo.te:3\n"
+	if sb.String() != expected {
+		t.Errorf("expected summary:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
+
+func TestLedger(t *testing.T) {
+	t.Parallel()
+
+	diags := []*Diagnostic{
+		{
+			Kind: "neverallow",
+			Rule: "(neverallow appdomain system_data_file (file (write)))",
+			Violations: []*Violation{
+				{Rule: "(allow vendor_app system_data_file (file (write)))", Origin: &Origin{File: "vendor/app.te", Line: 3}},
+				{Rule: "(allow su system_data_file (file (write)))"},
+			},
+		},
+		{Kind: "error", Rule: "(type a)"},
+	}
+	var sb strings.Builder
+	if err := WriteLedger(&sb, diags); err != nil {
+		t.Fatal(err)
+	}
+	expected := "(allow su system_data_file (file (write))) violates (neverallow appdomain system_data_file (file (write)))\n" +
+		"(allow vendor_app system_data_file (file (write))) violates (neverallow appdomain system_data_file (file (write)))  # vendor/app.te:3\n"
+	if sb.String() != expected {
+		t.Errorf("expected ledger:\n%s\ngot:\n%s", expected, sb.String())
+	}
+
+	keys, err := ReadLedger(strings.NewReader("# allowlist\n\n" + sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !keys["(allow vendor_app system_data_file (file (write))) violates (neverallow appdomain system_data_file (file (write)))"] {
+		t.Errorf("unexpected ledger keys %v", keys)
+	}
+}
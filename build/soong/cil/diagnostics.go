@@ -0,0 +1,344 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"android/soong/selinux/srcmap"
+)
+
+// Diagnostic is an error reported by secilc.
+type Diagnostic struct {
+	// Kind is "neverallow" for neverallow failures, or "error" otherwise.
+	Kind string `json:"kind"`
+
+	// Message is the message of secilc without the location, e.g. "neverallow check failed".
+	Message string `json:"message"`
+
+	// Rule is the offending CIL statement, if known.
+	Rule string `json:"rule,omitempty"`
+
+	// File and Line are the location in the CIL file.
+	File string `json:"file"`
+	Line int    `json:"line"`
+
+	// Origin is the location in the policy source file, if the CIL file has line markers.
+	Origin *Origin `json:"origin,omitempty"`
+
+	// Violations are the rules violating a neverallow.
+	Violations []*Violation `json:"violations,omitempty"`
+
+	// Ignored is true if the failure didn't fail the build because neverallows were ignored.
+	Ignored bool `json:"ignored,omitempty"`
+}
+
+// Violation is a rule violating a neverallow.
+type Violation struct {
+	Rule   string  `json:"rule"`
+	File   string  `json:"file"`
+	Line   int     `json:"line"`
+	Origin *Origin `json:"origin,omitempty"`
+}
+
+// Domains returns the offending domains of d: the sources of the violating rules of a
+// neverallow, or the source of the rule of another error. Returns nil if unknown.
+func (d *Diagnostic) Domains() []string {
+	var ret []string
+	add := func(rule string) {
+		if domain := ruleSource(rule); domain != "" && !contains(ret, domain) {
+			ret = append(ret, domain)
+		}
+	}
+	if len(d.Violations) > 0 {
+		for _, v := range d.Violations {
+			add(v.Rule)
+		}
+	} else {
+		add(d.Rule)
+	}
+	return ret
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// avRuleKeywords are the statements whose first argument is the source domain.
+var avRuleKeywords = map[string]bool{
+	"allow": true, "auditallow": true, "dontaudit": true, "neverallow": true,
+	"allowx": true, "auditallowx": true, "dontauditx": true, "neverallowx": true,
+	"typetransition": true, "typechange": true, "typemember": true,
+}
+
+// ruleSource returns the source domain of an access vector or type rule statement.
+func ruleSource(rule string) string {
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(rule))
+	if len(fields) < 3 || fields[0] != "(" || !avRuleKeywords[fields[1]] || fields[2] == "(" {
+		return ""
+	}
+	return fields[2]
+}
+
+// locationRegex matches messages of secilc with a location, e.g.
+// "neverallow check failed at plat_sepolicy.cil:12 from system/sepolicy/public/app.te:34".
+var locationRegex = regexp.MustCompile(`^(\s*)(.*?) at (\S+):(\d+)(?: from (\S+):(\d+))?\s*$`)
+
+// ParseSecilcOutput parses the error output of secilc. Lines which aren't part of a diagnostic,
+// such as "Failed to generate binary", are returned separately.
+func ParseSecilcOutput(r io.Reader) ([]*Diagnostic, []string, error) {
+	var diags []*Diagnostic
+	var other []string
+	var current *Diagnostic
+	var violation *Violation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			continue
+		}
+		indented := text[0] == ' ' || text[0] == '\t'
+
+		if indented && current != nil && strings.HasPrefix(trimmed, "(") {
+			// The statement of the preceding location.
+			if violation != nil && violation.Rule == "" {
+				violation.Rule = trimmed
+			} else if current.Rule == "" {
+				current.Rule = trimmed
+			}
+			continue
+		}
+
+		match := locationRegex.FindStringSubmatch(text)
+		if match == nil {
+			if !(indented && current != nil) {
+				other = append(other, trimmed)
+				current, violation = nil, nil
+			}
+			continue
+		}
+		line, _ := strconv.Atoi(match[4])
+		var origin *Origin
+		if match[5] != "" {
+			originLine, _ := strconv.Atoi(match[6])
+			origin = &Origin{File: match[5], Line: originLine}
+		}
+
+		if match[1] != "" && current != nil {
+			// A parent or a violating rule of the current neverallow, e.g. "    allow at file:12".
+			if current.Kind == "neverallow" && avRuleKeywords[match[2]] {
+				violation = &Violation{File: match[3], Line: line, Origin: origin}
+				current.Violations = append(current.Violations, violation)
+			} else {
+				violation = nil
+			}
+			continue
+		}
+
+		kind := "error"
+		if strings.HasSuffix(match[2], "check failed") {
+			kind = "neverallow"
+		}
+		current = &Diagnostic{Kind: kind, Message: match[2], File: match[3], Line: line, Origin: origin}
+		violation = nil
+		diags = append(diags, current)
+	}
+	return diags, other, scanner.Err()
+}
+
+// LineMarkerMap builds a source map of a CIL file from its line markers. name is used as the
+// output of the map and in error messages.
+func LineMarkerMap(r io.Reader, name string) (*srcmap.Map, error) {
+	m := &srcmap.Map{Output: name}
+	var markers []*lineMarker
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if IsLineMarker(text) {
+			marker, end, err := parseLineMarker(text, line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%w", name, err)
+			}
+			if end {
+				if len(markers) == 0 {
+					return nil, fmt.Errorf("%s:%d: unmatched lme line marker", name, line)
+				}
+				markers = markers[:len(markers)-1]
+			} else {
+				markers = append(markers, marker)
+			}
+			continue
+		}
+		if len(markers) > 0 {
+			top := markers[len(markers)-1]
+			origin := top.origin(line)
+			m.Add(line, origin.File, origin.Line, top.kind == "lmx")
+		}
+	}
+	return m, scanner.Err()
+}
+
+// ResolveOrigins fills in the origins that secilc didn't report, using the source maps of the
+// CIL files keyed by file name.
+func ResolveOrigins(diags []*Diagnostic, maps map[string]*srcmap.Map) {
+	lookup := func(file string, line int) *Origin {
+		if m, ok := maps[file]; ok {
+			if loc, ok := m.Lookup(line); ok {
+				return &Origin{File: loc.File, Line: loc.Line}
+			}
+		}
+		return nil
+	}
+	for _, d := range diags {
+		if d.Origin == nil {
+			d.Origin = lookup(d.File, d.Line)
+		}
+		for _, v := range d.Violations {
+			if v.Origin == nil {
+				v.Origin = lookup(v.File, v.Line)
+			}
+		}
+	}
+}
+
+// LedgerEntry identifies a neverallow violation independently of line numbers, so that it can be
+// listed in a checked-in allowlist.
+type LedgerEntry struct {
+	// Key is "<violating rule> violates <neverallow rule>".
+	Key string
+
+	// Origin is the source location of the violating rule, if known.
+	Origin *Origin
+}
+
+// LedgerEntries returns the entries of the violations of a neverallow diagnostic.
+func (d *Diagnostic) LedgerEntries() []LedgerEntry {
+	if d.Kind != "neverallow" {
+		return nil
+	}
+	var ret []LedgerEntry
+	for _, v := range d.Violations {
+		ret = append(ret, LedgerEntry{Key: v.Rule + " violates " + d.Rule, Origin: v.Origin})
+	}
+	return ret
+}
+
+// WriteLedger writes the neverallow violations of diags, one per line in sorted order, with the
+// source locations of the violating rules as comments. The output can be used as an allowlist.
+func WriteLedger(w io.Writer, diags []*Diagnostic) error {
+	origins := make(map[string][]string)
+	for _, d := range diags {
+		for _, e := range d.LedgerEntries() {
+			locs := origins[e.Key]
+			if e.Origin != nil && !contains(locs, e.Origin.String()) {
+				locs = append(locs, e.Origin.String())
+			}
+			origins[e.Key] = locs
+		}
+	}
+	var keys []string
+	for key := range origins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	for _, key := range keys {
+		if locs := origins[key]; len(locs) > 0 {
+			fmt.Fprintf(bw, "%s  # %s\n", key, strings.Join(locs, ", "))
+		} else {
+			fmt.Fprintln(bw, key)
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadLedger reads the keys of a ledger written by WriteLedger. Comments starting with '#' and
+// blank lines are ignored.
+func ReadLedger(r io.Reader) (map[string]bool, error) {
+	ret := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if key := strings.TrimSpace(line); key != "" {
+			ret[key] = true
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// WriteSummary writes a summary of diags grouped by offending domain.
+func WriteSummary(w io.Writer, diags []*Diagnostic) error {
+	const unknown = "(unknown domain)"
+	byDomain := make(map[string][]*Diagnostic)
+	for _, d := range diags {
+		domains := d.Domains()
+		if len(domains) == 0 {
+			domains = []string{unknown}
+		}
+		for _, domain := range domains {
+			byDomain[domain] = append(byDomain[domain], d)
+		}
+	}
+	var domains []string
+	for domain := range byDomain {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	bw := bufio.NewWriter(w)
+	for _, domain := range domains {
+		fmt.Fprintf(bw, "%s: %d\n", domain, len(byDomain[domain]))
+		for _, d := range byDomain[domain] {
+			fmt.Fprintf(bw, "  %s at %s\n", d.Message, d.location())
+			if d.Rule != "" {
+				fmt.Fprintf(bw, "    %s\n", d.Rule)
+			}
+			for _, v := range d.Violations {
+				if domain == unknown || ruleSource(v.Rule) == domain {
+					fmt.Fprintf(bw, "    violated by %s at %s\n", v.Rule, location(v.File, v.Line, v.Origin))
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func (d *Diagnostic) location() string {
+	return location(d.File, d.Line, d.Origin)
+}
+
+// location prefers the origin, falling back to the CIL location.
+func location(file string, line int, origin *Origin) string {
+	if origin != nil {
+		return origin.String()
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
@@ -0,0 +1,267 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SetDiff lists names or rules that only exist in one of two policies.
+type SetDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+func (d *SetDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DomainDiff lists allow rules added to and removed from a single source domain.
+type DomainDiff struct {
+	Source string `json:"source"`
+	SetDiff
+}
+
+// TransitionChange is a type transition whose result type changed.
+type TransitionChange struct {
+	// Transition is the transition without its result, e.g. "init shell_exec:process".
+	Transition string `json:"transition"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+}
+
+// TransitionDiff lists type transitions that were added, removed or changed.
+type TransitionDiff struct {
+	SetDiff
+	Changed []TransitionChange `json:"changed"`
+}
+
+// Diff is the semantic difference between two policies. Rules are compared as written, without
+// expanding attributes, and allow rules are compared per permission, so that splitting or merging
+// rules doesn't show up as a change.
+type Diff struct {
+	Types           SetDiff        `json:"types"`
+	Attributes      SetDiff        `json:"attributes"`
+	AllowRules      []DomainDiff   `json:"allow_rules"`
+	TypeTransitions TransitionDiff `json:"type_transitions"`
+}
+
+// DiffPolicies returns what changed from base to target.
+func DiffPolicies(base, target *Policy) *Diff {
+	d := &Diff{}
+	d.Types = diffSets(typeNames(base), typeNames(target))
+	d.Attributes = diffSets(attributeNames(base), attributeNames(target))
+	d.AllowRules = diffAllowRules(allowPerms(base), allowPerms(target))
+	d.TypeTransitions = diffTransitions(transitions(base), transitions(target))
+	return d
+}
+
+// Empty returns whether the two policies are semantically identical.
+func (d *Diff) Empty() bool {
+	return d.Types.empty() && d.Attributes.empty() && len(d.AllowRules) == 0 &&
+		d.TypeTransitions.empty() && len(d.TypeTransitions.Changed) == 0
+}
+
+// WriteJSON writes d as JSON.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteText writes d in a human readable form.
+func (d *Diff) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	if d.Empty() {
+		sb.WriteString("No semantic differences.\n")
+	}
+	writeSetDiff := func(title, indent string, s SetDiff) {
+		if s.empty() {
+			return
+		}
+		if title != "" {
+			fmt.Fprintf(&sb, "%s:\n", title)
+		}
+		for _, a := range s.Added {
+			fmt.Fprintf(&sb, "%s+ %s\n", indent, a)
+		}
+		for _, r := range s.Removed {
+			fmt.Fprintf(&sb, "%s- %s\n", indent, r)
+		}
+	}
+	writeSetDiff("Types", "  ", d.Types)
+	writeSetDiff("Attributes", "  ", d.Attributes)
+	if len(d.AllowRules) > 0 {
+		sb.WriteString("Allow rules:\n")
+		for _, dd := range d.AllowRules {
+			fmt.Fprintf(&sb, "  %s:\n", dd.Source)
+			writeSetDiff("", "    ", dd.SetDiff)
+		}
+	}
+	if !d.TypeTransitions.empty() || len(d.TypeTransitions.Changed) > 0 {
+		sb.WriteString("Type transitions:\n")
+		writeSetDiff("", "  ", d.TypeTransitions.SetDiff)
+		for _, c := range d.TypeTransitions.Changed {
+			fmt.Fprintf(&sb, "  ~ %s: %s -> %s\n", c.Transition, c.Old, c.New)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func typeNames(p *Policy) map[string]bool {
+	ret := make(map[string]bool)
+	for _, t := range p.Types {
+		ret[t.Name] = true
+	}
+	return ret
+}
+
+func attributeNames(p *Policy) map[string]bool {
+	ret := make(map[string]bool)
+	for _, a := range p.TypeAttributes {
+		ret[a.Name] = true
+	}
+	return ret
+}
+
+func diffSets(base, target map[string]bool) SetDiff {
+	d := SetDiff{Added: []string{}, Removed: []string{}}
+	for k := range target {
+		if !base[k] {
+			d.Added = append(d.Added, k)
+		}
+	}
+	for k := range base {
+		if !target[k] {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+type avKey struct {
+	source, target, class string
+}
+
+// allowPerms returns the permissions allowed for every (source, target, class). Rules using a named
+// classpermission set have the name as class and the empty string as their only permission.
+func allowPerms(p *Policy) map[avKey]map[string]bool {
+	ret := make(map[avKey]map[string]bool)
+	for _, r := range p.AvRules {
+		if r.Kind != "allow" {
+			continue
+		}
+		k := avKey{r.Source, r.Target, r.Class()}
+		if ret[k] == nil {
+			ret[k] = make(map[string]bool)
+		}
+		perms := r.Perms()
+		if perms == nil {
+			perms = []string{""}
+		}
+		for _, perm := range perms {
+			ret[k][perm] = true
+		}
+	}
+	return ret
+}
+
+func formatAllow(k avKey, perms []string) string {
+	if len(perms) == 1 && perms[0] == "" {
+		return fmt.Sprintf("allow %s %s %s", k.source, k.target, k.class)
+	}
+	return fmt.Sprintf("allow %s %s:%s { %s }", k.source, k.target, k.class, strings.Join(perms, " "))
+}
+
+func diffAllowRules(base, target map[avKey]map[string]bool) []DomainDiff {
+	bySource := make(map[string]*DomainDiff)
+	get := func(source string) *DomainDiff {
+		if bySource[source] == nil {
+			bySource[source] = &DomainDiff{Source: source, SetDiff: SetDiff{Added: []string{}, Removed: []string{}}}
+		}
+		return bySource[source]
+	}
+	keys := make(map[avKey]bool)
+	for k := range base {
+		keys[k] = true
+	}
+	for k := range target {
+		keys[k] = true
+	}
+	for k := range keys {
+		d := diffSets(base[k], target[k])
+		if len(d.Added) > 0 {
+			dd := get(k.source)
+			dd.Added = append(dd.Added, formatAllow(k, d.Added))
+		}
+		if len(d.Removed) > 0 {
+			dd := get(k.source)
+			dd.Removed = append(dd.Removed, formatAllow(k, d.Removed))
+		}
+	}
+
+	ret := []DomainDiff{}
+	for _, dd := range bySource {
+		sort.Strings(dd.Added)
+		sort.Strings(dd.Removed)
+		ret = append(ret, *dd)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Source < ret[j].Source
+	})
+	return ret
+}
+
+// transitions maps every type transition, without its result, to its result.
+func transitions(p *Policy) map[string]string {
+	ret := make(map[string]string)
+	for _, t := range p.TypeTransitions {
+		k := fmt.Sprintf("%s %s:%s", t.Source, t.Target, t.Class)
+		if t.Name != "" {
+			k += " " + t.Name
+		}
+		ret[k] = t.Result
+	}
+	return ret
+}
+
+func diffTransitions(base, target map[string]string) TransitionDiff {
+	d := TransitionDiff{SetDiff: SetDiff{Added: []string{}, Removed: []string{}}, Changed: []TransitionChange{}}
+	for k, result := range target {
+		if old, ok := base[k]; !ok {
+			d.Added = append(d.Added, k+" "+result)
+		} else if old != result {
+			d.Changed = append(d.Changed, TransitionChange{Transition: k, Old: old, New: result})
+		}
+	}
+	for k, result := range base {
+		if _, ok := target[k]; !ok {
+			d.Removed = append(d.Removed, k+" "+result)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].Transition < d.Changed[j].Transition
+	})
+	return d
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cil
+
+import (
+	"bufio"
+	"io"
+	"sort"
+
+	"android/soong/selinux/srcmap"
+)
+
+// keywordOrder is the order of statement kinds in normalized CIL. Declarations come first so that
+// the output stays readable; CIL itself doesn't depend on the order of top-level statements.
+var keywordOrder = []string{
+	"handleunknown",
+	"mls",
+	"policycap",
+	"common",
+	"class",
+	"classcommon",
+	"classorder",
+	"classpermission",
+	"classpermissionset",
+	"classmap",
+	"classmapping",
+	"permissionx",
+	"sid",
+	"sidorder",
+	"sidcontext",
+	"sensitivity",
+	"sensitivityorder",
+	"category",
+	"categoryorder",
+	"sensitivitycategory",
+	"user",
+	"userrole",
+	"userlevel",
+	"userrange",
+	"role",
+	"roleattribute",
+	"roleattributeset",
+	"roletype",
+	"type",
+	"typealias",
+	"typealiasactual",
+	"typeattribute",
+	"typeattributeset",
+	"expandtypeattribute",
+	"typepermissive",
+	"allow",
+	"auditallow",
+	"dontaudit",
+	"neverallow",
+	"allowx",
+	"auditallowx",
+	"dontauditx",
+	"neverallowx",
+	"typetransition",
+	"typechange",
+	"typemember",
+	"roletransition",
+	"rangetransition",
+	"constrain",
+	"mlsconstrain",
+	"validatetrans",
+	"mlsvalidatetrans",
+	"fsuse",
+	"genfscon",
+	"portcon",
+	"netifcon",
+	"nodecon",
+}
+
+var keywordRank = func() map[string]int {
+	ret := make(map[string]int)
+	for i, kw := range keywordOrder {
+		ret[kw] = i
+	}
+	return ret
+}()
+
+func rankOf(kw string) int {
+	if r, ok := keywordRank[kw]; ok {
+		return r
+	}
+	// Statements not listed (block, macro, booleanif, ...) go last.
+	return len(keywordOrder)
+}
+
+// Normalize writes the given statements in canonical form: one statement per line with single
+// spaces, no comments or line markers, ordered by statement kind and then by text. Two CIL files
+// with the same statements therefore normalize to identical bytes. The returned source map
+// records the origin of every output line that was enclosed by a line marker.
+func Normalize(w io.Writer, stmts []*Statement) (*srcmap.Map, error) {
+	type line struct {
+		text   string
+		rank   int
+		origin *Origin
+	}
+	lines := make([]line, len(stmts))
+	for i, s := range stmts {
+		lines[i] = line{text: s.String(), rank: rankOf(s.Keyword()), origin: s.Origin}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].rank != lines[j].rank {
+			return lines[i].rank < lines[j].rank
+		}
+		return lines[i].text < lines[j].text
+	})
+
+	m := &srcmap.Map{}
+	bw := bufio.NewWriter(w)
+	for i, l := range lines {
+		if _, err := bw.WriteString(l.text + "\n"); err != nil {
+			return nil, err
+		}
+		if l.origin != nil {
+			m.Add(i+1, l.origin.File, l.origin.Line, true)
+		}
+	}
+	return m, bw.Flush()
+}
@@ -0,0 +1,314 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cil parses the SELinux Common Intermediate Language into a typed policy model. Line
+// markers emitted by checkpolicy (";;* lmx 12 system/sepolicy/public/foo.te") are preserved, so
+// every statement can be traced back to the .te file it was compiled from.
+package cil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Node is an S-expression of a CIL file. A node is either an atom or a list of nodes.
+type Node struct {
+	// Atom is the value of an atom node. Quoted strings keep their surrounding quotes.
+	Atom string
+
+	// List holds the children of a list node. It is nil for atoms.
+	List []*Node
+
+	// Line is the 1-based line of the CIL file where the node begins.
+	Line int
+}
+
+// IsList returns whether n is a list node.
+func (n *Node) IsList() bool {
+	return n.List != nil
+}
+
+// Keyword returns the first atom of a list node, e.g. "allow" for "(allow a b (file (read)))".
+func (n *Node) Keyword() string {
+	if len(n.List) == 0 || n.List[0].IsList() {
+		return ""
+	}
+	return n.List[0].Atom
+}
+
+// Args returns every child of a list node except the keyword.
+func (n *Node) Args() []*Node {
+	if len(n.List) == 0 {
+		return nil
+	}
+	return n.List[1:]
+}
+
+// String formats n in canonical form: a single space between elements and no extra whitespace.
+func (n *Node) String() string {
+	var sb strings.Builder
+	n.format(&sb)
+	return sb.String()
+}
+
+func (n *Node) format(sb *strings.Builder) {
+	if !n.IsList() {
+		sb.WriteString(n.Atom)
+		return
+	}
+	sb.WriteByte('(')
+	for i, c := range n.List {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		c.format(sb)
+	}
+	sb.WriteByte(')')
+}
+
+// Atoms returns every atom in n, flattened in order.
+func (n *Node) Atoms() []string {
+	if !n.IsList() {
+		return []string{n.Atom}
+	}
+	var ret []string
+	for _, c := range n.List {
+		ret = append(ret, c.Atoms()...)
+	}
+	return ret
+}
+
+// Origin is the location in a policy source file (usually a .te file) from which a CIL statement
+// was generated.
+type Origin struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+func (o Origin) String() string {
+	return fmt.Sprintf("%s:%d", o.File, o.Line)
+}
+
+// LineMarkerPrefix starts every line marker comment in a CIL file.
+const LineMarkerPrefix = ";;*"
+
+// lineMarker is an open ";;* lms", ";;* lmx" or ";;* lmh" region.
+type lineMarker struct {
+	kind string
+	// line and file given by the marker.
+	line int
+	file string
+	// line of the CIL file on which the marker itself appears.
+	cilLine int
+}
+
+// origin returns the source location of the CIL line cilLine inside the marker's region. Regions
+// marked with lmx are expanded from a single source line, whereas lms and lmh regions advance
+// with the CIL file.
+func (m *lineMarker) origin(cilLine int) *Origin {
+	if m.kind == "lmx" {
+		return &Origin{File: m.file, Line: m.line}
+	}
+	return &Origin{File: m.file, Line: m.line + cilLine - m.cilLine - 1}
+}
+
+// IsLineMarker returns whether the given line of a CIL file is a line marker comment.
+func IsLineMarker(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), LineMarkerPrefix)
+}
+
+// parseLineMarker parses a ";;* lmx 12 file" or ";;* lme" line. end is true for lme.
+func parseLineMarker(text string, cilLine int) (m *lineMarker, end bool, err error) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(text), LineMarkerPrefix))
+	if len(fields) == 0 {
+		return nil, false, fmt.Errorf("line %d: empty line marker", cilLine)
+	}
+	switch fields[0] {
+	case "lme":
+		return nil, true, nil
+	case "lms", "lmx", "lmh":
+		if len(fields) != 3 {
+			return nil, false, fmt.Errorf("line %d: malformed line marker %q", cilLine, text)
+		}
+		line, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, false, fmt.Errorf("line %d: malformed line number in %q", cilLine, text)
+		}
+		return &lineMarker{kind: fields[0], line: line, file: fields[2], cilLine: cilLine}, false, nil
+	}
+	return nil, false, fmt.Errorf("line %d: unknown line marker %q", cilLine, text)
+}
+
+// Statement is a list node appearing at the top level of a CIL file, or inside a container
+// statement such as block, optional, in, booleanif or tunableif.
+type Statement struct {
+	*Node
+
+	// Origin is the source location given by the innermost line marker enclosing the statement,
+	// or nil if the statement is not enclosed by any line marker.
+	Origin *Origin
+}
+
+// ParseNodes parses a CIL file into statements, keeping track of line markers. name is only used
+// in error messages.
+func ParseNodes(r io.Reader, name string) ([]*Statement, error) {
+	p := &parser{name: name, r: bufio.NewReader(r), line: 1}
+	return p.parse()
+}
+
+type parser struct {
+	name string
+	r    *bufio.Reader
+	line int
+
+	markers []*lineMarker
+	// atLineStart is true if no token has been read yet on the current line.
+	atLineStart bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.name, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) currentOrigin() *Origin {
+	if len(p.markers) == 0 {
+		return nil
+	}
+	return p.markers[len(p.markers)-1].origin(p.line)
+}
+
+func (p *parser) parse() ([]*Statement, error) {
+	var ret []*Statement
+	p.atLineStart = true
+	for {
+		tok, err := p.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if tok != "(" {
+			return nil, p.errorf("expected '(' but got %q", tok)
+		}
+		origin := p.currentOrigin()
+		node, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &Statement{Node: node, Origin: origin})
+	}
+	if len(p.markers) > 0 {
+		return nil, p.errorf("unterminated line marker %q", p.markers[len(p.markers)-1].file)
+	}
+	return ret, nil
+}
+
+// parseList parses the remainder of a list whose opening parenthesis was already consumed.
+func (p *parser) parseList() (*Node, error) {
+	node := &Node{List: []*Node{}, Line: p.line}
+	for {
+		tok, err := p.next()
+		if err == io.EOF {
+			return nil, p.errorf("unexpected end of file; missing ')' for list at line %d", node.Line)
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case ")":
+			return node, nil
+		case "(":
+			child, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			node.List = append(node.List, child)
+		default:
+			node.List = append(node.List, &Node{Atom: tok, Line: p.line})
+		}
+	}
+}
+
+// next returns the next token: "(", ")", a quoted string or an atom. Comments are skipped and line
+// markers are processed.
+func (p *parser) next() (string, error) {
+	for {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '\n':
+			p.line++
+			p.atLineStart = true
+		case c == ' ' || c == '\t' || c == '\r':
+			// skip
+		case c == ';':
+			rest, err := p.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			comment := ";" + strings.TrimSuffix(rest, "\n")
+			if p.atLineStart && IsLineMarker(comment) {
+				m, end, err := parseLineMarker(comment, p.line)
+				if err != nil {
+					return "", fmt.Errorf("%s:%w", p.name, err)
+				}
+				if end {
+					if len(p.markers) == 0 {
+						return "", p.errorf("unmatched lme line marker")
+					}
+					p.markers = p.markers[:len(p.markers)-1]
+				} else {
+					p.markers = append(p.markers, m)
+				}
+			}
+			if strings.HasSuffix(rest, "\n") {
+				p.line++
+				p.atLineStart = true
+			}
+		case c == '(' || c == ')':
+			p.atLineStart = false
+			return string(c), nil
+		case c == '"':
+			p.atLineStart = false
+			s, err := p.r.ReadString('"')
+			if err != nil {
+				return "", p.errorf("unterminated string")
+			}
+			p.line += strings.Count(s, "\n")
+			return `"` + s, nil
+		default:
+			p.atLineStart = false
+			var sb strings.Builder
+			sb.WriteByte(c)
+			for {
+				c, err := p.r.ReadByte()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return "", err
+				}
+				if c == '(' || c == ')' || c == ';' || c == '"' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+					p.r.UnreadByte()
+					break
+				}
+				sb.WriteByte(c)
+			}
+			return sb.String(), nil
+		}
+	}
+}
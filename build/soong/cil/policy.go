@@ -0,0 +1,503 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Type is a (type name) statement.
+type Type struct {
+	*Statement
+	Name string
+}
+
+// TypeAttribute is a (typeattribute name) statement.
+type TypeAttribute struct {
+	*Statement
+	Name string
+}
+
+// TypeAttributeSet is a (typeattributeset attr expr) statement. Expr is either a single name or a
+// list using the and / or / xor / not / all operators.
+type TypeAttributeSet struct {
+	*Statement
+	Attribute string
+	Expr      *Node
+}
+
+// AvRule is an access vector rule: allow, auditallow, dontaudit or neverallow.
+type AvRule struct {
+	*Statement
+	Kind   string
+	Source string
+	Target string
+
+	// ClassPerms is either a (class (perm ...)) list or the name of a classpermission set.
+	ClassPerms *Node
+}
+
+// Class returns the object class of the rule, or the classpermission name if the rule uses one.
+func (r *AvRule) Class() string {
+	return classOf(r.ClassPerms)
+}
+
+// Perms returns the permissions of the rule. It returns nil if the rule uses a named
+// classpermission set.
+func (r *AvRule) Perms() []string {
+	return permsOf(r.ClassPerms)
+}
+
+// AvRuleX is an extended permission rule: allowx, auditallowx, dontauditx or neverallowx.
+type AvRuleX struct {
+	*Statement
+	Kind   string
+	Source string
+	Target string
+
+	// Permission is either a (kind class (xperm ...)) list or the name of a permissionx set.
+	Permission *Node
+}
+
+// Operation returns the extended permission kind, e.g. "ioctl".
+func (r *AvRuleX) Operation() string {
+	if !r.Permission.IsList() || len(r.Permission.List) < 1 {
+		return ""
+	}
+	return r.Permission.List[0].Atom
+}
+
+// Class returns the object class of the rule.
+func (r *AvRuleX) Class() string {
+	if !r.Permission.IsList() || len(r.Permission.List) < 2 {
+		return r.Permission.Atom
+	}
+	return r.Permission.List[1].Atom
+}
+
+// TypeTransition is a (typetransition source target class [name] result) statement.
+type TypeTransition struct {
+	*Statement
+	Source string
+	Target string
+	Class  string
+	// Name is the object name of a named type transition, or empty.
+	Name   string
+	Result string
+}
+
+// Role is a (role name) statement.
+type Role struct {
+	*Statement
+	Name string
+}
+
+// RoleType is a (roletype role type) statement.
+type RoleType struct {
+	*Statement
+	Role string
+	Type string
+}
+
+// Sensitivity is a (sensitivity name) statement.
+type Sensitivity struct {
+	*Statement
+	Name string
+}
+
+// Category is a (category name) statement.
+type Category struct {
+	*Statement
+	Name string
+}
+
+// Order is a sensitivityorder, categoryorder, classorder or sidorder statement.
+type Order struct {
+	*Statement
+	Kind  string
+	Names []string
+}
+
+// SensitivityCategory is a (sensitivitycategory sensitivity categories) statement.
+type SensitivityCategory struct {
+	*Statement
+	Sensitivity string
+	Categories  *Node
+}
+
+// MlsConstrain is a (mlsconstrain classperms expr) or (mlsvalidatetrans class expr) statement.
+type MlsConstrain struct {
+	*Statement
+	Kind       string
+	ClassPerms *Node
+	Expr       *Node
+}
+
+// Policy is the typed model of one or more CIL files.
+type Policy struct {
+	// Statements holds every top-level statement, including those without a typed
+	// representation, in file order.
+	Statements []*Statement
+
+	Types                 []*Type
+	TypeAttributes        []*TypeAttribute
+	TypeAttributeSets     []*TypeAttributeSet
+	AvRules               []*AvRule
+	AvRuleXs              []*AvRuleX
+	TypeTransitions       []*TypeTransition
+	Roles                 []*Role
+	RoleTypes             []*RoleType
+	Sensitivities         []*Sensitivity
+	Categories            []*Category
+	Orders                []*Order
+	SensitivityCategories []*SensitivityCategory
+	MlsConstrains         []*MlsConstrain
+
+	expanded map[string]map[string]bool
+}
+
+// containers lists statements whose children are statements, and the index of the first child.
+var containers = map[string]int{
+	"block":    2,
+	"optional": 2,
+	"in":       2,
+	"macro":    3,
+}
+
+// conditionals lists statements whose children are (true ...) / (false ...) branches.
+var conditionals = map[string]int{
+	"booleanif": 2,
+	"tunableif": 2,
+}
+
+// Parse parses a CIL file into a Policy. name is only used in error messages.
+func Parse(r io.Reader, name string) (*Policy, error) {
+	p := &Policy{}
+	if err := p.Add(r, name); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ParseFiles parses and merges the given CIL files into a single Policy.
+func ParseFiles(paths ...string) (*Policy, error) {
+	p := &Policy{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = p.Add(f, path)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Add parses a CIL file and merges its statements into p.
+func (p *Policy) Add(r io.Reader, name string) error {
+	stmts, err := ParseNodes(r, name)
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		p.Statements = append(p.Statements, s)
+		if err := p.addStatement(s); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, s.Line, err)
+		}
+	}
+	p.expanded = nil
+	return nil
+}
+
+func atomArgs(s *Statement, n int) ([]string, error) {
+	args := s.Args()
+	if len(args) != n {
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", s.Keyword(), n, len(args))
+	}
+	ret := make([]string, n)
+	for i, a := range args {
+		if a.IsList() {
+			return nil, fmt.Errorf("%s: argument %d must be a name, got %s", s.Keyword(), i+1, a)
+		}
+		ret[i] = a.Atom
+	}
+	return ret, nil
+}
+
+func (p *Policy) addStatement(s *Statement) error {
+	kw := s.Keyword()
+	if idx, ok := containers[kw]; ok {
+		for i := idx; i < len(s.List); i++ {
+			if err := p.addChild(s, s.List[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if idx, ok := conditionals[kw]; ok {
+		for i := idx; i < len(s.List); i++ {
+			branch := s.List[i]
+			for _, c := range branch.Args() {
+				if err := p.addChild(s, c); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	args := s.Args()
+	switch kw {
+	case "type", "typeattribute", "role", "sensitivity", "category":
+		names, err := atomArgs(s, 1)
+		if err != nil {
+			return err
+		}
+		switch kw {
+		case "type":
+			p.Types = append(p.Types, &Type{Statement: s, Name: names[0]})
+		case "typeattribute":
+			p.TypeAttributes = append(p.TypeAttributes, &TypeAttribute{Statement: s, Name: names[0]})
+		case "role":
+			p.Roles = append(p.Roles, &Role{Statement: s, Name: names[0]})
+		case "sensitivity":
+			p.Sensitivities = append(p.Sensitivities, &Sensitivity{Statement: s, Name: names[0]})
+		case "category":
+			p.Categories = append(p.Categories, &Category{Statement: s, Name: names[0]})
+		}
+	case "typeattributeset":
+		if len(args) != 2 || args[0].IsList() {
+			return fmt.Errorf("malformed typeattributeset %s", s.Node)
+		}
+		p.TypeAttributeSets = append(p.TypeAttributeSets, &TypeAttributeSet{Statement: s, Attribute: args[0].Atom, Expr: args[1]})
+	case "allow", "auditallow", "dontaudit", "neverallow":
+		if len(args) != 3 || args[0].IsList() || args[1].IsList() {
+			return fmt.Errorf("malformed %s rule %s", kw, s.Node)
+		}
+		p.AvRules = append(p.AvRules, &AvRule{Statement: s, Kind: kw, Source: args[0].Atom, Target: args[1].Atom, ClassPerms: args[2]})
+	case "allowx", "auditallowx", "dontauditx", "neverallowx":
+		if len(args) != 3 || args[0].IsList() || args[1].IsList() {
+			return fmt.Errorf("malformed %s rule %s", kw, s.Node)
+		}
+		p.AvRuleXs = append(p.AvRuleXs, &AvRuleX{Statement: s, Kind: kw, Source: args[0].Atom, Target: args[1].Atom, Permission: args[2]})
+	case "typetransition":
+		var names []string
+		var err error
+		if len(args) == 5 {
+			names, err = atomArgs(s, 5)
+		} else {
+			names, err = atomArgs(s, 4)
+		}
+		if err != nil {
+			return err
+		}
+		t := &TypeTransition{Statement: s, Source: names[0], Target: names[1], Class: names[2], Result: names[len(names)-1]}
+		if len(names) == 5 {
+			t.Name = names[3]
+		}
+		p.TypeTransitions = append(p.TypeTransitions, t)
+	case "roletype":
+		names, err := atomArgs(s, 2)
+		if err != nil {
+			return err
+		}
+		p.RoleTypes = append(p.RoleTypes, &RoleType{Statement: s, Role: names[0], Type: names[1]})
+	case "sensitivityorder", "categoryorder", "classorder", "sidorder":
+		if len(args) != 1 || !args[0].IsList() {
+			return fmt.Errorf("malformed %s %s", kw, s.Node)
+		}
+		p.Orders = append(p.Orders, &Order{Statement: s, Kind: kw, Names: args[0].Atoms()})
+	case "sensitivitycategory":
+		if len(args) != 2 || args[0].IsList() {
+			return fmt.Errorf("malformed sensitivitycategory %s", s.Node)
+		}
+		p.SensitivityCategories = append(p.SensitivityCategories, &SensitivityCategory{Statement: s, Sensitivity: args[0].Atom, Categories: args[1]})
+	case "mlsconstrain", "mlsvalidatetrans":
+		if len(args) != 2 {
+			return fmt.Errorf("malformed %s %s", kw, s.Node)
+		}
+		p.MlsConstrains = append(p.MlsConstrains, &MlsConstrain{Statement: s, Kind: kw, ClassPerms: args[0], Expr: args[1]})
+	}
+	return nil
+}
+
+// addChild adds a statement nested in a container. The child inherits the container's origin.
+func (p *Policy) addChild(parent *Statement, n *Node) error {
+	if !n.IsList() {
+		return nil
+	}
+	return p.addStatement(&Statement{Node: n, Origin: parent.Origin})
+}
+
+// IsAttribute returns whether name is declared as a typeattribute.
+func (p *Policy) IsAttribute(name string) bool {
+	p.expand()
+	_, ok := p.expanded[name]
+	return ok
+}
+
+// ExpandType returns the sorted set of types that name stands for: name itself for a type, or
+// every member type of an attribute, with nested attributes and set expressions resolved.
+func (p *Policy) ExpandType(name string) []string {
+	p.expand()
+	members, ok := p.expanded[name]
+	if !ok {
+		return []string{name}
+	}
+	ret := make([]string, 0, len(members))
+	for t := range members {
+		ret = append(ret, t)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// expand resolves the members of every attribute.
+func (p *Policy) expand() {
+	if p.expanded != nil {
+		return
+	}
+	types := make(map[string]bool)
+	for _, t := range p.Types {
+		types[t.Name] = true
+	}
+	exprs := make(map[string][]*Node)
+	for _, a := range p.TypeAttributes {
+		if _, ok := exprs[a.Name]; !ok {
+			exprs[a.Name] = nil
+		}
+	}
+	for _, s := range p.TypeAttributeSets {
+		exprs[s.Attribute] = append(exprs[s.Attribute], s.Expr)
+	}
+
+	p.expanded = make(map[string]map[string]bool)
+	visiting := make(map[string]bool)
+	var resolve func(name string) map[string]bool
+	var eval func(n *Node) map[string]bool
+	eval = func(n *Node) map[string]bool {
+		if !n.IsList() {
+			if _, ok := exprs[n.Atom]; ok {
+				return resolve(n.Atom)
+			}
+			return map[string]bool{n.Atom: true}
+		}
+		if len(n.List) == 0 {
+			return nil
+		}
+		op := n.List[0]
+		if op.IsList() {
+			// A bare list of names, e.g. (typeattributeset attr (a b c)) or a nested list.
+			ret := make(map[string]bool)
+			for _, c := range n.List {
+				for t := range eval(c) {
+					ret[t] = true
+				}
+			}
+			return ret
+		}
+		switch op.Atom {
+		case "all":
+			return copySet(types)
+		case "not":
+			ret := copySet(types)
+			if len(n.List) > 1 {
+				for t := range eval(n.List[1]) {
+					delete(ret, t)
+				}
+			}
+			return ret
+		case "and", "or", "xor":
+			if len(n.List) != 3 {
+				return nil
+			}
+			a, b := eval(n.List[1]), eval(n.List[2])
+			ret := make(map[string]bool)
+			for t := range a {
+				if op.Atom == "or" || (op.Atom == "and") == b[t] {
+					ret[t] = true
+				}
+			}
+			if op.Atom != "and" {
+				for t := range b {
+					if !a[t] {
+						ret[t] = true
+					}
+				}
+			}
+			return ret
+		}
+		ret := make(map[string]bool)
+		for _, c := range n.List {
+			for t := range eval(c) {
+				ret[t] = true
+			}
+		}
+		return ret
+	}
+	resolve = func(name string) map[string]bool {
+		if ret, ok := p.expanded[name]; ok {
+			return ret
+		}
+		if visiting[name] {
+			// A cycle between attributes; CIL rejects these, so just stop the recursion.
+			return nil
+		}
+		visiting[name] = true
+		ret := make(map[string]bool)
+		for _, e := range exprs[name] {
+			for t := range eval(e) {
+				ret[t] = true
+			}
+		}
+		delete(visiting, name)
+		p.expanded[name] = ret
+		return ret
+	}
+	for name := range exprs {
+		resolve(name)
+	}
+}
+
+func copySet(s map[string]bool) map[string]bool {
+	ret := make(map[string]bool, len(s))
+	for k := range s {
+		ret[k] = true
+	}
+	return ret
+}
+
+func classOf(classPerms *Node) string {
+	if !classPerms.IsList() {
+		return classPerms.Atom
+	}
+	if len(classPerms.List) == 0 || classPerms.List[0].IsList() {
+		return ""
+	}
+	return classPerms.List[0].Atom
+}
+
+func permsOf(classPerms *Node) []string {
+	if !classPerms.IsList() || len(classPerms.List) < 2 {
+		return nil
+	}
+	return classPerms.List[1].Atoms()
+}
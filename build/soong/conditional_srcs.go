@@ -0,0 +1,145 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selinux
+
+import (
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// conditionalSrcsProperties are source files used only if the build configuration meets some
+// conditions. Every condition which is set must be met, and a condition is met if any of its
+// values is.
+type conditionalSrcsProperties struct {
+	// Sanitizers of the device (SANITIZE_TARGET), e.g. "address", "hwaddress" or "memtag_heap".
+	Sanitizers []string
+
+	// Native coverage modes: "clang" (CLANG_COVERAGE) or "gcov" (NATIVE_COVERAGE).
+	Coverage []string
+
+	// Build variants: "user", "userdebug" or "eng".
+	Build_variants []string
+
+	// A Soong config variable, met if its value is one of values.
+	Soong_config_variable struct {
+		Namespace *string
+		Variable  *string
+		Values    []string
+	}
+
+	// Files added to srcs if the conditions are met.
+	Srcs []string
+}
+
+// coverageModes are the valid values of coverage.
+var coverageModes = []string{"clang", "gcov"}
+
+// configBuildVariant returns the build variant of the current lunch target.
+func configBuildVariant(config android.Config) string {
+	if config.Eng() {
+		return "eng"
+	}
+	if config.Debuggable() {
+		return "userdebug"
+	}
+	return "user"
+}
+
+func anyInList(values, list []string) bool {
+	for _, v := range values {
+		if android.InList(v, list) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate reports invalid conditions as errors of property, and returns whether they are valid.
+func (p conditionalSrcsProperties) validate(ctx android.LoadHookContext, property string) bool {
+	soongConfig := p.Soong_config_variable
+	valid := true
+	if len(p.Sanitizers) == 0 && len(p.Coverage) == 0 && len(p.Build_variants) == 0 && !p.hasSoongConfig() {
+		ctx.PropertyErrorf(property, "an entry must have sanitizers, coverage, build_variants or soong_config_variable")
+		valid = false
+	}
+	for _, mode := range p.Coverage {
+		if !android.InList(mode, coverageModes) {
+			ctx.PropertyErrorf(property, "unknown coverage mode %q; expected one of %q", mode, coverageModes)
+			valid = false
+		}
+	}
+	for _, variant := range p.Build_variants {
+		if !android.InList(variant, buildVariants) {
+			ctx.PropertyErrorf(property, "unknown build variant %q; expected one of %q", variant, buildVariants)
+			valid = false
+		}
+	}
+	if p.hasSoongConfig() && (proptools.String(soongConfig.Namespace) == "" || proptools.String(soongConfig.Variable) == "" || len(soongConfig.Values) == 0) {
+		ctx.PropertyErrorf(property, "soong_config_variable must have namespace, variable and values")
+		valid = false
+	}
+	return valid
+}
+
+func (p conditionalSrcsProperties) hasSoongConfig() bool {
+	soongConfig := p.Soong_config_variable
+	return soongConfig.Namespace != nil || soongConfig.Variable != nil || len(soongConfig.Values) > 0
+}
+
+// matches returns whether the build configuration meets the conditions, with buildVariant as the
+// build variant. The build_variants condition isn't checked if buildVariant is empty.
+func (p conditionalSrcsProperties) matches(ctx android.EarlyModuleContext, buildVariant string) bool {
+	config := ctx.Config()
+	if len(p.Sanitizers) > 0 && !anyInList(p.Sanitizers, config.SanitizeDevice()) {
+		return false
+	}
+	if len(p.Coverage) > 0 {
+		var modes []string
+		if ctx.DeviceConfig().ClangCoverageEnabled() {
+			modes = append(modes, "clang")
+		}
+		if ctx.DeviceConfig().GcovCoverageEnabled() {
+			modes = append(modes, "gcov")
+		}
+		if !anyInList(p.Coverage, modes) {
+			return false
+		}
+	}
+	if len(p.Build_variants) > 0 && buildVariant != "" && !android.InList(buildVariant, p.Build_variants) {
+		return false
+	}
+	if p.hasSoongConfig() {
+		soongConfig := p.Soong_config_variable
+		value := config.VendorConfig(*soongConfig.Namespace).String(*soongConfig.Variable)
+		if !android.InList(value, soongConfig.Values) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectConditionalSrcs returns the srcs of the entries whose conditions the build configuration
+// meets, in order, with the build variant of the current lunch target. It runs in load hooks, so
+// that the selected files are added to srcs before their dependencies are.
+func selectConditionalSrcs(ctx android.LoadHookContext, property string, entries []conditionalSrcsProperties) []string {
+	var ret []string
+	for _, entry := range entries {
+		if entry.validate(ctx, property) && entry.matches(ctx, configBuildVariant(ctx.Config())) {
+			ret = append(ret, entry.Srcs...)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,90 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctxcheck
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFailuresFromOutput(t *testing.T) {
+	t.Parallel()
+
+	got := FailuresFromOutput([]byte(`Error: could not load context file from plat_file_contexts
+
+plat_seapp_contexts:12: Domain foo is not defined
+`))
+	expected := []Failure{
+		{Message: "Error: could not load context file from plat_file_contexts"},
+		{Message: "Domain foo is not defined", Source: "plat_seapp_contexts:12"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestResultWrite(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	r := &Result{Module: "plat_file_contexts_test", Contexts: "file_contexts", Passed: true}
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "module": "plat_file_contexts_test",
+  "contexts": "file_contexts",
+  "srcs": [],
+  "passed": true,
+  "failures": []
+}
+`
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+}
+
+func TestCheckKeystoreKeyContexts(t *testing.T) {
+	t.Parallel()
+
+	entries, failures, err := ParseKeystoreKeyContexts(strings.NewReader(`# comment
+0              u:object_r:su_key:s0
+1              u:object_r:shell_key:s0  # trailing comment
+-1             u:object_r:shell_key:s0
+foo
+1              u:object_r:vold_key:s0
+2              u:object_r:system_file:s0
+3              shell_key
+`), "keystore2_key_contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures = append(failures, CheckKeystoreKeyContexts(entries, map[string]bool{
+		"su_key":    true,
+		"shell_key": true,
+		"vold_key":  true,
+	})...)
+	expected := []Failure{
+		{Message: `namespace "-1" must be an integer in [0, 2^31)`, Source: "keystore2_key_contexts:4"},
+		{Message: "expected a namespace and a context", Source: "keystore2_key_contexts:5"},
+		{Message: "namespace 1 is already defined at keystore2_key_contexts:3", Source: "keystore2_key_contexts:6"},
+		{Message: `type "system_file" of "u:object_r:system_file:s0" isn't a keystore2_key_type`, Source: "keystore2_key_contexts:7"},
+		{Message: `invalid context "shell_key"`, Source: "keystore2_key_contexts:8"},
+	}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, failures)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctxcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KeystoreKeyEntry is a line of a keystore2_key_contexts file.
+type KeystoreKeyEntry struct {
+	Namespace int64
+	Context   string
+
+	// Source is where the entry comes from, as "file:line".
+	Source string
+}
+
+// ParseKeystoreKeyContexts parses a keystore2_key_contexts file. Malformed lines are returned as
+// failures. name is only used in sources.
+func ParseKeystoreKeyContexts(r io.Reader, name string) ([]KeystoreKeyEntry, []Failure, error) {
+	var entries []KeystoreKeyEntry
+	var failures []Failure
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", name, line)
+		if len(fields) != 2 {
+			failures = append(failures, Failure{Message: "expected a namespace and a context", Source: source})
+			continue
+		}
+		namespace, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || namespace < 0 || namespace >= 1<<31 {
+			failures = append(failures, Failure{
+				Message: fmt.Sprintf("namespace %q must be an integer in [0, 2^31)", fields[0]),
+				Source:  source,
+			})
+			continue
+		}
+		entries = append(entries, KeystoreKeyEntry{Namespace: namespace, Context: fields[1], Source: source})
+	}
+	return entries, failures, scanner.Err()
+}
+
+// CheckKeystoreKeyContexts checks that every namespace is defined once, and that the type of every
+// context is one of keyTypes, the types with the keystore2_key_type attribute.
+func CheckKeystoreKeyContexts(entries []KeystoreKeyEntry, keyTypes map[string]bool) []Failure {
+	var ret []Failure
+	namespaces := make(map[int64]KeystoreKeyEntry)
+	for _, e := range entries {
+		if other, ok := namespaces[e.Namespace]; ok {
+			ret = append(ret, Failure{
+				Message: fmt.Sprintf("namespace %d is already defined at %s", e.Namespace, other.Source),
+				Source:  e.Source,
+			})
+			continue
+		}
+		namespaces[e.Namespace] = e
+
+		parts := strings.Split(e.Context, ":")
+		if len(parts) < 4 {
+			ret = append(ret, Failure{Message: fmt.Sprintf("invalid context %q", e.Context), Source: e.Source})
+		} else if !keyTypes[parts[2]] {
+			ret = append(ret, Failure{
+				Message: fmt.Sprintf("type %q of %q isn't a keystore2_key_type", parts[2], e.Context),
+				Source:  e.Source,
+			})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ctxcheck writes the results of contexts tests, and checks keystore2_key_contexts files.
+package ctxcheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+)
+
+// Failure is a failed check of a contexts test.
+type Failure struct {
+	Message string `json:"message"`
+
+	// Source is the failing entry as "file:line", if known.
+	Source string `json:"source,omitempty"`
+}
+
+// Result is the result of a contexts test.
+type Result struct {
+	Module string `json:"module"`
+
+	// Contexts is the type of the tested contexts, e.g. "file_contexts".
+	Contexts string    `json:"contexts"`
+	Srcs     []string  `json:"srcs"`
+	Passed   bool      `json:"passed"`
+	Failures []Failure `json:"failures"`
+}
+
+// Write writes r as JSON.
+func (r *Result) Write(w io.Writer) error {
+	if r.Srcs == nil {
+		r.Srcs = []string{}
+	}
+	if r.Failures == nil {
+		r.Failures = []Failure{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// sourceRegex matches a "file:line:" location at the start of a message.
+var sourceRegex = regexp.MustCompile(`^([^\s:]+):(\d+):\s*`)
+
+// FailuresFromOutput returns a failure for each non-empty line of the output of a failed checker,
+// e.g. checkfc. A leading "file:line:" location is the source of the failure.
+func FailuresFromOutput(output []byte) []Failure {
+	var ret []Failure
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		f := Failure{Message: string(line)}
+		if m := sourceRegex.FindSubmatchIndex(line); m != nil {
+			f.Source = string(line[m[2]:m[5]])
+			f.Message = string(line[m[1]:])
+		}
+		ret = append(ret, f)
+	}
+	return ret
+}
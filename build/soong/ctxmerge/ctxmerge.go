@@ -0,0 +1,266 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ctxmerge merges the contexts files of every partition in the order the device uses
+// their entries, and finds entries of different partitions labeling the same thing.
+package ctxmerge
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"android/soong/selinux/fcsort"
+	"android/soong/selinux/propctx"
+	"android/soong/selinux/seapp"
+)
+
+// Types of contexts files.
+var Types = []string{
+	"file_contexts",
+	"hwservice_contexts",
+	"keystore2_key_contexts",
+	"property_contexts",
+	"seapp_contexts",
+	"service_contexts",
+	"vndservice_contexts",
+}
+
+// File is a contexts file of a partition.
+type File struct {
+	// Origin is where the file comes from, e.g. "vendor_file_contexts". Origins must be unique.
+	Origin string
+
+	// Vendor is whether the file is loaded from the vendor or odm partition.
+	Vendor bool
+
+	Data []byte
+}
+
+// Entry is an entry of a contexts file.
+type Entry struct {
+	// Key is what the entry labels, e.g. the path regular expression and file type of a
+	// file_contexts entry. Entries with the same key label the same things.
+	Key string
+
+	// Value is the label given by the entry, e.g. the context of a file_contexts entry.
+	Value string
+
+	// Line is the line of the entry, without comments, leading and trailing spaces.
+	Line string
+
+	// Origin is the origin of the file of the entry.
+	Origin string
+
+	// Source is where the entry comes from, as "origin:line".
+	Source string
+
+	// The parsed entry of file_contexts and seapp_contexts files, which are ordered by it.
+	fc    fcsort.Entry
+	seapp seapp.Entry
+}
+
+// String returns the entry annotated with its source.
+func (e Entry) String() string {
+	return e.Line + " # " + e.Source
+}
+
+// seappOutputs are the keys of seapp_contexts entries which aren't input selectors.
+var seappOutputs = map[string]bool{"domain": true, "type": true, "levelfrom": true, "levelfromuid": true, "level": true}
+
+// parse parses a contexts file of the given type.
+func parse(typ string, f File) ([]Entry, error) {
+	r := bytes.NewReader(f.Data)
+	var ret []Entry
+	switch typ {
+	case "file_contexts":
+		entries, err := fcsort.Parse(r, f.Origin)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ret = append(ret, Entry{Key: strings.TrimSpace(e.Path + " " + e.FileType), Value: e.Context, Line: e.Line, Source: e.Source, fc: e})
+		}
+	case "property_contexts":
+		entries, err := propctx.ParseContexts(r, f.Origin)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ret = append(ret, Entry{Key: e.Name + " " + e.Match, Value: strings.TrimSpace(e.Context + " " + e.Type), Line: e.String(), Source: e.Source})
+		}
+	case "seapp_contexts":
+		entries, err := seapp.Parse(r, f.Origin, f.Vendor)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			var selectors, outputs []string
+			for _, field := range strings.Fields(e.Line) {
+				key, value, _ := strings.Cut(field, "=")
+				if seappOutputs[strings.ToLower(key)] {
+					outputs = append(outputs, field)
+				} else {
+					selectors = append(selectors, strings.ToLower(key)+"="+value)
+				}
+			}
+			sort.Strings(selectors)
+			ret = append(ret, Entry{Key: strings.Join(selectors, " "), Value: strings.Join(outputs, " "), Line: e.Line, Source: e.Source, seapp: e})
+		}
+	case "hwservice_contexts", "keystore2_key_contexts", "service_contexts", "vndservice_contexts":
+		var err error
+		if ret, err = parseNameContexts(r, f.Origin); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown contexts type %q", typ)
+	}
+	for i := range ret {
+		ret[i].Origin = f.Origin
+	}
+	return ret, nil
+}
+
+// parseNameContexts parses a contexts file whose entries are a name and a context.
+func parseNameContexts(r io.Reader, name string) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Entry
+	for i, text := range strings.Split(string(data), "\n") {
+		if j := strings.IndexByte(text, '#'); j >= 0 {
+			text = text[:j]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", name, i+1)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: expected a name and a context", source)
+		}
+		ret = append(ret, Entry{Key: fields[0], Value: fields[1], Line: strings.Join(fields, " "), Source: source})
+	}
+	return ret, nil
+}
+
+// Merge returns the entries of the contexts files of every partition, given in the order the
+// device loads them, in the order the device uses them:
+//   - file_contexts: regular expressions before plain paths, as libselinux checks them from the
+//     last one;
+//   - seapp_contexts: by precedence, as libselinux checks them from the first one;
+//   - other types: in the order of files.
+func Merge(typ string, files []File) ([]Entry, error) {
+	var ret []Entry
+	var fcFiles [][]fcsort.Entry
+	var seappEntries []seapp.Entry
+	for _, f := range files {
+		entries, err := parse(typ, f)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, entries...)
+
+		var fc []fcsort.Entry
+		for _, e := range entries {
+			fc = append(fc, e.fc)
+			seappEntries = append(seappEntries, e.seapp)
+		}
+		fcFiles = append(fcFiles, fc)
+	}
+
+	// The entries are ordered by the package of their type, and found back from their source.
+	var sources []string
+	switch typ {
+	case "file_contexts":
+		for _, e := range fcsort.Merge(fcFiles...) {
+			sources = append(sources, e.Source)
+		}
+	case "seapp_contexts":
+		seapp.Sort(seappEntries)
+		for _, e := range seappEntries {
+			sources = append(sources, e.Source)
+		}
+	default:
+		return ret, nil
+	}
+	bySource := make(map[string]Entry)
+	for _, e := range ret {
+		bySource[e.Source] = e
+	}
+	for i, source := range sources {
+		ret[i] = bySource[source]
+	}
+	return ret, nil
+}
+
+// Kinds of findings.
+const (
+	// Duplicate is an entry giving the same label as an entry of another file.
+	Duplicate = "duplicate"
+
+	// Conflict is an entry giving a different label than an entry of another file.
+	Conflict = "conflict"
+)
+
+// Finding is an entry labeling the same things as an entry of another file.
+type Finding struct {
+	Kind  string
+	Entry Entry
+	Other Entry
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %q, %s: %q", f.Entry.Source, f.Kind, f.Entry.Line, f.Other.Source, f.Other.Line)
+}
+
+// Find returns the entries with the same key as an entry of another file, in the order of
+// entries. Each entry is compared with the first entry of the key from another file, which is a
+// conflict if their values differ.
+func Find(entries []Entry) []Finding {
+	first := make(map[string][]Entry)
+	var ret []Finding
+	for _, e := range entries {
+		var other *Entry
+		for i, f := range first[e.Key] {
+			if f.Origin != e.Origin {
+				other = &first[e.Key][i]
+				break
+			}
+		}
+		if other != nil {
+			kind := Duplicate
+			if other.Value != e.Value {
+				kind = Conflict
+			}
+			ret = append(ret, Finding{Kind: kind, Entry: e, Other: *other})
+		}
+		if !hasOrigin(first[e.Key], e.Origin) {
+			first[e.Key] = append(first[e.Key], e)
+		}
+	}
+	return ret
+}
+
+func hasOrigin(entries []Entry, origin string) bool {
+	for _, e := range entries {
+		if e.Origin == origin {
+			return true
+		}
+	}
+	return false
+}
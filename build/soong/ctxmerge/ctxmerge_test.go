@@ -0,0 +1,153 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctxmerge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func merge(t *testing.T, typ string, files ...File) []string {
+	t.Helper()
+	entries, err := Merge(typ, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.String())
+	}
+	return ret
+}
+
+func findings(t *testing.T, typ string, files ...File) []string {
+	t.Helper()
+	entries, err := Merge(typ, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []string
+	for _, f := range Find(entries) {
+		ret = append(ret, f.String())
+	}
+	return ret
+}
+
+func TestMergeFileContexts(t *testing.T) {
+	t.Parallel()
+
+	files := []File{
+		{Origin: "plat_file_contexts", Data: []byte(`/system/bin/sh u:object_r:shell_exec:s0
+/vendor(/.*)? u:object_r:vendor_file:s0
+/dev/foo -c u:object_r:foo_device:s0
+`)},
+		{Origin: "vendor_file_contexts", Vendor: true, Data: []byte(`# comment
+/vendor/bin/foo u:object_r:foo_exec:s0
+/vendor(/.*)? u:object_r:vendor_file:s0
+/dev/foo -c u:object_r:vendor_foo_device:s0
+`)},
+	}
+	expected := []string{
+		"/vendor(/.*)? u:object_r:vendor_file:s0 # plat_file_contexts:2",
+		"/vendor(/.*)? u:object_r:vendor_file:s0 # vendor_file_contexts:3",
+		"/system/bin/sh u:object_r:shell_exec:s0 # plat_file_contexts:1",
+		"/dev/foo -c u:object_r:foo_device:s0 # plat_file_contexts:3",
+		"/vendor/bin/foo u:object_r:foo_exec:s0 # vendor_file_contexts:2",
+		"/dev/foo -c u:object_r:vendor_foo_device:s0 # vendor_file_contexts:4",
+	}
+	if got := merge(t, "file_contexts", files...); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	expected = []string{
+		`vendor_file_contexts:3: duplicate: "/vendor(/.*)? u:object_r:vendor_file:s0", plat_file_contexts:2: "/vendor(/.*)? u:object_r:vendor_file:s0"`,
+		`vendor_file_contexts:4: conflict: "/dev/foo -c u:object_r:vendor_foo_device:s0", plat_file_contexts:3: "/dev/foo -c u:object_r:foo_device:s0"`,
+	}
+	if got := findings(t, "file_contexts", files...); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestMergeSeappContexts(t *testing.T) {
+	t.Parallel()
+
+	files := []File{
+		{Origin: "plat_seapp_contexts", Data: []byte(`neverallow user=_app domain=system_server
+user=_app domain=untrusted_app type=app_data_file levelFrom=all
+user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user
+`)},
+		{Origin: "vendor_seapp_contexts", Vendor: true, Data: []byte(`seinfo=platform user=_app domain=vendor_app type=app_data_file levelFrom=user
+user=_app seinfo=vendor name=com.foo domain=foo_app type=app_data_file levelFrom=all
+`)},
+	}
+	expected := []string{
+		"user=_app seinfo=vendor name=com.foo domain=foo_app type=app_data_file levelFrom=all # vendor_seapp_contexts:2",
+		"user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user # plat_seapp_contexts:3",
+		"seinfo=platform user=_app domain=vendor_app type=app_data_file levelFrom=user # vendor_seapp_contexts:1",
+		"user=_app domain=untrusted_app type=app_data_file levelFrom=all # plat_seapp_contexts:2",
+	}
+	if got := merge(t, "seapp_contexts", files...); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	expected = []string{
+		`vendor_seapp_contexts:1: conflict: "seinfo=platform user=_app domain=vendor_app type=app_data_file levelFrom=user", plat_seapp_contexts:3: "user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user"`,
+	}
+	if got := findings(t, "seapp_contexts", files...); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestMergeNameContexts(t *testing.T) {
+	t.Parallel()
+
+	for _, typ := range []string{"property_contexts", "service_contexts"} {
+		files := []File{
+			{Origin: "plat_" + typ, Data: []byte("foo u:object_r:foo:s0\nbar u:object_r:bar:s0\n")},
+			{Origin: "vendor_" + typ, Vendor: true, Data: []byte("baz u:object_r:baz:s0\nfoo u:object_r:vendor_foo:s0\n")},
+			{Origin: "odm_" + typ, Vendor: true, Data: []byte("bar u:object_r:bar:s0\n")},
+		}
+		prefix := ""
+		if typ == "property_contexts" {
+			prefix = " prefix"
+		}
+		expected := []string{
+			"foo u:object_r:foo:s0" + prefix + " # plat_" + typ + ":1",
+			"bar u:object_r:bar:s0" + prefix + " # plat_" + typ + ":2",
+			"baz u:object_r:baz:s0" + prefix + " # vendor_" + typ + ":1",
+			"foo u:object_r:vendor_foo:s0" + prefix + " # vendor_" + typ + ":2",
+			"bar u:object_r:bar:s0" + prefix + " # odm_" + typ + ":1",
+		}
+		if got := merge(t, typ, files...); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", typ, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+
+		var kinds []string
+		for _, f := range findings(t, typ, files...) {
+			kinds = append(kinds, strings.SplitN(f, ": ", 3)[1])
+		}
+		if expected := []string{Conflict, Duplicate}; !reflect.DeepEqual(kinds, expected) {
+			t.Errorf("%s: expected findings %q, got %q", typ, expected, kinds)
+		}
+	}
+
+	if _, err := Merge("service_contexts", []File{{Origin: "plat", Data: []byte("foo\n")}}); err == nil {
+		t.Error("expected an error for an entry without a context")
+	}
+	if _, err := Merge("foo_contexts", []File{{Origin: "plat"}}); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fcsort sorts file_contexts entries by specificity, the same way as fc_sort, and finds
+// entries which can never be used because a more specific entry always matches first.
+package fcsort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// metaChars are the characters which make a path a regular expression.
+const metaChars = ".^$?*+|[({"
+
+// Entry is a line of a file_contexts file.
+type Entry struct {
+	// Path is the path regular expression, e.g. "/data/misc(/.*)?".
+	Path string
+
+	// FileType is the file type, e.g. "--" or "-d", or empty if the entry applies to every type.
+	FileType string
+
+	Context string
+
+	// Line is the line of the entry, without leading and trailing spaces.
+	Line string
+
+	// Source is where the entry comes from, as "file:line".
+	Source string
+}
+
+// StemLen returns the length of the path up to its first metacharacter, not counting escaping
+// backslashes.
+func StemLen(path string) int {
+	ret := 0
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' {
+			i++
+		} else if strings.IndexByte(metaChars, path[i]) >= 0 {
+			break
+		}
+		ret++
+	}
+	return ret
+}
+
+// IsMeta returns whether the path is a regular expression rather than a plain path. As in
+// fc_sort, a path is a regular expression if it has more distinct metacharacters than distinct
+// escaped metacharacters.
+func IsMeta(path string) bool {
+	metaCount, escapedCount := 0, 0
+	for _, c := range metaChars {
+		if strings.ContainsRune(path, c) {
+			metaCount++
+		}
+		if strings.Contains(path, `\`+string(c)) {
+			escapedCount++
+		}
+	}
+	return metaCount > escapedCount
+}
+
+func strLen(path string) int {
+	return len(path) - strings.Count(path, `\`)
+}
+
+// lessSpecific returns whether a is less specific than b, as the comparator of fc_sort.
+func lessSpecific(a, b Entry) bool {
+	// A plain path is more specific than a regular expression.
+	if aMeta, bMeta := IsMeta(a.Path), IsMeta(b.Path); aMeta != bMeta {
+		return aMeta
+	}
+	// A longer stem is more specific.
+	if aStem, bStem := StemLen(a.Path), StemLen(b.Path); aStem != bStem {
+		return aStem < bStem
+	}
+	// A longer path is more specific.
+	if aLen, bLen := strLen(a.Path), strLen(b.Path); aLen != bLen {
+		return aLen < bLen
+	}
+	// An entry with a file type is more specific.
+	return a.FileType == "" && b.FileType != ""
+}
+
+// Parse parses a file_contexts file. Comments and empty lines are dropped. name is only used in
+// error messages and sources.
+func Parse(r io.Reader, name string) ([]Entry, error) {
+	var ret []Entry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected a path and a context", name, line)
+		}
+		e := Entry{
+			Path:    fields[0],
+			Context: fields[len(fields)-1],
+			Line:    text,
+			Source:  fmt.Sprintf("%s:%d", name, line),
+		}
+		if len(fields) == 3 {
+			e.FileType = fields[1]
+		}
+		ret = append(ret, e)
+	}
+	return ret, scanner.Err()
+}
+
+// Sort sorts entries from the least to the most specific. The sort is stable, so entries of the
+// same specificity keep their order.
+func Sort(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lessSpecific(entries[i], entries[j])
+	})
+}
+
+// Shadow is an entry which is never used, because another entry is checked first and matches the
+// paths and file type of the entry.
+type Shadow struct {
+	Entry Entry
+	By    Entry
+}
+
+func (s Shadow) String() string {
+	return fmt.Sprintf("%s: %q is shadowed by %q from %s", s.Entry.Source, s.Entry.Line, s.By.Line, s.By.Source)
+}
+
+// maxSamples bounds the number of sample paths of a regular expression.
+const maxSamples = 256
+
+// anyCharSamples are the samples of a character matched by '.'.
+var anyCharSamples = []string{"a", "/", "."}
+
+// samples returns sample strings matched by a regular expression: every alternative, zero, one
+// and two repetitions of repeated expressions, and a few characters of each character class. It
+// returns false if there would be more than maxSamples samples, or the expression has
+// unsupported operators.
+func samples(re *syntax.Regexp) ([]string, bool) {
+	repeat := func(sub []string, counts ...int) ([]string, bool) {
+		var ret []string
+		for _, count := range counts {
+			cur := []string{""}
+			for i := 0; i < count; i++ {
+				var ok bool
+				if cur, ok = concat(cur, sub); !ok {
+					return nil, false
+				}
+			}
+			ret = append(ret, cur...)
+		}
+		return ret, len(ret) <= maxSamples
+	}
+
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, true
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return anyCharSamples, true
+	case syntax.OpCharClass:
+		var ret []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			ret = append(ret, string(re.Rune[i]))
+			if re.Rune[i+1] != re.Rune[i] {
+				ret = append(ret, string(re.Rune[i+1]))
+			}
+		}
+		return ret, len(ret) > 0 && len(ret) <= maxSamples
+	case syntax.OpCapture:
+		return samples(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		sub, ok := samples(re.Sub[0])
+		if !ok {
+			return nil, false
+		}
+		switch re.Op {
+		case syntax.OpStar:
+			return repeat(sub, 0, 1, 2)
+		case syntax.OpPlus:
+			return repeat(sub, 1, 2)
+		case syntax.OpQuest:
+			return repeat(sub, 0, 1)
+		}
+		if re.Max == -1 || re.Min < re.Max {
+			return repeat(sub, re.Min, re.Min+1)
+		}
+		return repeat(sub, re.Min)
+	case syntax.OpConcat:
+		ret := []string{""}
+		for _, s := range re.Sub {
+			sub, ok := samples(s)
+			if !ok {
+				return nil, false
+			}
+			if ret, ok = concat(ret, sub); !ok {
+				return nil, false
+			}
+		}
+		return ret, true
+	case syntax.OpAlternate:
+		var ret []string
+		for _, s := range re.Sub {
+			sub, ok := samples(s)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, sub...)
+		}
+		return ret, len(ret) <= maxSamples
+	}
+	return nil, false
+}
+
+func concat(a, b []string) ([]string, bool) {
+	if len(a)*len(b) > maxSamples {
+		return nil, false
+	}
+	var ret []string
+	for _, x := range a {
+		for _, y := range b {
+			ret = append(ret, x+y)
+		}
+	}
+	return ret, true
+}
+
+// compiledPath is the path of an entry compiled as a regular expression matching whole paths,
+// with its sample paths.
+type compiledPath struct {
+	re      *regexp.Regexp
+	prefix  string
+	samples []string
+}
+
+func compile(path string) compiledPath {
+	var ret compiledPath
+	anchored := "^(?:" + path + ")$"
+	re, err := regexp.Compile(anchored)
+	if err != nil {
+		return ret
+	}
+	ret.re = re
+	ret.prefix, _ = re.LiteralPrefix()
+	if parsed, err := syntax.Parse(anchored, syntax.Perl); err == nil {
+		if s, ok := samples(parsed); ok && len(s) > 0 {
+			ret.samples = s
+		}
+	}
+	return ret
+}
+
+func (c compiledPath) matchesAll(paths []string) bool {
+	for _, p := range paths {
+		if !strings.HasPrefix(p, c.prefix) || !c.re.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// compilePaths compiles the paths of entries.
+func compilePaths(entries []Entry) []compiledPath {
+	ret := make([]compiledPath, len(entries))
+	for i, e := range entries {
+		ret[i] = compile(e.Path)
+	}
+	return ret
+}
+
+// covers returns whether c matches every sample path of other, which means c likely matches every
+// path other matches.
+func (c compiledPath) covers(other compiledPath) bool {
+	return other.samples != nil && c.re != nil && c.matchesAll(other.samples)
+}
+
+// Shadowed returns the shadowed entries of file_contexts entries, in the order of a file_contexts
+// file or of Merge. As libselinux uses the last matching entry, an entry is checked after every
+// entry below it, which in a sorted file is at least as specific. An entry is shadowed by such an
+// entry with the same path, or one matching every sample path of the entry (see samples), so this
+// is a heuristic for regular expressions. The shadowing entry must apply to every file type, or
+// have the same file type. Paths which aren't valid Go regular expressions are ignored.
+func Shadowed(entries []Entry) []Shadow {
+	compiled := compilePaths(entries)
+	var ret []Shadow
+	for i, e := range entries {
+		for j := len(entries) - 1; j > i; j-- {
+			other := entries[j]
+			if other.FileType != "" && other.FileType != e.FileType {
+				continue
+			}
+			if other.Path == e.Path || compiled[j].covers(compiled[i]) {
+				ret = append(ret, Shadow{Entry: e, By: other})
+				break
+			}
+		}
+	}
+	return ret
+}
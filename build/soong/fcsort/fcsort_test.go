@@ -0,0 +1,308 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fcsort
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStemLen(t *testing.T) {
+	t.Parallel()
+
+	for path, expected := range map[string]int{
+		"/data":           5,
+		"/data/system":    12,
+		"/data/(system)?": 6,
+		`/data/a\.b.*`:    9,
+	} {
+		if got := StemLen(path); got != expected {
+			t.Errorf("StemLen(%q): expected %d, got %d", path, expected, got)
+		}
+	}
+}
+
+func TestIsMeta(t *testing.T) {
+	t.Parallel()
+
+	for path, expected := range map[string]bool{
+		"/data":         false,
+		"/data$":        true,
+		`\$data`:        false,
+		"/data/l(/.*)?": true,
+	} {
+		if got := IsMeta(path); got != expected {
+			t.Errorf("IsMeta(%q): expected %t, got %t", path, expected, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	entries, err := Parse(strings.NewReader(`# comment
+/                                     u:object_r:rootfs:s0
+# another comment
+
+  /adb_keys     --        u:object_r:adb_keys_file:s0
+`), "file_contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Path: "/", Context: "u:object_r:rootfs:s0", Line: "/                                     u:object_r:rootfs:s0", Source: "file_contexts:2"},
+		{Path: "/adb_keys", FileType: "--", Context: "u:object_r:adb_keys_file:s0", Line: "/adb_keys     --        u:object_r:adb_keys_file:s0", Source: "file_contexts:5"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	if _, err := Parse(strings.NewReader("/data\n"), "file_contexts"); err == nil {
+		t.Error("expected an error for an entry without a context")
+	}
+}
+
+func parse(t *testing.T, text string) []Entry {
+	t.Helper()
+	entries, err := Parse(strings.NewReader(text), "file_contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func lines(entries []Entry) []string {
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.Line)
+	}
+	return ret
+}
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, `/data u:object_r:rootfs:s0
+/d u:object_r:rootfs:s0
+/data/l(/.*)? u:object_r:log:s0
+/data -- u:object_r:rootfs:s0
+/system(/.*)? u:object_r:system_file:s0
+/vendor(/.*)? u:object_r:vendor_file:s0
+`)
+	Sort(entries)
+	expected := []string{
+		// Regular expressions of the same specificity keep their order.
+		"/data/l(/.*)? u:object_r:log:s0",
+		"/system(/.*)? u:object_r:system_file:s0",
+		"/vendor(/.*)? u:object_r:vendor_file:s0",
+		"/d u:object_r:rootfs:s0",
+		"/data u:object_r:rootfs:s0",
+		"/data -- u:object_r:rootfs:s0",
+	}
+	if got := lines(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestShadowed(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, `/system(/.*)? u:object_r:system_file:s0
+/system/bin/sh -- u:object_r:shell_exec:s0
+/system/etc(/.*)? u:object_r:system_file:s0
+/system/lib(64)?(/.*)? u:object_r:system_lib_file:s0
+/system/lib(/.*)? u:object_r:system_file:s0
+/system/bin/sh u:object_r:system_file:s0
+/system/etc(/.*)? u:object_r:system_etc_file:s0
+/system/bin(/.*)? -- u:object_r:system_bin_file:s0
+/system/bin/.* u:object_r:system_bin_file:s0
+/system/bin/[a-z]+ u:object_r:system_bin_file:s0
+/data/foo u:object_r:foo_file:s0
+/data/foo u:object_r:bar_file:s0
+/data/[ u:object_r:broken:s0
+`)
+	Sort(entries)
+	var got []string
+	for _, s := range Shadowed(entries) {
+		got = append(got, s.String())
+	}
+	expected := []string{
+		// The regular expressions of the same specificity are checked in reverse order.
+		`file_contexts:3: "/system/etc(/.*)? u:object_r:system_file:s0" is shadowed by "/system/etc(/.*)? u:object_r:system_etc_file:s0" from file_contexts:7`,
+		// A longer path is more specific, and it matches every path of the shorter one.
+		`file_contexts:5: "/system/lib(/.*)? u:object_r:system_file:s0" is shadowed by "/system/lib(64)?(/.*)? u:object_r:system_lib_file:s0" from file_contexts:4`,
+		`file_contexts:11: "/data/foo u:object_r:foo_file:s0" is shadowed by "/data/foo u:object_r:bar_file:s0" from file_contexts:12`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	plat := parse(t, `/system(/.*)? u:object_r:system_file:s0
+/system/bin/sh -- u:object_r:shell_exec:s0
+`)
+	vendor := parse(t, `/vendor(/.*)? u:object_r:vendor_file:s0
+/vendor/bin/a\.out u:object_r:vendor_file:s0
+/system/bin/.* u:object_r:vendor_file:s0
+`)
+	expected := []string{
+		"/system(/.*)? u:object_r:system_file:s0",
+		"/vendor(/.*)? u:object_r:vendor_file:s0",
+		"/system/bin/.* u:object_r:vendor_file:s0",
+		"/system/bin/sh -- u:object_r:shell_exec:s0",
+		`/vendor/bin/a\.out u:object_r:vendor_file:s0`,
+	}
+	merged := Merge(plat, vendor)
+	if got := lines(merged); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// The vendor regular expression is checked before the platform one.
+	shadowed := Shadowed(merged)
+	if len(shadowed) != 0 {
+		t.Errorf("expected no shadowed entries, got %v", shadowed)
+	}
+}
+
+func TestFindUnmatchable(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, `/ u:object_r:rootfs:s0
+/data/ u:object_r:system_data_file:s0
+/data/foo/(bar|baz)/ u:object_r:system_data_file:s0
+/data/foo(/.*)? u:object_r:system_data_file:s0
+system/bin/sh u:object_r:shell_exec:s0
+.* u:object_r:default_file:s0
+`)
+	var got []string
+	for _, u := range FindUnmatchable(entries) {
+		got = append(got, u.String())
+	}
+	expected := []string{
+		`file_contexts:2: "/data/ u:object_r:system_data_file:s0" can never match a path: the path has a trailing slash`,
+		`file_contexts:3: "/data/foo/(bar|baz)/ u:object_r:system_data_file:s0" can never match a path: the path has a trailing slash`,
+		`file_contexts:5: "system/bin/sh u:object_r:shell_exec:s0" can never match a path: the path isn't absolute`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestTypeConflicts(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, `/vendor/bin(/.*)? -- u:object_r:vendor_file:s0
+/vendor/bin/hw(/.*)? u:object_r:vendor_file:s0
+/vendor/bin/hw -d u:object_r:vendor_file:s0
+/vendor/bin/sh -- u:object_r:vendor_shell_exec:s0
+/vendor/lib(/.*)? -d u:object_r:vendor_file:s0
+/vendor/lib/foo.so -l u:object_r:vendor_file:s0
+`)
+	var got []string
+	for _, c := range TypeConflicts(entries) {
+		got = append(got, c.String())
+	}
+	expected := []string{
+		`file_contexts:3: file type -d of "/vendor/bin/hw -d u:object_r:vendor_file:s0" contradicts file type -- of "/vendor/bin(/.*)? -- u:object_r:vendor_file:s0" from file_contexts:1`,
+		`file_contexts:6: file type -l of "/vendor/lib/foo.so -l u:object_r:vendor_file:s0" contradicts file type -d of "/vendor/lib(/.*)? -d u:object_r:vendor_file:s0" from file_contexts:5`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	t.Parallel()
+
+	manifest, err := ParseManifest(strings.NewReader(`bin d
+bin/hw/android.hardware.foo-service f
+/vendor/lib/libfoo.so -l
+my file --
+`), "manifest.txt", "/vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ManifestEntry{
+		{Path: "/vendor/bin", FileType: "-d"},
+		{Path: "/vendor/bin/hw/android.hardware.foo-service", FileType: "--"},
+		{Path: "/vendor/lib/libfoo.so", FileType: "-l"},
+		{Path: "/vendor/my file", FileType: "--"},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("expected %+v, got %+v", expected, manifest)
+	}
+
+	if _, err := ParseManifest(strings.NewReader("bin x\n"), "manifest.txt", "/"); err == nil {
+		t.Error("expected an error for an unknown file type")
+	}
+	if _, err := ParseManifest(strings.NewReader("bin\n"), "manifest.txt", "/"); err == nil {
+		t.Error("expected an error for a path without a file type")
+	}
+
+	// Output of find . -printf '%P %y\n', whose first line is the start directory.
+	manifest, err = ParseManifest(strings.NewReader(` d
+etc d
+etc/init.rc f
+bin d
+bin/link l
+`), "manifest.txt", "/vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []ManifestEntry{
+		{Path: "/vendor", FileType: "-d"},
+		{Path: "/vendor/etc", FileType: "-d"},
+		{Path: "/vendor/etc/init.rc", FileType: "--"},
+		{Path: "/vendor/bin", FileType: "-d"},
+		{Path: "/vendor/bin/link", FileType: "-l"},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("expected %+v, got %+v", expected, manifest)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	l := NewLabeler(Merge(parse(t, `/vendor(/.*)? u:object_r:vendor_file:s0
+/vendor/bin(/.*)? -- u:object_r:vendor_exec_file:s0
+/vendor/bin/sh -- u:object_r:vendor_shell_exec:s0
+`), parse(t, `/(vendor|system/vendor)/bin/hw/android\.hardware\.foo-service u:object_r:hal_foo_exec:s0
+/vendor/bin/hw u:object_r:vendor_file:s0
+`)))
+	for _, tc := range []struct {
+		path, fileType, context string
+	}{
+		{"/vendor/bin/hw/android.hardware.foo-service", "--", "u:object_r:hal_foo_exec:s0"},
+		{"/vendor/bin/hw", "-d", "u:object_r:vendor_file:s0"},
+		{"/vendor/bin/sh", "--", "u:object_r:vendor_shell_exec:s0"},
+		{"/vendor/bin/sh", "-l", "u:object_r:vendor_file:s0"},
+		{"/vendor/bin/foo", "--", "u:object_r:vendor_exec_file:s0"},
+		{"/odm/bin/foo", "--", ""},
+	} {
+		e, ok := l.Lookup(tc.path, tc.fileType)
+		if ok != (tc.context != "") || e.Context != tc.context {
+			t.Errorf("Lookup(%q, %q): expected %q, got %q", tc.path, tc.fileType, tc.context, e.Context)
+		}
+	}
+
+	if got := Type("u:object_r:vendor_file:s0"); got != "vendor_file" {
+		t.Errorf("expected vendor_file, got %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fcsort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// fileTypes maps the file types of find -printf %y to file_contexts file types.
+var fileTypes = map[string]string{
+	"f": "--",
+	"d": "-d",
+	"l": "-l",
+	"c": "-c",
+	"b": "-b",
+	"s": "-s",
+	"p": "-p",
+}
+
+// ManifestEntry is a path of a filesystem manifest.
+type ManifestEntry struct {
+	Path string
+
+	// FileType is the file type of the path in file_contexts syntax, e.g. "--" or "-d".
+	FileType string
+}
+
+// ParseManifest parses a filesystem manifest: a path and a file type per line, such as the output
+// of `find . -printf '%P %y\n'`. File types are either file_contexts file types, e.g. "--" or
+// "-d", or find file types, e.g. "f" or "d". Relative paths are relative to root, and a line with
+// only a file type, as find prints for the start directory, is root itself. name is only used in
+// error messages.
+func ParseManifest(r io.Reader, name, root string) ([]ManifestEntry, error) {
+	var ret []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		p, fileType := "", text
+		if i := strings.LastIndexAny(text, " \t"); i >= 0 {
+			p, fileType = strings.TrimSpace(text[:i]), text[i+1:]
+		} else if _, ok := fileTypes[text]; !ok && !isFileType(text) {
+			return nil, fmt.Errorf("%s:%d: expected a path and a file type", name, line)
+		}
+		if t, ok := fileTypes[fileType]; ok {
+			fileType = t
+		} else if !isFileType(fileType) {
+			return nil, fmt.Errorf("%s:%d: unknown file type %q", name, line, fileType)
+		}
+		if !path.IsAbs(p) {
+			p = path.Join(root, p)
+		}
+		ret = append(ret, ManifestEntry{Path: path.Clean(p), FileType: fileType})
+	}
+	return ret, scanner.Err()
+}
+
+func isFileType(fileType string) bool {
+	for _, t := range fileTypes {
+		if t == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+// Labeler looks up the entry of a path as libselinux does.
+type Labeler struct {
+	entries  []Entry
+	compiled []compiledPath
+}
+
+// NewLabeler returns a Labeler of entries in the order of a file_contexts file or of Merge.
+func NewLabeler(entries []Entry) *Labeler {
+	return &Labeler{entries: entries, compiled: compilePaths(entries)}
+}
+
+// Lookup returns the last entry matching a path of a file type, and false if none matches.
+// Entries whose path isn't a valid Go regular expression never match.
+func (l *Labeler) Lookup(path, fileType string) (Entry, bool) {
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e, c := l.entries[i], l.compiled[i]
+		if e.FileType != "" && e.FileType != fileType {
+			continue
+		}
+		if c.re != nil && strings.HasPrefix(path, c.prefix) && c.re.MatchString(path) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Type returns the type of a context, e.g. "system_file" for "u:object_r:system_file:s0".
+func Type(context string) string {
+	parts := strings.Split(context, ":")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
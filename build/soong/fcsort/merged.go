@@ -0,0 +1,123 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fcsort
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hasMetaChars returns whether the path has an unescaped metacharacter, as libselinux decides
+// whether an entry is a regular expression.
+func hasMetaChars(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' {
+			i++
+		} else if strings.IndexByte(metaChars, path[i]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the entries of the file_contexts files of every partition, given in the order the
+// device loads them, as a single file_contexts file: the entries of every file, with plain paths
+// moved after the regular expressions, as libselinux does before checking them from the last one.
+func Merge(files ...[]Entry) []Entry {
+	var regexes, plain []Entry
+	for _, entries := range files {
+		for _, e := range entries {
+			if hasMetaChars(e.Path) {
+				regexes = append(regexes, e)
+			} else {
+				plain = append(plain, e)
+			}
+		}
+	}
+	return append(regexes, plain...)
+}
+
+// Unmatchable is an entry whose path can never match a path being labeled.
+type Unmatchable struct {
+	Entry  Entry
+	Reason string
+}
+
+func (u Unmatchable) String() string {
+	return fmt.Sprintf("%s: %q can never match a path: %s", u.Entry.Source, u.Entry.Line, u.Reason)
+}
+
+// FindUnmatchable returns the entries whose path can't match an absolute path without a trailing
+// slash, which are the paths libselinux labels.
+func FindUnmatchable(entries []Entry) []Unmatchable {
+	var ret []Unmatchable
+	for i, c := range compilePaths(entries) {
+		e := entries[i]
+		switch {
+		case c.re == nil:
+			continue
+		case c.prefix != "" && !strings.HasPrefix(c.prefix, "/"):
+			ret = append(ret, Unmatchable{Entry: e, Reason: "the path isn't absolute"})
+		case c.samples != nil && !c.re.MatchString("/") && allTrailingSlash(c.samples):
+			ret = append(ret, Unmatchable{Entry: e, Reason: "the path has a trailing slash"})
+		}
+	}
+	return ret
+}
+
+func allTrailingSlash(paths []string) bool {
+	for _, p := range paths {
+		if !strings.HasSuffix(p, "/") {
+			return false
+		}
+	}
+	return true
+}
+
+// TypeConflict is an entry whose file type contradicts the file type of a broader entry, which is
+// checked after it and matches its paths.
+type TypeConflict struct {
+	Entry   Entry
+	Broader Entry
+}
+
+func (c TypeConflict) String() string {
+	return fmt.Sprintf("%s: file type %s of %q contradicts file type %s of %q from %s",
+		c.Entry.Source, c.Entry.FileType, c.Entry.Line, c.Broader.FileType, c.Broader.Line, c.Broader.Source)
+}
+
+// TypeConflicts returns the entries with a file type, in the order of a file_contexts file or of
+// Merge, for which the next broader entry checked with a file type has another file type: one of
+// them assumes the wrong type for the path.
+func TypeConflicts(entries []Entry) []TypeConflict {
+	compiled := compilePaths(entries)
+	var ret []TypeConflict
+	for i, e := range entries {
+		if e.FileType == "" {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			broader := entries[j]
+			if broader.FileType == "" || !compiled[j].covers(compiled[i]) {
+				continue
+			}
+			if broader.FileType != e.FileType {
+				ret = append(ret, TypeConflict{Entry: e, Broader: broader})
+			}
+			break
+		}
+	}
+	return ret
+}
@@ -167,13 +167,24 @@ func (f *flaggableModuleBase) flagDeps(ctx android.BottomUpMutatorContext) {
 
 // getBuildFlags returns a map from flag names to flag values.
 func (f *flaggableModuleBase) getBuildFlags(ctx android.ModuleContext) map[string]string {
+	ret, _ := f.getBuildFlagsWithSources(ctx)
+	return ret
+}
+
+// getBuildFlagsWithSources is like getBuildFlags, but also returns a map from flag names to the
+// se_flags_collector modules providing them.
+func (f *flaggableModuleBase) getBuildFlagsWithSources(ctx android.ModuleContext) (map[string]string, map[string]string) {
 	ret := make(map[string]string)
+	sources := make(map[string]string)
 	ctx.VisitDirectDepsWithTag(buildFlagsDepTag, func(m android.Module) {
 		if dep, ok := android.OtherModuleProvider(ctx, m, buildFlagsProviderKey); ok {
 			maps.Copy(ret, dep.BuildFlags)
+			for flag := range dep.BuildFlags {
+				sources[flag] = ctx.OtherModuleName(m)
+			}
 		} else {
 			ctx.PropertyErrorf("build_flags", "unknown dependency %q", ctx.OtherModuleName(m))
 		}
 	})
-	return ret
+	return ret, sources
 }
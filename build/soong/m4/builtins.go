@@ -0,0 +1,337 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package m4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type builtin struct {
+	// blind builtins are only recognized when followed by arguments, as in GNU m4.
+	blind   bool
+	minArgs int
+	fn      func(p *Processor, tok token, args []string) (string, error)
+}
+
+var builtins map[string]*builtin
+
+func init() {
+	// Assigned in init to break the initialization cycle through Processor.call.
+	builtins = map[string]*builtin{
+		"changecom":   {fn: changecom},
+		"changequote": {fn: changequote},
+		"decr":        {blind: true, minArgs: 1, fn: incrBy(-1)},
+		"define":      {blind: true, minArgs: 1, fn: define(false)},
+		"divert":      {fn: divert},
+		"divnum":      {fn: divnum},
+		"dnl":         {fn: dnl},
+		"errprint":    {blind: true, minArgs: 1, fn: errprint},
+		"eval":        {blind: true, minArgs: 1, fn: eval},
+		"ifdef":       {blind: true, minArgs: 2, fn: ifdef},
+		"ifelse":      {blind: true, minArgs: 1, fn: ifelse},
+		"include":     {blind: true, minArgs: 1, fn: include(false)},
+		"incr":        {blind: true, minArgs: 1, fn: incrBy(1)},
+		"index":       {blind: true, minArgs: 2, fn: index},
+		"len":         {blind: true, minArgs: 1, fn: length},
+		"popdef":      {blind: true, minArgs: 1, fn: popdef},
+		"pushdef":     {blind: true, minArgs: 1, fn: define(true)},
+		"shift":       {blind: true, minArgs: 1, fn: shift},
+		"sinclude":    {blind: true, minArgs: 1, fn: include(true)},
+		"substr":      {blind: true, minArgs: 2, fn: substr},
+		"translit":    {blind: true, minArgs: 2, fn: translit},
+		"undefine":    {blind: true, minArgs: 1, fn: undefine},
+		"undivert":    {fn: undivert},
+		"__file__":    {fn: file},
+		"__line__":    {fn: line},
+	}
+}
+
+func define(push bool) func(p *Processor, tok token, args []string) (string, error) {
+	return func(p *Processor, tok token, args []string) (string, error) {
+		value := ""
+		if len(args) > 1 {
+			value = args[1]
+		}
+		p.setMacro(&macroDef{Macro: Macro{Name: args[0], Value: value, File: tok.file, Line: tok.line}}, push)
+		return "", nil
+	}
+}
+
+func undefine(p *Processor, tok token, args []string) (string, error) {
+	for _, name := range args {
+		delete(p.macros, name)
+	}
+	return "", nil
+}
+
+func popdef(p *Processor, tok token, args []string) (string, error) {
+	for _, name := range args {
+		if defs := p.macros[name]; len(defs) > 0 {
+			p.macros[name] = defs[:len(defs)-1]
+		}
+	}
+	return "", nil
+}
+
+func ifdef(p *Processor, tok token, args []string) (string, error) {
+	if p.lookup(args[0]) != nil {
+		return args[1], nil
+	}
+	if len(args) > 2 {
+		return args[2], nil
+	}
+	return "", nil
+}
+
+// ifelse(a, b, equal, [c, d, equal2, ...], [notequal]). A single argument is a comment.
+func ifelse(p *Processor, tok token, args []string) (string, error) {
+	if len(args) == 1 {
+		return "", nil
+	}
+	for {
+		if len(args) < 3 {
+			p.warnf(tok.file, tok.line, "too few arguments to builtin %q", "ifelse")
+			return "", nil
+		}
+		if args[0] == args[1] {
+			return args[2], nil
+		}
+		switch len(args) {
+		case 3:
+			return "", nil
+		case 4, 5:
+			return args[3], nil
+		}
+		args = args[3:]
+	}
+}
+
+func shift(p *Processor, tok token, args []string) (string, error) {
+	return p.quoteArgs(args[1:]), nil
+}
+
+func changequote(p *Processor, tok token, args []string) (string, error) {
+	p.lquote, p.rquote = "`", "'"
+	if len(args) > 0 {
+		p.lquote = args[0]
+		if len(args) > 1 && args[1] != "" {
+			p.rquote = args[1]
+		}
+	}
+	return "", nil
+}
+
+func changecom(p *Processor, tok token, args []string) (string, error) {
+	p.bcomm, p.ecomm = "", "\n"
+	if len(args) > 0 {
+		p.bcomm = args[0]
+		if len(args) > 1 && args[1] != "" {
+			p.ecomm = args[1]
+		}
+	}
+	return "", nil
+}
+
+// dnl discards the input up to and including the next newline.
+func dnl(p *Processor, tok token, args []string) (string, error) {
+	for {
+		c, ok := p.readByte()
+		if !ok {
+			p.warnf(tok.file, tok.line, "end of file treated as newline")
+			return "", nil
+		}
+		if c == '\n' {
+			return "", nil
+		}
+	}
+}
+
+func toInt(p *Processor, tok token, s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		p.warnf(tok.file, tok.line, "empty string treated as 0 in builtin %q", tok.text)
+		return 0
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		p.warnf(tok.file, tok.line, "non-numeric argument %q to builtin %q", s, tok.text)
+	}
+	return n
+}
+
+func divert(p *Processor, tok token, args []string) (string, error) {
+	p.diversion = 0
+	if len(args) > 0 && args[0] != "" {
+		p.diversion = int(toInt(p, tok, args[0]))
+	}
+	return "", nil
+}
+
+func divnum(p *Processor, tok token, args []string) (string, error) {
+	return strconv.Itoa(p.diversion), nil
+}
+
+func undivert(p *Processor, tok token, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", p.undivertAll()
+	}
+	for _, a := range args {
+		if err := p.undivert(int(toInt(p, tok, a))); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func include(silent bool) func(p *Processor, tok token, args []string) (string, error) {
+	return func(p *Processor, tok token, args []string) (string, error) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			if silent {
+				return "", nil
+			}
+			return "", fmt.Errorf("%s:%d: cannot open %q: %w", tok.file, tok.line, args[0], err)
+		}
+		if len(data) > 0 {
+			return "", p.pushFile(data, args[0])
+		}
+		return "", nil
+	}
+}
+
+func incrBy(delta int64) func(p *Processor, tok token, args []string) (string, error) {
+	return func(p *Processor, tok token, args []string) (string, error) {
+		return strconv.FormatInt(toInt(p, tok, args[0])+delta, 10), nil
+	}
+}
+
+func eval(p *Processor, tok token, args []string) (string, error) {
+	n, err := evalExpr(args[0])
+	if errors.Is(err, errDivideByZero) || errors.Is(err, errModuloByZero) {
+		return "", fmt.Errorf("%s:%d: %s in eval: %s", tok.file, tok.line, err, args[0])
+	} else if err != nil {
+		p.warnf(tok.file, tok.line, "bad expression in eval: %s", err)
+		return "", nil
+	}
+	radix := 10
+	if len(args) > 1 && args[1] != "" {
+		radix = int(toInt(p, tok, args[1]))
+		if radix < 2 || radix > 36 {
+			p.warnf(tok.file, tok.line, "radix %d in builtin %q out of range", radix, "eval")
+			return "", nil
+		}
+	}
+	s := strconv.FormatInt(n, radix)
+	if len(args) > 2 && args[2] != "" {
+		width := int(toInt(p, tok, args[2]))
+		neg := strings.HasPrefix(s, "-")
+		digits := strings.TrimPrefix(s, "-")
+		if len(digits) < width {
+			digits = strings.Repeat("0", width-len(digits)) + digits
+		}
+		if neg {
+			digits = "-" + digits
+		}
+		s = digits
+	}
+	return s, nil
+}
+
+func length(p *Processor, tok token, args []string) (string, error) {
+	return strconv.Itoa(len(args[0])), nil
+}
+
+func index(p *Processor, tok token, args []string) (string, error) {
+	return strconv.Itoa(strings.Index(args[0], args[1])), nil
+}
+
+func substr(p *Processor, tok token, args []string) (string, error) {
+	s := args[0]
+	start := int(toInt(p, tok, args[1]))
+	if start < 0 || start >= len(s) {
+		return "", nil
+	}
+	end := len(s)
+	if len(args) > 2 && args[2] != "" {
+		if n := int(toInt(p, tok, args[2])); n < end-start {
+			end = start + n
+		}
+	}
+	if end <= start {
+		return "", nil
+	}
+	return s[start:end], nil
+}
+
+// expandRanges expands character ranges such as "a-z" in the arguments of translit.
+func expandRanges(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i+2 < len(s) && s[i+1] == '-' {
+			from, to := s[i], s[i+2]
+			if from <= to {
+				for c := int(from); c <= int(to); c++ {
+					sb.WriteByte(byte(c))
+				}
+			} else {
+				for c := int(from); c >= int(to); c-- {
+					sb.WriteByte(byte(c))
+				}
+			}
+			i += 2
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func translit(p *Processor, tok token, args []string) (string, error) {
+	from := expandRanges(args[1])
+	to := ""
+	if len(args) > 2 {
+		to = expandRanges(args[2])
+	}
+	var sb strings.Builder
+	for i := 0; i < len(args[0]); i++ {
+		c := args[0][i]
+		idx := strings.IndexByte(from, c)
+		switch {
+		case idx < 0:
+			sb.WriteByte(c)
+		case idx < len(to):
+			sb.WriteByte(to[idx])
+		}
+	}
+	return sb.String(), nil
+}
+
+func errprint(p *Processor, tok token, args []string) (string, error) {
+	_, err := io.WriteString(p.Stderr, strings.Join(args, " "))
+	return "", err
+}
+
+func file(p *Processor, tok token, args []string) (string, error) {
+	return p.lquote + tok.file + p.rquote, nil
+}
+
+func line(p *Processor, tok token, args []string) (string, error) {
+	return strconv.Itoa(tok.line), nil
+}
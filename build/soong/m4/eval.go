@@ -0,0 +1,254 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package m4
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errDivideByZero and errModuloByZero are errors of eval, rather than warnings as other bad
+// expressions are, as with GNU m4.
+var (
+	errDivideByZero = errors.New("divide by zero")
+	errModuloByZero = errors.New("modulo by zero")
+)
+
+// binaryOps lists the binary operators of eval, from the lowest to the highest precedence.
+// Operators of a level are tried in order, so longer operators come first.
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{">=", "<=", ">", "<"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+	{"**"},
+}
+
+var twoCharOps = func() map[string]bool {
+	ret := make(map[string]bool)
+	for _, ops := range binaryOps {
+		for _, op := range ops {
+			if len(op) == 2 {
+				ret[op] = true
+			}
+		}
+	}
+	return ret
+}()
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+// evalExpr evaluates an integer expression like GNU m4's eval.
+func evalExpr(s string) (int64, error) {
+	p := &exprParser{s: s}
+	n, err := p.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return 0, fmt.Errorf("unexpected %q in %q", p.s[p.pos:], s)
+	}
+	return n, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+// operator consumes and returns the first of ops that the input continues with.
+func (p *exprParser) operator(ops []string) string {
+	p.skipSpace()
+	rest := p.s[p.pos:]
+	for _, op := range ops {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		// Don't mistake the first character of a two character operator for op, e.g. "&" for
+		// "&&" or "*" for "**".
+		if len(op) == 1 && len(rest) > 1 && twoCharOps[rest[:2]] {
+			continue
+		}
+		p.pos += len(op)
+		return op
+	}
+	return ""
+}
+
+func (p *exprParser) binary(level int) (int64, error) {
+	if level == len(binaryOps) {
+		return p.unary()
+	}
+	lhs, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.operator(binaryOps[level])
+		if op == "" {
+			return lhs, nil
+		}
+		next := level + 1
+		if op == "**" {
+			// Exponentiation is right associative.
+			next = level
+		}
+		rhs, err := p.binary(next)
+		if err != nil {
+			return 0, err
+		}
+		if lhs, err = apply(op, lhs, rhs); err != nil {
+			return 0, err
+		}
+		if op == "**" {
+			return lhs, nil
+		}
+	}
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func apply(op string, a, b int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolToInt(a != 0 || b != 0), nil
+	case "&&":
+		return boolToInt(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return boolToInt(a == b), nil
+	case "!=":
+		return boolToInt(a != b), nil
+	case ">=":
+		return boolToInt(a >= b), nil
+	case "<=":
+		return boolToInt(a <= b), nil
+	case ">":
+		return boolToInt(a > b), nil
+	case "<":
+		return boolToInt(a < b), nil
+	case "<<":
+		return a << uint64(b), nil
+	case ">>":
+		return a >> uint64(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 && op == "/" {
+			return 0, errDivideByZero
+		} else if b == 0 {
+			return 0, errModuloByZero
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	case "**":
+		if b < 0 {
+			return 0, errors.New("negative exponent")
+		}
+		ret := int64(1)
+		for ; b > 0; b-- {
+			ret *= a
+		}
+		return ret, nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", op)
+}
+
+func (p *exprParser) unary() (int64, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0, errors.New("missing operand")
+	}
+	switch c := p.s[p.pos]; c {
+	case '-', '+', '~', '!':
+		p.pos++
+		n, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case '-':
+			return -n, nil
+		case '~':
+			return ^n, nil
+		case '!':
+			return boolToInt(n == 0), nil
+		}
+		return n, nil
+	case '(':
+		p.pos++
+		n, err := p.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] != ')' {
+			return 0, errors.New("missing ')'")
+		}
+		p.pos++
+		return n, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	lit := p.s[start:p.pos]
+	if lit == "" {
+		return 0, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X"):
+		base, lit = 16, lit[2:]
+	case strings.HasPrefix(lit, "0b") || strings.HasPrefix(lit, "0B"):
+		base, lit = 2, lit[2:]
+	case len(lit) > 1 && lit[0] == '0':
+		base, lit = 8, lit[1:]
+	}
+	n, err := strconv.ParseInt(lit, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", p.s[start:p.pos])
+	}
+	return n, nil
+}
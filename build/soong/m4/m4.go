@@ -0,0 +1,589 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package m4 is a macro processor compatible with the subset of GNU m4 used by sepolicy: user
+// macros with $0-$N, $#, $* and $@, quoting, comments, diversions, file inclusion, and the
+// builtins listed in builtins.go. Like m4 -s, it can emit #line sync lines so that the output can
+// be traced back to the input files.
+package m4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxInputDepth bounds the input stack, which grows with every macro expansion that is still
+// being read. It catches infinitely recursive macros.
+const maxInputDepth = 1 << 16
+
+// Diagnostic is a warning reported while processing input.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// Macro is an entry of the macro table.
+type Macro struct {
+	Name    string `json:"name"`
+	Value   string `json:"value,omitempty"`
+	Builtin bool   `json:"builtin,omitempty"`
+
+	// File and Line give where the macro was defined. Both are empty for builtins and for macros
+	// defined with Define, e.g. from the command line.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+type macroDef struct {
+	Macro
+	builtin *builtin
+}
+
+// Processor expands m4 input. The zero value isn't usable; use New.
+type Processor struct {
+	// SyncLines enables "#line N" and "#line N \"file\"" sync lines in the output, like m4 -s.
+	SyncLines bool
+
+	// WarnUndefined reports a warning for every name immediately followed by '(' that isn't a
+	// defined macro. Such a name is most likely a misspelled or missing macro.
+	WarnUndefined bool
+
+	// Stderr receives the output of errprint. Defaults to os.Stderr.
+	Stderr io.Writer
+
+	macros   map[string][]*macroDef
+	input    []*source
+	warnings []Diagnostic
+
+	lquote, rquote string
+	bcomm, ecomm   string
+
+	out        io.Writer
+	diversion  int
+	diversions map[int]*bytes.Buffer
+
+	// State of sync line output.
+	startOfLine bool
+	outFile     string
+	outLine     int
+}
+
+// source is a file being read, or text pushed back onto the input by a macro expansion.
+type source struct {
+	text   []byte
+	pos    int
+	file   string
+	line   int
+	isFile bool
+}
+
+// New returns a processor with the builtin macros defined.
+func New() *Processor {
+	p := &Processor{
+		Stderr:      os.Stderr,
+		macros:      make(map[string][]*macroDef),
+		lquote:      "`",
+		rquote:      "'",
+		bcomm:       "#",
+		ecomm:       "\n",
+		diversions:  make(map[int]*bytes.Buffer),
+		startOfLine: true,
+	}
+	for name, b := range builtins {
+		p.macros[name] = []*macroDef{{Macro: Macro{Name: name, Builtin: true}, builtin: b}}
+	}
+	return p
+}
+
+// Define defines the macro name as value, like m4 -D name=value.
+func (p *Processor) Define(name, value string) {
+	p.setMacro(&macroDef{Macro: Macro{Name: name, Value: value}}, false)
+}
+
+func (p *Processor) setMacro(m *macroDef, push bool) {
+	if push || len(p.macros[m.Name]) == 0 {
+		p.macros[m.Name] = append(p.macros[m.Name], m)
+	} else {
+		defs := p.macros[m.Name]
+		defs[len(defs)-1] = m
+	}
+}
+
+func (p *Processor) lookup(name string) *macroDef {
+	if defs := p.macros[name]; len(defs) > 0 {
+		return defs[len(defs)-1]
+	}
+	return nil
+}
+
+// Macros returns the current macro table, sorted by name.
+func (p *Processor) Macros() []Macro {
+	var ret []Macro
+	for _, defs := range p.macros {
+		if len(defs) > 0 {
+			ret = append(ret, defs[len(defs)-1].Macro)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Warnings returns the warnings reported so far.
+func (p *Processor) Warnings() []Diagnostic {
+	return p.warnings
+}
+
+func (p *Processor) warnf(file string, line int, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, Diagnostic{File: file, Line: line, Message: "warning: " + fmt.Sprintf(format, args...)})
+}
+
+// ProcessFile expands the given file and writes the result to w.
+func (p *Processor) ProcessFile(path string, w io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return p.process(data, path, w)
+}
+
+// Process expands the input read from r and writes the result to w. name is used for sync lines
+// and diagnostics.
+func (p *Processor) Process(r io.Reader, name string, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return p.process(data, name, w)
+}
+
+func (p *Processor) process(data []byte, name string, w io.Writer) error {
+	p.out = w
+	if err := p.pushFile(data, name); err != nil {
+		return err
+	}
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind == tokenEOF {
+			return nil
+		}
+		if err := p.expandToken(tok, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// Finish writes the remaining diversions to w, like m4 does at the end of input.
+func (p *Processor) Finish(w io.Writer) error {
+	p.out = w
+	p.diversion = 0
+	return p.undivertAll()
+}
+
+func (p *Processor) pushFile(data []byte, name string) error {
+	return p.push(&source{text: data, file: name, line: 1, isFile: true})
+}
+
+func (p *Processor) push(s *source) error {
+	// Drop exhausted sources first, so that tail recursive macros don't grow the input stack.
+	p.top()
+	if len(p.input) >= maxInputDepth {
+		return fmt.Errorf("%s:%d: recursion limit exceeded", s.file, s.line)
+	}
+	if s.isFile {
+		// Force a sync line with the file name at the next output line.
+		p.outFile = ""
+	}
+	p.input = append(p.input, s)
+	return nil
+}
+
+// top returns the source to read from, popping exhausted sources. It returns nil at the end of
+// input.
+func (p *Processor) top() *source {
+	for len(p.input) > 0 {
+		s := p.input[len(p.input)-1]
+		if s.pos < len(s.text) {
+			return s
+		}
+		p.input = p.input[:len(p.input)-1]
+		if s.isFile {
+			p.outFile = ""
+		}
+	}
+	return nil
+}
+
+func (p *Processor) peekByte() (byte, bool) {
+	s := p.top()
+	if s == nil {
+		return 0, false
+	}
+	return s.text[s.pos], true
+}
+
+func (p *Processor) readByte() (byte, bool) {
+	s := p.top()
+	if s == nil {
+		return 0, false
+	}
+	c := s.text[s.pos]
+	s.pos++
+	if c == '\n' && s.isFile {
+		s.line++
+	}
+	return c, true
+}
+
+// lookingAt returns whether the input continues with delim.
+func (p *Processor) lookingAt(delim string) bool {
+	if delim == "" {
+		return false
+	}
+	s := p.top()
+	return s != nil && bytes.HasPrefix(s.text[s.pos:], []byte(delim))
+}
+
+func (p *Processor) skip(n int) {
+	for i := 0; i < n; i++ {
+		p.readByte()
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenComment
+	tokenOther
+)
+
+type token struct {
+	kind tokenKind
+	// text of the token. Strings don't include the outer quotes.
+	text string
+	file string
+	line int
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func (p *Processor) next() (token, error) {
+	s := p.top()
+	if s == nil {
+		return token{kind: tokenEOF}, nil
+	}
+	file, line := s.file, s.line
+	switch {
+	case p.lookingAt(p.lquote):
+		p.skip(len(p.lquote))
+		var sb strings.Builder
+		depth := 1
+		for {
+			switch {
+			case p.lookingAt(p.rquote):
+				p.skip(len(p.rquote))
+				depth--
+				if depth == 0 {
+					return token{kind: tokenString, text: sb.String(), file: file, line: line}, nil
+				}
+				sb.WriteString(p.rquote)
+			case p.lookingAt(p.lquote):
+				p.skip(len(p.lquote))
+				depth++
+				sb.WriteString(p.lquote)
+			default:
+				c, ok := p.readByte()
+				if !ok {
+					return token{}, fmt.Errorf("%s:%d: end of file in string", file, line)
+				}
+				sb.WriteByte(c)
+			}
+		}
+	case p.lookingAt(p.bcomm):
+		p.skip(len(p.bcomm))
+		var sb strings.Builder
+		sb.WriteString(p.bcomm)
+		for {
+			if p.lookingAt(p.ecomm) {
+				p.skip(len(p.ecomm))
+				sb.WriteString(p.ecomm)
+				break
+			}
+			c, ok := p.readByte()
+			if !ok {
+				break
+			}
+			sb.WriteByte(c)
+		}
+		return token{kind: tokenComment, text: sb.String(), file: file, line: line}, nil
+	case isNameStart(s.text[s.pos]):
+		start := s.pos
+		for s.pos < len(s.text) && isNameChar(s.text[s.pos]) {
+			s.pos++
+		}
+		return token{kind: tokenName, text: string(s.text[start:s.pos]), file: file, line: line}, nil
+	}
+	c, _ := p.readByte()
+	return token{kind: tokenOther, text: string(c), file: file, line: line}, nil
+}
+
+// expandToken expands a single token. The result is written to obs while collecting macro
+// arguments, or to the output otherwise.
+func (p *Processor) expandToken(tok token, obs *strings.Builder) error {
+	if tok.kind == tokenName {
+		if m := p.lookup(tok.text); m != nil {
+			if c, ok := p.peekByte(); ok && c == '(' {
+				args, err := p.collectArgs(tok)
+				if err != nil {
+					return err
+				}
+				return p.call(m, tok, args)
+			}
+			if m.builtin == nil || !m.builtin.blind {
+				return p.call(m, tok, nil)
+			}
+		} else if p.WarnUndefined {
+			if c, ok := p.peekByte(); ok && c == '(' {
+				p.warnf(tok.file, tok.line, "undefined macro %q", tok.text)
+			}
+		}
+	}
+	p.shipout(tok.text, tok.file, tok.line, obs)
+	return nil
+}
+
+// collectArgs reads the arguments of a macro call. The opening parenthesis hasn't been read yet.
+// Arguments are macro expanded while they are read, and lose one level of quotes.
+func (p *Processor) collectArgs(call token) ([]string, error) {
+	p.readByte() // '('
+	var args []string
+	var cur strings.Builder
+	depth := 0
+	skipSpace := true
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case tokenEOF:
+			return nil, fmt.Errorf("%s:%d: end of file in argument list of %q", call.file, call.line, call.text)
+		case tokenOther:
+			if skipSpace && isSpace(tok.text[0]) {
+				continue
+			}
+			skipSpace = false
+			switch {
+			case tok.text == "(":
+				depth++
+			case tok.text == ")" && depth == 0:
+				return append(args, cur.String()), nil
+			case tok.text == ")":
+				depth--
+			case tok.text == "," && depth == 0:
+				args = append(args, cur.String())
+				cur.Reset()
+				skipSpace = true
+				continue
+			}
+			cur.WriteString(tok.text)
+		case tokenName:
+			skipSpace = false
+			if err := p.expandToken(tok, &cur); err != nil {
+				return nil, err
+			}
+		default:
+			skipSpace = false
+			cur.WriteString(tok.text)
+		}
+	}
+}
+
+// call expands a macro and pushes the expansion back onto the input, to be rescanned.
+func (p *Processor) call(m *macroDef, tok token, args []string) error {
+	var result string
+	if m.builtin != nil {
+		if len(args) < m.builtin.minArgs {
+			p.warnf(tok.file, tok.line, "too few arguments to builtin %q", m.Name)
+			return nil
+		}
+		var err error
+		result, err = m.builtin.fn(p, tok, args)
+		if err != nil {
+			return err
+		}
+	} else {
+		result = p.substitute(m.Value, tok.text, args)
+	}
+	if result == "" {
+		return nil
+	}
+	return p.push(&source{text: []byte(result), file: tok.file, line: tok.line})
+}
+
+// substitute replaces $0-$N, $#, $* and $@ in the body of a user macro.
+func (p *Processor) substitute(body, name string, args []string) string {
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '$' || i+1 == len(body) {
+			sb.WriteByte(c)
+			continue
+		}
+		switch n := body[i+1]; {
+		case n >= '0' && n <= '9':
+			j := i + 1
+			idx := 0
+			for j < len(body) && body[j] >= '0' && body[j] <= '9' {
+				idx = idx*10 + int(body[j]-'0')
+				j++
+			}
+			if idx == 0 {
+				sb.WriteString(name)
+			} else if idx <= len(args) {
+				sb.WriteString(args[idx-1])
+			}
+			i = j - 1
+		case n == '#':
+			fmt.Fprintf(&sb, "%d", len(args))
+			i++
+		case n == '*':
+			sb.WriteString(strings.Join(args, ","))
+			i++
+		case n == '@':
+			sb.WriteString(p.quoteArgs(args))
+			i++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// quoteArgs joins args with commas, quoting each of them.
+func (p *Processor) quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = p.lquote + a + p.rquote
+	}
+	return strings.Join(quoted, ",")
+}
+
+// shipout writes text to obs, or to the current diversion if obs is nil. file and line give the
+// input location of the text, for sync lines.
+func (p *Processor) shipout(text, file string, line int, obs *strings.Builder) {
+	if obs != nil {
+		obs.WriteString(text)
+		return
+	}
+	if p.diversion < 0 {
+		return
+	}
+	if p.diversion > 0 {
+		buf := p.diversions[p.diversion]
+		if buf == nil {
+			buf = &bytes.Buffer{}
+			p.diversions[p.diversion] = buf
+		}
+		buf.WriteString(text)
+		return
+	}
+	if !p.SyncLines {
+		io.WriteString(p.out, text)
+		return
+	}
+	for len(text) > 0 {
+		if p.startOfLine {
+			p.startOfLine = false
+			p.outLine++
+			if p.outFile != file {
+				fmt.Fprintf(p.out, "#line %d \"%s\"\n", line, file)
+				p.outFile = file
+				p.outLine = line
+			} else if p.outLine != line {
+				fmt.Fprintf(p.out, "#line %d\n", line)
+				p.outLine = line
+			}
+		}
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			io.WriteString(p.out, text)
+			return
+		}
+		io.WriteString(p.out, text[:i+1])
+		text = text[i+1:]
+		p.startOfLine = true
+	}
+}
+
+// undivertAll writes every positive diversion to the current output, in numerical order.
+func (p *Processor) undivertAll() error {
+	var nums []int
+	for n := range p.diversions {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		if err := p.undivert(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) undivert(n int) error {
+	buf := p.diversions[n]
+	if buf == nil || n == p.diversion {
+		return nil
+	}
+	delete(p.diversions, n)
+	switch {
+	case p.diversion < 0:
+		return nil
+	case p.diversion > 0:
+		p.shipout(buf.String(), "", 0, nil)
+		return nil
+	}
+	// Diverted text has no sync lines; force one at the next line of regular output.
+	p.outFile = ""
+	p.startOfLine = bytes.HasSuffix(buf.Bytes(), []byte("\n")) || p.startOfLine && buf.Len() == 0
+	_, err := p.out.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,229 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package m4
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func expand(t *testing.T, p *Processor, input string) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := p.Process(strings.NewReader(input), "test.te", &sb); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Finish(&sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestExpand(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "define",
+			input:    "define(`foo', `bar $1 $2')foo(a, b) foo",
+			expected: "bar a b bar  ",
+		},
+		{
+			name:     "quotes",
+			input:    "define(`foo', `x')`foo' ``foo'' foo",
+			expected: "foo `foo' x",
+		},
+		{
+			name:     "comments",
+			input:    "define(`foo', `x')# foo(1)\nfoo\n",
+			expected: "# foo(1)\nx\n",
+		},
+		{
+			name:     "special args",
+			input:    "define(`foo', `$# [$*] [$@] `$0'')foo(a,`b,c')",
+			expected: "2 [a,b,c] [a,b,c] foo",
+		},
+		{
+			name:     "shift",
+			input:    "define(`first', `$1')define(`second', `first(shift($@))')second(a, b, c)",
+			expected: "b",
+		},
+		{
+			name:     "ifelse",
+			input:    "ifelse(a, b, yes, no) ifelse(a, a, yes, no) ifelse(a, b, 1, c, c, 2, 3) ifelse(`comment')",
+			expected: "no yes 2 ",
+		},
+		{
+			name:     "ifdef",
+			input:    "define(`foo')ifdef(`foo', yes, no) ifdef(`bar', yes, no)",
+			expected: "yes no",
+		},
+		{
+			name:     "dnl",
+			input:    "a dnl this is removed\nb\n",
+			expected: "a b\n",
+		},
+		{
+			name:     "divert",
+			input:    "divert(-1)\ndefine(`foo', `x')\ndivert(0)dnl\nfoo\ndivert(1)later\ndivert(0)first\n",
+			expected: "x\nfirst\nlater\n",
+		},
+		{
+			name:     "changequote",
+			input:    "changequote([, ])define([foo], [x])[foo] foo changequote`foo'",
+			expected: "foo x foo",
+		},
+		{
+			name:     "arithmetic",
+			input:    "incr(1) decr(1) eval(2 ** 3 + 4 * (1 << 2)) eval(202404 >= 202404) eval(1 < 0 || !0)",
+			expected: "2 0 24 1 1",
+		},
+		{
+			name:     "strings",
+			input:    "len(`abc') index(`abc', `c') substr(`abcdef', 1, 3) translit(`abc', `a-c', `A-C')",
+			expected: "3 2 bcd ABC",
+		},
+		{
+			name:     "blind builtins",
+			input:    "define is a word, so is ifelse",
+			expected: "define is a word, so is ifelse",
+		},
+		{
+			name: "recursion",
+			input: "define(`decl_cats',`dnl\n" +
+				"category c$1;\n" +
+				"ifelse(`$1',`$2',,`decl_cats(incr($1),$2)')dnl\n" +
+				"')decl_cats(0,2)",
+			expected: "category c0;\ncategory c1;\ncategory c2;\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		p := New()
+		if actual := expand(t, p, tc.input); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+		if len(p.Warnings()) > 0 {
+			t.Errorf("%s: unexpected warnings %v", tc.name, p.Warnings())
+		}
+	}
+}
+
+func TestDefine(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	p.Define("target_build_variant", "user")
+	p.Define("target_flag_FOO", "true")
+	input := "define(`is_flag_enabled', `ifelse(target_flag_$1, `true', `$2')')\n" +
+		"ifelse(target_build_variant, `user', `user build')\n" +
+		"is_flag_enabled(FOO, `allow a b:file read;')\n"
+	expected := "\nuser build\nallow a b:file read;\n"
+	if actual := expand(t, p, input); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	macros := make(map[string]Macro)
+	for _, m := range p.Macros() {
+		macros[m.Name] = m
+	}
+	if m := macros["target_build_variant"]; m.Value != "user" || m.File != "" {
+		t.Errorf("unexpected macro %+v", m)
+	}
+	if m := macros["is_flag_enabled"]; m.File != "test.te" || m.Line != 1 {
+		t.Errorf("expected is_flag_enabled to be defined at test.te:1, got %+v", m)
+	}
+	if m := macros["define"]; !m.Builtin {
+		t.Errorf("expected define to be a builtin, got %+v", m)
+	}
+}
+
+func TestSyncLines(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	p.SyncLines = true
+	input := "define(`two_lines', `first\nsecond')dnl\n" +
+		"a\n" +
+		"two_lines\n" +
+		"b\n"
+	expected := "#line 3 \"test.te\"\n" +
+		"a\n" +
+		"first\n" +
+		"#line 4\n" +
+		"second\n" +
+		"b\n"
+	if actual := expand(t, p, input); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	included := filepath.Join(dir, "macros")
+	if err := os.WriteFile(included, []byte("define(`foo', `x')dnl\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := New()
+	if actual := expand(t, p, "include(`"+included+"')foo sinclude(`missing')\n"); actual != "x \n" {
+		t.Errorf("expected %q, got %q", "x \n", actual)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	p.WarnUndefined = true
+	expand(t, p, "define(`foo', `x')\nfoo(1)\n# bar(1) in a comment\n`bar(1)' quoted\nbar(1)\nifelse(a)")
+	var warnings []string
+	for _, w := range p.Warnings() {
+		warnings = append(warnings, w.String())
+	}
+	expected := []string{`test.te:5: warning: undefined macro "bar"`}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings %q, got %q", expected, warnings)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"unterminated string", "`foo"},
+		{"unterminated arguments", "define(`foo', `x')foo(a, b"},
+		{"infinite recursion", "define(`foo', `foo x')foo"},
+		{"missing include", "include(`/nonexistent/file')"},
+		{"divide by zero", "eval(1 / (2 - 2))"},
+		{"modulo by zero", "eval(1 % 0)"},
+	}
+	for _, tc := range testCases {
+		var sb strings.Builder
+		if err := New().Process(strings.NewReader(tc.input), "test.te", &sb); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
@@ -96,9 +96,10 @@ func (m *macPermissionsModule) GenerateAndroidBuildActions(ctx android.ModuleCon
 	m4Keys := android.PathForModuleGen(ctx, "mac_perms_keys.tmp")
 	rule := android.NewRuleBuilder(pctx, ctx)
 	rule.Command().
-		Tool(ctx.Config().PrebuiltBuildTool(ctx, "m4")).
-		Text("--fatal-warnings -s").
-		FlagForEachArg("-D", ctx.DeviceConfig().SepolicyM4Defs()).
+		BuiltTool("sepolicy_m4").
+		Flag("--fatal-warnings").
+		Flag("-s").
+		FlagForEachArg("-D ", ctx.DeviceConfig().SepolicyM4Defs()).
 		Inputs(keys).
 		FlagWithOutput("> ", m4Keys).
 		Implicits(platformKeys)
@@ -0,0 +1,125 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selinux
+
+import (
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func init() {
+	android.RegisterModuleType("se_merged_contexts", mergedContextsFactory)
+}
+
+type mergedContextsProperties struct {
+	// Type of the contexts files, e.g. "file_contexts" or "seapp_contexts".
+	Type *string
+
+	// Contexts files of the system, system_ext and product partitions, in the order the device
+	// loads them, e.g. [":plat_file_contexts", ":system_ext_file_contexts"]. Entries are annotated
+	// with the base name of their file, so base names must be unique.
+	Srcs []string `android:"path"`
+
+	// Contexts files of the vendor and odm partitions, loaded after srcs. seapp_contexts entries
+	// of these files have lower precedence than the ones of srcs.
+	Vendor_srcs []string `android:"path"`
+}
+
+type mergedContexts struct {
+	android.ModuleBase
+
+	properties mergedContextsProperties
+}
+
+// se_merged_contexts shows the contexts files of every partition as the device combines them: the
+// entries of every file, in the order the device uses them, each annotated with its file and
+// line. This is the output of the module. Entries of different files labeling the same thing are
+// reported as duplicates, or conflicts if they give different labels, in the ".report" output.
+// The module is only for debugging, and isn't installed.
+func mergedContextsFactory() android.Module {
+	m := &mergedContexts{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
+	return m
+}
+
+func (m *mergedContexts) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if proptools.String(m.properties.Type) == "" {
+		ctx.PropertyErrorf("type", "must be specified")
+	}
+	if len(m.properties.Srcs)+len(m.properties.Vendor_srcs) == 0 {
+		ctx.PropertyErrorf("srcs", "either srcs or vendor_srcs must be specified")
+	}
+	if ctx.Failed() {
+		return
+	}
+
+	merged := pathForModuleOut(ctx, ctx.ModuleName())
+	report := pathForModuleOut(ctx, ctx.ModuleName()+"_report.txt")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("merged_contexts").
+		FlagWithArg("-type ", proptools.String(m.properties.Type)).
+		FlagForEachInput("-i ", android.PathsForModuleSrc(ctx, m.properties.Srcs)).
+		FlagForEachInput("-vendor ", android.PathsForModuleSrc(ctx, m.properties.Vendor_srcs)).
+		FlagWithOutput("-o ", merged).
+		FlagWithOutput("-report ", report)
+	rule.Build("merged_contexts", "Merging "+proptools.String(m.properties.Type)+": "+ctx.ModuleName())
+
+	ctx.SetOutputFiles(android.Paths{merged}, "")
+	ctx.SetOutputFiles(android.Paths{report}, ".report")
+}
+
+// mergedContexts implements ImageInterface to be able to include recovery_available contexts
+// modules as its sources.
+func (m *mergedContexts) ImageMutatorBegin(ctx android.BaseModuleContext) {
+}
+
+func (m *mergedContexts) VendorVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) ProductVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) CoreVariantNeeded(ctx android.BaseModuleContext) bool {
+	return true
+}
+
+func (m *mergedContexts) RamdiskVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) VendorRamdiskVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) DebugRamdiskVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) RecoveryVariantNeeded(ctx android.BaseModuleContext) bool {
+	return false
+}
+
+func (m *mergedContexts) ExtraImageVariations(ctx android.BaseModuleContext) []string {
+	return nil
+}
+
+func (m *mergedContexts) SetImageVariation(ctx android.BaseModuleContext, variation string) {
+}
+
+var _ android.ImageInterface = (*mergedContexts)(nil)
@@ -0,0 +1,152 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neverallow
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"android/soong/selinux/cil"
+)
+
+// cacheVersion is part of every key, so that changing how keys are computed invalidates caches.
+const cacheVersion = "1"
+
+// sortedTypes returns the types of set, restricted to those in any of filter if given, sorted and
+// joined with spaces.
+func sortedTypes(set map[string]bool, filter ...map[string]bool) string {
+	var ret []string
+	for t := range set {
+		for _, f := range filter {
+			if f[t] {
+				ret = append(ret, t)
+				break
+			}
+		}
+		if filter == nil {
+			ret = append(ret, t)
+		}
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, " ")
+}
+
+// Keys returns for each assertion a hash of everything the result of checking it depends on: its
+// text, the types of its source and target sets, and the allow and allowx rules of p overlapping
+// with it, along with their types in those sets. Rules which don't overlap with an assertion can't
+// violate it, so an assertion whose key hasn't changed has the same result. The key of an
+// assertion which can't be parsed is empty.
+func Keys(assertions []Assertion, p *cil.Policy) []string {
+	type avRule struct {
+		source, target string
+		node           *cil.Node
+	}
+	var rules []avRule
+	for _, r := range p.AvRules {
+		if r.Kind == "allow" {
+			rules = append(rules, avRule{r.Source, r.Target, r.Node})
+		}
+	}
+	for _, r := range p.AvRuleXs {
+		if r.Kind == "allowx" {
+			rules = append(rules, avRule{r.Source, r.Target, r.Node})
+		}
+	}
+
+	res := newResolver(p)
+	ret := make([]string, len(assertions))
+	for i, a := range assertions {
+		rule, err := ParseRule(a.Text)
+		if err != nil {
+			continue
+		}
+		res.unresolved = make(map[string]bool)
+		m := res.newMatcher(rule)
+
+		// The order of rules in a compiled policy isn't meaningful.
+		var lines []string
+		for _, r := range rules {
+			if !m.overlaps(r.source, r.target) {
+				continue
+			}
+			line := r.node.String() + " | " + sortedTypes(res.expand(r.source), m.sources) + " | "
+			if r.target == "self" {
+				line += "self"
+			} else if rule.Self {
+				line += sortedTypes(res.expand(r.target), m.targets, m.sources)
+			} else {
+				line += sortedTypes(res.expand(r.target), m.targets)
+			}
+			lines = append(lines, line)
+		}
+		sort.Strings(lines)
+
+		h := sha256.New()
+		for _, s := range append([]string{cacheVersion, a.Text, sortedTypes(m.sources), sortedTypes(m.targets)}, lines...) {
+			io.WriteString(h, s)
+			h.Write([]byte{0})
+		}
+		ret[i] = hex.EncodeToString(h.Sum(nil))
+	}
+	return ret
+}
+
+// ReadCache reads the keys of a cache of assertions known to pass, one per line.
+func ReadCache(r io.Reader) (map[string]bool, error) {
+	ret := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			ret[key] = true
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// ReadCacheFile reads a cache with ReadCache. A missing file is an empty cache, e.g. on the first
+// build.
+func ReadCacheFile(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]bool), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCache(f)
+}
+
+// WriteCache writes the keys of assertions known to pass, sorted and one per line.
+func WriteCache(w io.Writer, keys []string) error {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	var sb strings.Builder
+	for i, key := range sorted {
+		if key == "" || (i > 0 && key == sorted[i-1]) {
+			continue
+		}
+		sb.WriteString(key)
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,463 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neverallow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"android/soong/selinux/cil"
+)
+
+// TypeSet is a set of types in policy.conf syntax, e.g. "{ domain -init }", "~appdomain" or "*".
+type TypeSet struct {
+	Names    []string
+	Excludes []string
+
+	// All is true for "*", or for a set including "*".
+	All bool
+
+	// Complement is true for "~set".
+	Complement bool
+}
+
+// Rule is a parsed neverallow or neverallowxperm assertion.
+type Rule struct {
+	Sources TypeSet
+	Targets TypeSet
+
+	// Self is true if the targets include "self".
+	Self bool
+
+	// Classes are the object classes of the assertion, or nil for every class.
+	Classes []string
+}
+
+// tokenize splits a policy.conf statement into names and punctuation. A leading "-" is split from
+// the name it excludes.
+func tokenize(text string) []string {
+	var ret []string
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case isSpace(c) || c == ',':
+		case c != '-' && isWordChar(c):
+			end := i
+			for end < len(text) && isWordChar(text[end]) {
+				end++
+			}
+			ret = append(ret, text[i:end])
+			i = end - 1
+		default:
+			ret = append(ret, string(c))
+		}
+	}
+	return ret
+}
+
+// ParseRule parses the text of a neverallow or neverallowxperm assertion.
+func ParseRule(text string) (*Rule, error) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 || !keywords[tokens[0]] {
+		return nil, fmt.Errorf("not a neverallow assertion: %q", text)
+	}
+	pos := 1
+	sources, err := parseSet(tokens, &pos)
+	if err != nil {
+		return nil, fmt.Errorf("source of %q: %w", text, err)
+	}
+	targets, err := parseSet(tokens, &pos)
+	if err != nil {
+		return nil, fmt.Errorf("target of %q: %w", text, err)
+	}
+	if pos >= len(tokens) || tokens[pos] != ":" {
+		return nil, fmt.Errorf("expected ':' after the target of %q", text)
+	}
+	pos++
+	classes, err := parseSet(tokens, &pos)
+	if err != nil {
+		return nil, fmt.Errorf("class of %q: %w", text, err)
+	}
+
+	r := &Rule{Sources: sources, Targets: targets}
+	var names []string
+	for _, name := range targets.Names {
+		if name == "self" {
+			r.Self = true
+		} else {
+			names = append(names, name)
+		}
+	}
+	r.Targets.Names = names
+	if !classes.All && !classes.Complement && len(classes.Excludes) == 0 {
+		r.Classes = classes.Names
+	}
+	return r, nil
+}
+
+// parseSet parses a set of names starting at tokens[*pos].
+func parseSet(tokens []string, pos *int) (TypeSet, error) {
+	var s TypeSet
+	if *pos >= len(tokens) {
+		return s, fmt.Errorf("unexpected end")
+	}
+	switch tok := tokens[*pos]; tok {
+	case "~":
+		*pos++
+		inner, err := parseSet(tokens, pos)
+		if err != nil {
+			return s, err
+		}
+		inner.Complement = !inner.Complement
+		return inner, nil
+	case "*":
+		*pos++
+		s.All = true
+		return s, nil
+	case "{":
+		*pos++
+		for ; *pos < len(tokens) && tokens[*pos] != "}"; *pos++ {
+			switch tok := tokens[*pos]; {
+			case tok == "*":
+				s.All = true
+			case tok == "-":
+				*pos++
+				if *pos >= len(tokens) || !isWordChar(tokens[*pos][0]) {
+					return s, fmt.Errorf("expected a name after '-'")
+				}
+				s.Excludes = append(s.Excludes, tokens[*pos])
+			case isWordChar(tok[0]):
+				s.Names = append(s.Names, tok)
+			default:
+				return s, fmt.Errorf("unexpected %q", tok)
+			}
+		}
+		if *pos >= len(tokens) {
+			return s, fmt.Errorf("missing '}'")
+		}
+		*pos++
+		return s, nil
+	default:
+		if !isWordChar(tok[0]) {
+			return s, fmt.Errorf("unexpected %q", tok)
+		}
+		*pos++
+		s.Names = []string{tok}
+		return s, nil
+	}
+}
+
+// Coverage statuses.
+const (
+	// Vacuous assertions overlap with no allow rule on source and target types; they constrain
+	// nothing in the policy.
+	Vacuous = "vacuous"
+
+	// Meaningful assertions overlap with at least one allow rule on source and target types.
+	Meaningful = "meaningful"
+
+	// Unknown assertions couldn't be parsed.
+	Unknown = "unknown"
+)
+
+// Coverage is whether a neverallow assertion constrains any allow rule of a policy.
+type Coverage struct {
+	Assertion
+	Status string `json:"status"`
+
+	// Overlapping is the number of allow rules whose source and target types overlap with those
+	// of the assertion, and SameClass the number of those which also share an object class.
+	Overlapping int `json:"overlapping"`
+	SameClass   int `json:"same_class"`
+
+	// Example is an overlapping allow rule, preferably one with the same class.
+	Example string `json:"example,omitempty"`
+
+	// Unresolved are the names of the assertion which aren't declared in the policy.
+	Unresolved []string `json:"unresolved,omitempty"`
+
+	// Error is why the assertion couldn't be parsed.
+	Error string `json:"error,omitempty"`
+}
+
+// resolver expands the type sets of assertions in a policy.
+type resolver struct {
+	policy     *cil.Policy
+	types      map[string]bool
+	expanded   map[string]map[string]bool
+	unresolved map[string]bool
+}
+
+func newResolver(p *cil.Policy) *resolver {
+	types := make(map[string]bool)
+	for _, t := range p.Types {
+		types[t.Name] = true
+	}
+	return &resolver{policy: p, types: types, expanded: make(map[string]map[string]bool)}
+}
+
+// expand returns the types a name of the policy stands for.
+func (r *resolver) expand(name string) map[string]bool {
+	if ret, ok := r.expanded[name]; ok {
+		return ret
+	}
+	ret := make(map[string]bool)
+	if r.policy.IsAttribute(name) {
+		for _, t := range r.policy.ExpandType(name) {
+			ret[t] = true
+		}
+	} else if r.types[name] {
+		ret[name] = true
+	}
+	r.expanded[name] = ret
+	return ret
+}
+
+// expandName is expand for names of assertions, recording names missing from the policy.
+func (r *resolver) expandName(name string) map[string]bool {
+	if !r.types[name] && !r.policy.IsAttribute(name) {
+		r.unresolved[name] = true
+	}
+	return r.expand(name)
+}
+
+func (r *resolver) expandSet(s TypeSet) map[string]bool {
+	ret := make(map[string]bool)
+	if s.All {
+		for t := range r.types {
+			ret[t] = true
+		}
+	}
+	for _, name := range s.Names {
+		for t := range r.expandName(name) {
+			ret[t] = true
+		}
+	}
+	for _, name := range s.Excludes {
+		for t := range r.expandName(name) {
+			delete(ret, t)
+		}
+	}
+	if s.Complement {
+		complement := make(map[string]bool)
+		for t := range r.types {
+			if !ret[t] {
+				complement[t] = true
+			}
+		}
+		ret = complement
+	}
+	return ret
+}
+
+func intersects(a, b map[string]bool) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	for t := range a {
+		if b[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// matcher finds the rules of a policy whose source and target types overlap with those of an
+// assertion.
+type matcher struct {
+	res              *resolver
+	rule             *Rule
+	sources, targets map[string]bool
+
+	// Whether the types a name of a rule stands for overlap with the sources or targets,
+	// memoized per name.
+	sourceHit, targetHit map[string]bool
+}
+
+// newMatcher expands the source and target sets of rule. Names missing from the policy are added
+// to r.unresolved.
+func (r *resolver) newMatcher(rule *Rule) *matcher {
+	return &matcher{
+		res:       r,
+		rule:      rule,
+		sources:   r.expandSet(rule.Sources),
+		targets:   r.expandSet(rule.Targets),
+		sourceHit: make(map[string]bool),
+		targetHit: make(map[string]bool),
+	}
+}
+
+func (m *matcher) hit(memo map[string]bool, set map[string]bool, name string) bool {
+	ret, ok := memo[name]
+	if !ok {
+		ret = intersects(m.res.expand(name), set)
+		memo[name] = ret
+	}
+	return ret
+}
+
+// overlaps returns whether a rule from source to target overlaps with the assertion.
+func (m *matcher) overlaps(source, target string) bool {
+	if !m.hit(m.sourceHit, m.sources, source) {
+		return false
+	}
+	if target != "self" && m.hit(m.targetHit, m.targets, target) {
+		return true
+	}
+	if m.rule.Self {
+		if target == "self" {
+			return true
+		}
+		// A source type that is also a target of the rule.
+		ruleTargets := m.res.expand(target)
+		for t := range m.res.expand(source) {
+			if m.sources[t] && ruleTargets[t] {
+				return true
+			}
+		}
+	} else if target == "self" {
+		// The rule grants each source type access to itself.
+		for t := range m.res.expand(source) {
+			if m.sources[t] && m.targets[t] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func allowRules(p *cil.Policy) []*cil.AvRule {
+	var ret []*cil.AvRule
+	for _, rule := range p.AvRules {
+		if rule.Kind == "allow" {
+			ret = append(ret, rule)
+		}
+	}
+	return ret
+}
+
+// ComputeCoverage returns the coverage of each assertion by the allow rules of p, in the order of
+// assertions. Attributes of assertions and allow rules are expanded to their member types.
+func ComputeCoverage(assertions []Assertion, p *cil.Policy) []Coverage {
+	allows := allowRules(p)
+	res := newResolver(p)
+	ret := make([]Coverage, 0, len(assertions))
+	for _, a := range assertions {
+		c := Coverage{Assertion: a}
+		rule, err := ParseRule(a.Text)
+		if err != nil {
+			c.Status = Unknown
+			c.Error = err.Error()
+			ret = append(ret, c)
+			continue
+		}
+
+		res.unresolved = make(map[string]bool)
+		m := res.newMatcher(rule)
+		classes := make(map[string]bool)
+		for _, class := range rule.Classes {
+			classes[class] = true
+		}
+
+		var example, sameClassExample *cil.AvRule
+		for _, allow := range allows {
+			if !m.overlaps(allow.Source, allow.Target) {
+				continue
+			}
+			c.Overlapping++
+			if example == nil {
+				example = allow
+			}
+			if rule.Classes == nil || classes[allow.Class()] {
+				c.SameClass++
+				if sameClassExample == nil {
+					sameClassExample = allow
+				}
+			}
+		}
+
+		c.Status = Vacuous
+		if c.Overlapping > 0 {
+			c.Status = Meaningful
+			if sameClassExample != nil {
+				example = sameClassExample
+			}
+			c.Example = example.Node.String()
+		}
+		for name := range res.unresolved {
+			c.Unresolved = append(c.Unresolved, name)
+		}
+		sort.Strings(c.Unresolved)
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+func (c Coverage) location() string {
+	if c.File == "" {
+		return fmt.Sprintf("policy.conf:%d", c.Line)
+	}
+	return fmt.Sprintf("%s:%d", c.File, c.SourceLine)
+}
+
+// WriteCoverageReport writes coverage as a text report: a summary, then the assertions of each
+// status.
+func WriteCoverageReport(w io.Writer, coverage []Coverage) error {
+	byStatus := make(map[string][]Coverage)
+	for _, c := range coverage {
+		byStatus[c.Status] = append(byStatus[c.Status], c)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d neverallow assertions: %d vacuous, %d meaningful, %d unknown\n",
+		len(coverage), len(byStatus[Vacuous]), len(byStatus[Meaningful]), len(byStatus[Unknown]))
+	for _, status := range []string{Vacuous, Meaningful, Unknown} {
+		if len(byStatus[status]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:\n", status)
+		for _, c := range byStatus[status] {
+			fmt.Fprintf(&sb, "  %s: %s\n", c.location(), c.Text)
+			switch status {
+			case Meaningful:
+				fmt.Fprintf(&sb, "    %d overlapping allow rules, %d with the same class, e.g. %s\n",
+					c.Overlapping, c.SameClass, c.Example)
+			case Unknown:
+				fmt.Fprintf(&sb, "    %s\n", c.Error)
+			}
+			if len(c.Unresolved) > 0 {
+				fmt.Fprintf(&sb, "    not in the policy: %s\n", strings.Join(c.Unresolved, " "))
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteCoverageJSON writes coverage as a JSON array.
+func WriteCoverageJSON(w io.Writer, coverage []Coverage) error {
+	if coverage == nil {
+		coverage = []Coverage{}
+	}
+	data, err := json.MarshalIndent(coverage, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
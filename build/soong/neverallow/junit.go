@@ -0,0 +1,99 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neverallow
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// TestResult is the result of testing a group of assertions.
+type TestResult struct {
+	Name string
+
+	// Failure is the output of the failed test, or empty if the test passed.
+	Failure string
+
+	// Skipped is true if the test failed, but the failure doesn't fail the build.
+	Skipped bool
+
+	Duration time.Duration
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes results as a JUnit XML report with a single test suite.
+func WriteJUnit(w io.Writer, suite string, results []TestResult) error {
+	s := junitTestSuite{Name: suite, Tests: len(results)}
+	var total time.Duration
+	for _, r := range results {
+		c := junitTestCase{ClassName: suite, Name: r.Name, Time: seconds(r.Duration)}
+		if r.Failure != "" {
+			msg := &junitMessage{Message: "neverallow violations in " + r.Name, Output: r.Failure}
+			if r.Skipped {
+				c.Skipped = msg
+				s.Skipped++
+			} else {
+				c.Failure = msg
+				s.Failures++
+			}
+		}
+		s.Cases = append(s.Cases, c)
+		total += r.Duration
+	}
+	s.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{s}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,202 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package neverallow extracts neverallow assertions from policy.conf files and splits them into
+// groups that can be tested separately.
+package neverallow
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"android/soong/selinux/srcmap"
+)
+
+// Assertion is a neverallow or neverallowxperm statement of a policy.conf file.
+type Assertion struct {
+	// Text is the statement with whitespace collapsed, e.g. "neverallow a b:file write;".
+	Text string `json:"text"`
+
+	// Line is the line of the policy.conf file on which the statement starts.
+	Line int `json:"line"`
+
+	// File and SourceLine are the location of the statement in the policy source files, if
+	// known.
+	File       string `json:"file,omitempty"`
+	SourceLine int    `json:"source_line,omitempty"`
+}
+
+var keywords = map[string]bool{
+	"neverallow":      true,
+	"neverallowxperm": true,
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == '$' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Extract returns the neverallow assertions of a policy.conf file in order. If m isn't nil, the
+// source locations of the assertions are looked up in m.
+func Extract(r io.Reader, m *srcmap.Map) ([]Assertion, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Assertion
+	line := 1
+	// Statements start after ';', '{' or '}', or at the beginning of the file.
+	atStatementStart := true
+	var current *strings.Builder
+	start := 0
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '#':
+			// Comments, including m4 sync lines, run to the end of the line.
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+			continue
+		case c == '\n':
+			line++
+		}
+
+		if current != nil {
+			current.WriteByte(c)
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			case ';':
+				if depth == 0 {
+					a := Assertion{Text: strings.Join(strings.Fields(current.String()), " "), Line: start}
+					if m != nil {
+						if loc, ok := m.Lookup(start); ok {
+							a.File, a.SourceLine = loc.File, loc.Line
+						}
+					}
+					ret = append(ret, a)
+					current = nil
+					atStatementStart = true
+				}
+			}
+			continue
+		}
+
+		if isWordChar(c) {
+			end := i
+			for end < len(data) && isWordChar(data[end]) {
+				end++
+			}
+			word := string(data[i:end])
+			if atStatementStart && keywords[word] {
+				current = &strings.Builder{}
+				current.WriteString(word)
+				start = line
+				depth = 0
+			}
+			atStatementStart = false
+			i = end - 1
+			continue
+		}
+		if !isSpace(c) {
+			atStatementStart = c == ';' || c == '{' || c == '}'
+		}
+	}
+	return ret, nil
+}
+
+// GroupSpec is a named group of assertions.
+type GroupSpec struct {
+	Name string
+
+	// Patterns are matched against the source files of assertions with path.Match. A pattern
+	// ending with "/" matches every file under the directory.
+	Patterns []string
+}
+
+// Matches returns whether file matches any pattern of the group.
+func (s GroupSpec) Matches(file string) bool {
+	for _, p := range s.Patterns {
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(file, p) {
+				return true
+			}
+		} else if matched, _ := path.Match(p, file); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Group is a set of assertions tested together.
+type Group struct {
+	Name       string
+	Assertions []Assertion
+}
+
+// UnknownGroup is the group of assertions whose source file isn't known.
+const UnknownGroup = "(unknown)"
+
+// GroupAssertions splits assertions into the groups of specs, in the order of specs. An assertion
+// matching no spec is grouped by its source file, and these groups follow in sorted order. The
+// first matching spec wins. Empty groups are omitted.
+func GroupAssertions(assertions []Assertion, specs []GroupSpec) []Group {
+	named := make([][]Assertion, len(specs))
+	byFile := make(map[string][]Assertion)
+	for _, a := range assertions {
+		matched := false
+		for i, s := range specs {
+			if a.File != "" && s.Matches(a.File) {
+				named[i] = append(named[i], a)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		file := a.File
+		if file == "" {
+			file = UnknownGroup
+		}
+		byFile[file] = append(byFile[file], a)
+	}
+
+	var ret []Group
+	for i, s := range specs {
+		if len(named[i]) > 0 {
+			ret = append(ret, Group{Name: s.Name, Assertions: named[i]})
+		}
+	}
+	var files []string
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		ret = append(ret, Group{Name: file, Assertions: byFile[file]})
+	}
+	return ret
+}
@@ -0,0 +1,385 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neverallow
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"android/soong/selinux/cil"
+	"android/soong/selinux/srcmap"
+)
+
+const conf = `#line 1 "system/sepolicy/public/app.te"
+allow appdomain self:process fork; neverallow appdomain
+  system_data_file:file { write
+  append };
+# neverallow in a comment;
+#line 10 "vendor/foo/sepolicy/foo.te"
+neverallowxperm foo bar:ioctl ioctl 0x1234;
+type neverallow_type;
+#line 3 "system/sepolicy/private/su.te"
+neverallow su self:capability sys_admin;
+`
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	m, err := srcmap.FromSyncLines(strings.NewReader(conf), "policy.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertions, err := Extract(strings.NewReader(conf), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Assertion{
+		{
+			Text:       "neverallow appdomain system_data_file:file { write append };",
+			Line:       2,
+			File:       "system/sepolicy/public/app.te",
+			SourceLine: 1,
+		},
+		{
+			Text:       "neverallowxperm foo bar:ioctl ioctl 0x1234;",
+			Line:       7,
+			File:       "vendor/foo/sepolicy/foo.te",
+			SourceLine: 10,
+		},
+		{
+			Text:       "neverallow su self:capability sys_admin;",
+			Line:       10,
+			File:       "system/sepolicy/private/su.te",
+			SourceLine: 3,
+		},
+	}
+	if !reflect.DeepEqual(assertions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, assertions)
+	}
+}
+
+func TestGroupAssertions(t *testing.T) {
+	t.Parallel()
+
+	assertions := []Assertion{
+		{Text: "a", File: "system/sepolicy/public/app.te"},
+		{Text: "b", File: "vendor/foo/sepolicy/foo.te"},
+		{Text: "c", File: "system/sepolicy/private/su.te"},
+		{Text: "d"},
+		{Text: "e", File: "system/sepolicy/public/app.te"},
+		{Text: "f", File: "vendor/bar/bar.te"},
+	}
+	specs := []GroupSpec{
+		{Name: "vendor", Patterns: []string{"vendor/"}},
+		{Name: "empty", Patterns: []string{"device/*/*.te"}},
+		{Name: "su", Patterns: []string{"*/*/private/su.te"}},
+	}
+	var actual []string
+	for _, g := range GroupAssertions(assertions, specs) {
+		var texts []string
+		for _, a := range g.Assertions {
+			texts = append(texts, a.Text)
+		}
+		actual = append(actual, g.Name+": "+strings.Join(texts, " "))
+	}
+	expected := []string{
+		"vendor: b f",
+		"su: c",
+		"(unknown): d",
+		"system/sepolicy/public/app.te: a e",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	err := WriteJUnit(&sb, "neverallow_test", []TestResult{
+		{Name: "app.te", Duration: 1500 * time.Millisecond},
+		{Name: "vendor", Failure: "violated by <allow>", Duration: time.Second},
+		{Name: "su.te", Failure: "violated", Skipped: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="neverallow_test" tests="3" failures="1" skipped="1" time="2.500">
+    <testcase classname="neverallow_test" name="app.te" time="1.500"></testcase>
+    <testcase classname="neverallow_test" name="vendor" time="1.000">
+      <failure message="neverallow violations in vendor">violated by &lt;allow&gt;</failure>
+    </testcase>
+    <testcase classname="neverallow_test" name="su.te" time="0.000">
+      <skipped message="neverallow violations in su.te">violated</skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if sb.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		text     string
+		expected Rule
+	}{
+		{
+			text: "neverallow { domain -init } self:capability { sys_admin };",
+			expected: Rule{
+				Sources: TypeSet{Names: []string{"domain"}, Excludes: []string{"init"}},
+				Self:    true,
+				Classes: []string{"capability"},
+			},
+		},
+		{
+			text: "neverallow ~appdomain { file_type -app_data_file }:{ file dir } *;",
+			expected: Rule{
+				Sources: TypeSet{Names: []string{"appdomain"}, Complement: true},
+				Targets: TypeSet{Names: []string{"file_type"}, Excludes: []string{"app_data_file"}},
+				Classes: []string{"file", "dir"},
+			},
+		},
+		{
+			text: "neverallowxperm * { foo self }:~{ chr_file } ioctl 0x1234;",
+			expected: Rule{
+				Sources: TypeSet{All: true},
+				Targets: TypeSet{Names: []string{"foo"}},
+				Self:    true,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		rule, err := ParseRule(tc.text)
+		if err != nil {
+			t.Errorf("%q: %s", tc.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(*rule, tc.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tc.text, tc.expected, *rule)
+		}
+	}
+
+	for _, text := range []string{
+		"allow a b:file read;",
+		"neverallow { a b:file read;",
+		"neverallow a b file read;",
+	} {
+		if _, err := ParseRule(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+const coveragePolicy = `
+(type init)
+(type app)
+(type untrusted_app)
+(type system_file)
+(type app_data_file)
+(typeattribute domain)
+(typeattributeset domain (init app untrusted_app))
+(typeattribute appdomain)
+(typeattributeset appdomain (app untrusted_app))
+(typeattribute file_type)
+(typeattributeset file_type (system_file app_data_file))
+(allow appdomain app_data_file (file (read write)))
+(allow init system_file (dir (search)))
+(allow untrusted_app self (process (fork)))
+`
+
+func TestComputeCoverage(t *testing.T) {
+	t.Parallel()
+
+	p, err := cil.Parse(strings.NewReader(coveragePolicy), "policy.cil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertions := []Assertion{
+		{Text: "neverallow appdomain system_file:file write;", File: "public/app.te", SourceLine: 3},
+		{Text: "neverallow { domain -init } file_type:file write;", File: "public/domain.te", SourceLine: 7},
+		{Text: "neverallow init file_type:file write;", File: "public/init.te", SourceLine: 1},
+		{Text: "neverallow appdomain self:process fork;", Line: 12},
+		{Text: "neverallow ~init app:process fork;", Line: 13},
+		{Text: "neverallow missing_attr file_type:file write;", Line: 14},
+		{Text: "neverallow appdomain;", Line: 15},
+	}
+	coverage := ComputeCoverage(assertions, p)
+
+	var actual []string
+	for _, c := range coverage {
+		s := fmt.Sprintf("%s %d/%d", c.Status, c.SameClass, c.Overlapping)
+		if c.Example != "" {
+			s += " " + c.Example
+		}
+		if len(c.Unresolved) > 0 {
+			s += " unresolved:" + strings.Join(c.Unresolved, ",")
+		}
+		actual = append(actual, s)
+	}
+	expected := []string{
+		"vacuous 0/0",
+		"meaningful 1/1 (allow appdomain app_data_file (file (read write)))",
+		"meaningful 0/1 (allow init system_file (dir (search)))",
+		"meaningful 1/1 (allow untrusted_app self (process (fork)))",
+		"vacuous 0/0",
+		"vacuous 0/0 unresolved:missing_attr",
+		"unknown 0/0",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	var sb strings.Builder
+	if err := WriteCoverageReport(&sb, coverage[:4]); err != nil {
+		t.Fatal(err)
+	}
+	expectedReport := `4 neverallow assertions: 1 vacuous, 3 meaningful, 0 unknown
+
+vacuous:
+  public/app.te:3: neverallow appdomain system_file:file write;
+
+meaningful:
+  public/domain.te:7: neverallow { domain -init } file_type:file write;
+    1 overlapping allow rules, 1 with the same class, e.g. (allow appdomain app_data_file (file (read write)))
+  public/init.te:1: neverallow init file_type:file write;
+    1 overlapping allow rules, 0 with the same class, e.g. (allow init system_file (dir (search)))
+  policy.conf:12: neverallow appdomain self:process fork;
+    1 overlapping allow rules, 1 with the same class, e.g. (allow untrusted_app self (process (fork)))
+`
+	if sb.String() != expectedReport {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedReport, sb.String())
+	}
+}
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	assertions := []Assertion{
+		{Text: "neverallow appdomain system_file:file write;"},
+		{Text: "neverallow { domain -init } file_type:file write;"},
+		{Text: "neverallow appdomain;"},
+	}
+	keys := func(policy string) []string {
+		p, err := cil.Parse(strings.NewReader(policy), "policy.cil")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Keys(assertions, p)
+	}
+
+	base := keys(coveragePolicy)
+	if base[0] == "" || base[1] == "" || base[2] != "" {
+		t.Fatalf("expected keys for parsed assertions only, got %q", base)
+	}
+
+	// The order of rules doesn't matter.
+	lines := strings.Split(strings.TrimSpace(coveragePolicy), "\n")
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	if reversed := keys(strings.Join(lines, "\n")); !reflect.DeepEqual(reversed, base) {
+		t.Errorf("expected the same keys for reordered rules, got %q and %q", base, reversed)
+	}
+
+	// A rule from init doesn't overlap with either assertion.
+	unrelated := keys(coveragePolicy + "(allow init app_data_file (file (write)))\n")
+	if !reflect.DeepEqual(unrelated, base) {
+		t.Errorf("expected the same keys with an unrelated rule, got %q and %q", base, unrelated)
+	}
+
+	overlapping := keys(coveragePolicy + "(allow app system_file (file (append)))\n")
+	if overlapping[0] == base[0] || overlapping[1] == base[1] {
+		t.Errorf("expected new keys with an overlapping rule, got %q and %q", base, overlapping)
+	}
+
+	// Adding a type to an attribute of an assertion changes its key.
+	attribute := keys(strings.Replace(coveragePolicy, "(init app untrusted_app)", "(init app untrusted_app system_file)", 1))
+	if attribute[0] != base[0] || attribute[1] == base[1] {
+		t.Errorf("expected a new key for the domain assertion only, got %q and %q", base, attribute)
+	}
+
+	var sb strings.Builder
+	if err := WriteCache(&sb, []string{"b", "", "a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "a\nb\n" {
+		t.Errorf("expected sorted unique keys, got %q", sb.String())
+	}
+	cache, err := ReadCache(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cache, map[string]bool{"a": true, "b": true}) {
+		t.Errorf("unexpected cache %v", cache)
+	}
+}
+
+func TestReadCacheFile(t *testing.T) {
+	t.Parallel()
+
+	assertions := []Assertion{
+		{Text: "neverallow appdomain system_file:file write;"},
+		{Text: "neverallow { domain -init } file_type:file write;"},
+	}
+	keys := func(policy string) []string {
+		p, err := cil.Parse(strings.NewReader(policy), "policy.cil")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Keys(assertions, p)
+	}
+
+	// There is no cache before the first build.
+	path := filepath.Join(t.TempDir(), "cache.txt")
+	cache, err := ReadCacheFile(path)
+	if err != nil || len(cache) != 0 {
+		t.Fatalf("expected an empty cache for a missing file, got %v, %v", cache, err)
+	}
+
+	var sb strings.Builder
+	if err := WriteCache(&sb, keys(coveragePolicy)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if cache, err = ReadCacheFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache is stale for the assertions overlapping with a new rule, which are checked again.
+	for i, key := range keys(coveragePolicy + "(allow app system_file (file (append)))\n") {
+		if cache[key] {
+			t.Errorf("expected the cache to be stale for %q", assertions[i].Text)
+		}
+	}
+	for i, key := range keys(coveragePolicy + "(allow init app_data_file (file (write)))\n") {
+		if !cache[key] {
+			t.Errorf("expected the cache to be up to date for %q", assertions[i].Text)
+		}
+	}
+}
@@ -15,11 +15,14 @@
 package selinux
 
 import (
+	"encoding/json"
 	"os"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/google/blueprint"
 	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
@@ -31,7 +34,8 @@ const (
 	PolicyVers = 30
 )
 
-// This order should be kept. checkpolicy syntax requires it.
+// This order should be kept. checkpolicy syntax requires it. Each entry is a list of glob patterns
+// separated by '|'. Files matching the entry at index i are ranked i*policyConfOrderRankStep.
 var policyConfOrder = []string{
 	"flagging_macros",
 	"security_classes",
@@ -56,6 +60,10 @@ var policyConfOrder = []string{
 	"port_contexts",
 }
 
+// policyConfOrderRankStep leaves room between built-in ranks for files placed by the order
+// property.
+const policyConfOrderRankStep = 10
+
 func init() {
 	android.RegisterModuleType("se_policy_conf", policyConfFactory)
 	android.RegisterModuleType("se_policy_conf_defaults", policyConfDefaultFactory)
@@ -70,13 +78,36 @@ type policyConfProperties struct {
 	// Policy files to be compiled to cil file.
 	Srcs []string `android:"path"`
 
+	// Policy files added to srcs under conditions on the build configuration: sanitizers,
+	// coverage modes, build variants or Soong config variables. Build variants are those of each
+	// conf file, following build_variant or variants.
+	Conditional_srcs []conditionalSrcsProperties
+
+	// Entries of conditional_srcs with build_variants, whose other conditions are met, and their
+	// srcs. They are selected for each conf file by its build variant.
+	Build_variant_conditional_srcs []conditionalSrcsProperties `blueprint:"mutated"`
+	Build_variant_srcs             []string                    `android:"path" blueprint:"mutated"`
+
 	// Target build variant (user / userdebug / eng). Default follows the current lunch target
 	Build_variant *string
 
+	// Build variants to build additional conf files for, regardless of build_variant and the
+	// current lunch target. The conf file of each variant is available with the variant as output
+	// tag, e.g. ":module{user}".
+	Variants []string
+
 	// Whether to exclude build test or not. Default is false
 	Exclude_build_test *bool
 
+	// Whether to fail on names immediately followed by '(' which aren't defined macros, which are
+	// likely misspelled macros. Default is false
+	Warn_undefined_macros *bool
+
 	// Whether to include asan specific policies or not. Default follows the current lunch target
+	//
+	// Deprecated: put ASAN-only policy files in conditional_srcs with sanitizers: ["address"].
+	// The target_with_asan macro still follows the sanitizers of the device, for policy which
+	// can't be split out of shared files, e.g. exceptions of neverallow rules.
 	With_asan *bool
 
 	// Whether to build CTS specific policy or not. Default is false
@@ -94,6 +125,25 @@ type policyConfProperties struct {
 	// Board api level of policy files. Set "current" for RELEASE_BOARD_API_LEVEL, or a direct
 	// version string (e.g. "202404"). Defaults to "current"
 	Board_api_level *string
+
+	// Where to place source files in the conf file, in addition to the built-in order. Built-in
+	// file names are ranked 0, 10, 20, ... in the order checkpolicy requires (flagging_macros is
+	// 0, te_macros is 100, ioctl_defines is 110, attributes and *.te are 130, port_contexts is
+	// 200), so e.g. rank 105 places files between te_macros and ioctl_defines. If several entries
+	// match a file, the last one wins; entries of a module therefore take precedence over entries
+	// inherited from defaults, which take precedence over the built-in order. It is an error for
+	// a source file to match no entry.
+	Order []policyConfOrderProperties
+}
+
+type policyConfOrderProperties struct {
+	// Glob patterns matched against the file names of srcs, e.g. "vendor_macros" or
+	// "*.cil_snippet".
+	Patterns []string
+
+	// Rank of the matching files. Files are sorted by rank in ascending order, and files with the
+	// same rank keep their order in srcs.
+	Rank *int64
 }
 
 type policyConf struct {
@@ -105,21 +155,72 @@ type policyConf struct {
 
 	installSource android.Path
 	installPath   android.InstallPath
+	sourceMap     android.Path
+	macros        []m4Macro
+	macrosFile    android.Path
+	macroTable    android.Path
 }
 
 var _ flaggableModule = (*policyConf)(nil)
 
+// policyConfOutputs holds the outputs of a single conf file.
+type policyConfOutputs struct {
+	Conf android.Path
+
+	// JSON source map from lines of the conf file to the policy files they came from.
+	SourceMap android.Path
+
+	// Macros passed to m4 with -D, and the JSON file listing them.
+	Macros     []m4Macro
+	MacrosFile android.Path
+
+	// Macro table at the end of m4 expansion.
+	MacroTable android.Path
+}
+
+type policyConfInfo struct {
+	// Outputs of the conf file following build_variant.
+	policyConfOutputs
+
+	// Outputs of the conf files of the variants property, keyed by build variant.
+	Variants map[string]policyConfOutputs
+}
+
+var policyConfProviderKey = blueprint.NewProvider[policyConfInfo]()
+
 // se_policy_conf merges collection of policy files into a policy.conf file to be processed by
-// checkpolicy.
+// checkpolicy. The macros passed to m4, with the provenance of their values, are listed in the
+// ".macros" output. The macro table at the end of expansion is available as the ".m4_macros"
+// output. Conf files for the build variants listed in variants are available with the variant as
+// output tag.
 func policyConfFactory() android.Module {
 	c := &policyConf{}
 	c.AddProperties(&c.properties)
 	initFlaggableModule(c)
 	android.InitAndroidArchModule(c, android.DeviceSupported, android.MultilibCommon)
 	android.InitDefaultableModule(c)
+	android.AddLoadHook(c, func(ctx android.LoadHookContext) {
+		c.loadHook(ctx)
+	})
 	return c
 }
 
+// loadHook adds the conditional srcs whose conditions are met to srcs. Those with build_variants
+// are kept aside, to be selected for each conf file by its build variant.
+func (c *policyConf) loadHook(ctx android.LoadHookContext) {
+	for _, entry := range c.properties.Conditional_srcs {
+		if !entry.validate(ctx, "conditional_srcs") || !entry.matches(ctx, "") {
+			continue
+		}
+		if len(entry.Build_variants) > 0 {
+			c.properties.Build_variant_conditional_srcs = append(c.properties.Build_variant_conditional_srcs, entry)
+			c.properties.Build_variant_srcs = append(c.properties.Build_variant_srcs, entry.Srcs...)
+		} else {
+			c.properties.Srcs = append(c.properties.Srcs, entry.Srcs...)
+		}
+	}
+}
+
 type policyConfDefaults struct {
 	android.ModuleBase
 	android.DefaultsModuleBase
@@ -151,13 +252,27 @@ func (c *policyConf) buildVariant(ctx android.ModuleContext) string {
 	if variant := proptools.String(c.properties.Build_variant); variant != "" {
 		return variant
 	}
-	if ctx.Config().Eng() {
-		return "eng"
-	}
-	if ctx.Config().Debuggable() {
-		return "userdebug"
+	return configBuildVariant(ctx.Config())
+}
+
+// buildVariants are the valid values of build_variant and variants.
+var buildVariants = []string{"user", "userdebug", "eng"}
+
+// variants returns the variants property, reporting invalid and duplicate entries.
+func (c *policyConf) variants(ctx android.ModuleContext) []string {
+	var ret []string
+	for _, variant := range c.properties.Variants {
+		if !android.InList(variant, buildVariants) {
+			ctx.PropertyErrorf("variants", "unknown build variant %q; expected one of %q", variant, buildVariants)
+			continue
+		}
+		if android.InList(variant, ret) {
+			ctx.PropertyErrorf("variants", "duplicate build variant %q", variant)
+			continue
+		}
+		ret = append(ret, variant)
 	}
-	return "user"
+	return ret
 }
 
 func (c *policyConf) cts() bool {
@@ -233,55 +348,223 @@ func (c *policyConf) boardApiLevel(ctx android.ModuleContext) string {
 	}
 }
 
-func findPolicyConfOrder(name string) int {
-	for idx, pattern := range policyConfOrder {
-		// We could use regexp but it seems like an overkill
-		if pattern == "attributes|*.te" && (name == "attributes" || strings.HasSuffix(name, ".te")) {
-			return idx
-		} else if pattern == name {
-			return idx
+type policyConfOrderEntry struct {
+	patterns []string
+	rank     int
+}
+
+// orderEntries returns the built-in order followed by the entries of the order property.
+func (c *policyConf) orderEntries(ctx android.ModuleContext) []policyConfOrderEntry {
+	var ret []policyConfOrderEntry
+	for idx, patterns := range policyConfOrder {
+		ret = append(ret, policyConfOrderEntry{
+			patterns: strings.Split(patterns, "|"),
+			rank:     idx * policyConfOrderRankStep,
+		})
+	}
+	for _, o := range c.properties.Order {
+		if len(o.Patterns) == 0 || o.Rank == nil {
+			ctx.PropertyErrorf("order", "each entry must have patterns and a rank")
+			continue
 		}
+		for _, pattern := range o.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				ctx.PropertyErrorf("order", "invalid pattern %q: %s", pattern, err)
+			}
+		}
+		ret = append(ret, policyConfOrderEntry{patterns: o.Patterns, rank: int(*o.Rank)})
 	}
-	// name is not matched
-	return len(policyConfOrder)
+	return ret
 }
 
-func (c *policyConf) transformPolicyToConf(ctx android.ModuleContext) android.OutputPath {
-	conf := pathForModuleOut(ctx, c.stem())
-	rule := android.NewRuleBuilder(pctx, ctx)
+// findPolicyConfOrder returns the rank of the last entry matching name.
+func findPolicyConfOrder(entries []policyConfOrderEntry, name string) (int, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		for _, pattern := range entries[i].patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				return entries[i].rank, true
+			}
+		}
+	}
+	return 0, false
+}
 
-	srcs := android.PathsForModuleSrc(ctx, c.properties.Srcs)
-	sort.SliceStable(srcs, func(x, y int) bool {
-		return findPolicyConfOrder(srcs[x].Base()) < findPolicyConfOrder(srcs[y].Base())
+// sortSrcs sorts srcs in the order checkpolicy requires, and reports source files that match no
+// entry of the order.
+func (c *policyConf) sortSrcs(ctx android.ModuleContext, srcs android.Paths) {
+	c.sortSrcsReporting(ctx, srcs, true)
+}
+
+func (c *policyConf) sortSrcsReporting(ctx android.ModuleContext, srcs android.Paths, report bool) {
+	type rankedSrc struct {
+		src  android.Path
+		rank int
+	}
+	entries := c.orderEntries(ctx)
+	ranked := make([]rankedSrc, len(srcs))
+	for i, src := range srcs {
+		rank, ok := findPolicyConfOrder(entries, src.Base())
+		if !ok && report {
+			ctx.PropertyErrorf("srcs", "%q matches no entry of the policy.conf order; "+
+				"use the order property to place it", src.String())
+		}
+		ranked[i] = rankedSrc{src, rank}
+	}
+	sort.SliceStable(ranked, func(x, y int) bool {
+		return ranked[x].rank < ranked[y].rank
 	})
+	for i, r := range ranked {
+		srcs[i] = r.src
+	}
+}
+
+// m4Macro is a macro definition passed to m4 with -D.
+type m4Macro struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+
+	// Provenance tells what decided the value: a property ("property:cts"), a product config
+	// ("BuildBrokenTrebleSyspropNeverallow"), a build flag collected by a se_flags_collector
+	// module ("se_flags_collector:RELEASE_FOO"), or "default".
+	Provenance string `json:"provenance"`
+}
+
+func (m m4Macro) String() string {
+	return m.Name + "=" + m.Value
+}
+
+// propertyProvenance returns the provenance of a value given by the named property if set, or by
+// fallback otherwise.
+func propertyProvenance(set bool, property, fallback string) string {
+	if set {
+		return "property:" + property
+	}
+	return fallback
+}
+
+// trebleProvenance returns the provenance of a treble related macro, which the cts and
+// target_recovery properties override.
+func (c *policyConf) trebleProvenance(fallback string) string {
+	if c.cts() {
+		return "property:cts"
+	}
+	if c.isTargetRecovery() {
+		return "property:target_recovery"
+	}
+	return fallback
+}
+
+func (c *policyConf) buildVariantProvenance(ctx android.ModuleContext) string {
+	switch {
+	case proptools.String(c.properties.Build_variant) != "":
+		return "property:build_variant"
+	case ctx.Config().Eng():
+		return "Eng"
+	case ctx.Config().Debuggable():
+		return "Debuggable"
+	}
+	return "default"
+}
 
-	flags := c.getBuildFlags(ctx)
-	rule.Command().Tool(ctx.Config().PrebuiltBuildTool(ctx, "m4")).
+// m4Macros returns the macros that policy files are expanded with, in the order they are passed
+// to m4. If variant is not empty, it overrides the build variant.
+func (c *policyConf) m4Macros(ctx android.ModuleContext, variant string) []m4Macro {
+	var ret []m4Macro
+	for _, def := range ctx.DeviceConfig().SepolicyM4Defs() {
+		name, value, _ := strings.Cut(def, "=")
+		ret = append(ret, m4Macro{name, value, "BOARD_SEPOLICY_M4DEFS"})
+	}
+	boardApiLevelProvenance := "property:board_api_level"
+	if proptools.StringDefault(c.properties.Board_api_level, "current") == "current" {
+		boardApiLevelProvenance = "RELEASE_BOARD_API_LEVEL"
+	}
+	buildVariant, buildVariantProvenance := c.buildVariant(ctx), c.buildVariantProvenance(ctx)
+	if variant != "" {
+		buildVariant, buildVariantProvenance = variant, "property:variants"
+	}
+	debugfsProvenance := "BuildDebugfsRestrictionsEnabled"
+	if c.cts() {
+		debugfsProvenance = "property:cts"
+	}
+	ret = append(ret,
+		m4Macro{"mls_num_sens", strconv.Itoa(MlsSens), "default"},
+		m4Macro{"mls_num_cats", strconv.Itoa(c.mlsCats()), propertyProvenance(c.properties.Mls_cats != nil, "mls_cats", "default")},
+		m4Macro{"target_arch", ctx.DeviceConfig().DeviceArch(), "DeviceArch"},
+		m4Macro{"target_with_asan", c.withAsan(ctx), propertyProvenance(c.properties.With_asan != nil, "with_asan", "SanitizeDevice")},
+		m4Macro{"target_with_dexpreopt", strconv.FormatBool(ctx.DeviceConfig().WithDexpreopt()), "WithDexpreopt"},
+		m4Macro{"target_with_native_coverage", strconv.FormatBool(ctx.DeviceConfig().ClangCoverageEnabled() || ctx.DeviceConfig().GcovCoverageEnabled()), "ClangCoverageEnabled,GcovCoverageEnabled"},
+		m4Macro{"target_build_variant", buildVariant, buildVariantProvenance},
+		m4Macro{"target_full_treble", c.sepolicySplit(ctx), c.trebleProvenance("default")},
+		m4Macro{"target_compatible_property", c.compatibleProperty(ctx), c.trebleProvenance("default")},
+		m4Macro{"target_treble_sysprop_neverallow", c.trebleSyspropNeverallow(ctx), c.trebleProvenance("BuildBrokenTrebleSyspropNeverallow")},
+		m4Macro{"target_enforce_sysprop_owner", c.enforceSyspropOwner(ctx), c.trebleProvenance("BuildBrokenEnforceSyspropOwner")},
+		m4Macro{"target_exclude_build_test", strconv.FormatBool(proptools.Bool(c.properties.Exclude_build_test)), propertyProvenance(c.properties.Exclude_build_test != nil, "exclude_build_test", "default")},
+		m4Macro{"target_requires_insecure_execmem_for_swiftshader", strconv.FormatBool(ctx.DeviceConfig().RequiresInsecureExecmemForSwiftshader()), "RequiresInsecureExecmemForSwiftshader"},
+		m4Macro{"target_enforce_debugfs_restriction", c.enforceDebugfsRestrictions(ctx), debugfsProvenance},
+		m4Macro{"target_recovery", strconv.FormatBool(c.isTargetRecovery()), propertyProvenance(c.properties.Target_recovery != nil, "target_recovery", "default")},
+		m4Macro{"target_board_api_level", c.boardApiLevel(ctx), boardApiLevelProvenance},
+	)
+	flags, sources := c.getBuildFlagsWithSources(ctx)
+	for _, flag := range android.SortedKeys(flags) {
+		ret = append(ret, m4Macro{"target_flag_" + flag, flags[flag], sources[flag] + ":" + flag})
+	}
+	return ret
+}
+
+// transformPolicyToConf builds the conf file of variant, or of the build variant following
+// build_variant if variant is empty. Outputs of variants are placed in a directory named after
+// the variant.
+func (c *policyConf) transformPolicyToConf(ctx android.ModuleContext, srcs android.Paths, variant string) policyConfOutputs {
+	outPath := func(name string) android.OutputPath {
+		if variant != "" {
+			return pathForModuleOut(ctx, variant, name)
+		}
+		return pathForModuleOut(ctx, name)
+	}
+	conf := outPath(c.stem())
+	rule := android.NewRuleBuilder(pctx, ctx)
+
+	macros := c.m4Macros(ctx, variant)
+	macroTable := outPath(c.stem() + ".m4_macros.json")
+	cmd := rule.Command().BuiltTool("sepolicy_m4").
 		Flag("--fatal-warnings").
-		FlagForEachArg("-D ", ctx.DeviceConfig().SepolicyM4Defs()).
-		FlagWithArg("-D mls_num_sens=", strconv.Itoa(MlsSens)).
-		FlagWithArg("-D mls_num_cats=", strconv.Itoa(c.mlsCats())).
-		FlagWithArg("-D target_arch=", ctx.DeviceConfig().DeviceArch()).
-		FlagWithArg("-D target_with_asan=", c.withAsan(ctx)).
-		FlagWithArg("-D target_with_dexpreopt=", strconv.FormatBool(ctx.DeviceConfig().WithDexpreopt())).
-		FlagWithArg("-D target_with_native_coverage=", strconv.FormatBool(ctx.DeviceConfig().ClangCoverageEnabled() || ctx.DeviceConfig().GcovCoverageEnabled())).
-		FlagWithArg("-D target_build_variant=", c.buildVariant(ctx)).
-		FlagWithArg("-D target_full_treble=", c.sepolicySplit(ctx)).
-		FlagWithArg("-D target_compatible_property=", c.compatibleProperty(ctx)).
-		FlagWithArg("-D target_treble_sysprop_neverallow=", c.trebleSyspropNeverallow(ctx)).
-		FlagWithArg("-D target_enforce_sysprop_owner=", c.enforceSyspropOwner(ctx)).
-		FlagWithArg("-D target_exclude_build_test=", strconv.FormatBool(proptools.Bool(c.properties.Exclude_build_test))).
-		FlagWithArg("-D target_requires_insecure_execmem_for_swiftshader=", strconv.FormatBool(ctx.DeviceConfig().RequiresInsecureExecmemForSwiftshader())).
-		FlagWithArg("-D target_enforce_debugfs_restriction=", c.enforceDebugfsRestrictions(ctx)).
-		FlagWithArg("-D target_recovery=", strconv.FormatBool(c.isTargetRecovery())).
-		FlagWithArg("-D target_board_api_level=", c.boardApiLevel(ctx)).
-		Flags(flagsToM4Macros(flags)).
-		Flag("-s").
+		FlagWithOutput("-dump_macros ", macroTable)
+	if proptools.Bool(c.properties.Warn_undefined_macros) {
+		cmd.Flag("-warn_undefined")
+	}
+	for _, m := range macros {
+		cmd.FlagWithArg("-D ", m.String())
+	}
+	cmd.Flag("-s").
 		Inputs(srcs).
 		Text("> ").Output(conf)
 
-	rule.Build("conf", "Transform policy to conf: "+ctx.ModuleName())
-	return conf
+	macrosJson, err := json.MarshalIndent(macros, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal macros: %s", err)
+	}
+	macrosFile := outPath(c.stem() + ".macros.json")
+	android.WriteFileRule(ctx, macrosFile, string(macrosJson))
+
+	// m4 -s emits #line sync lines; turn them into a source map for error messages.
+	sourceMap := outPath(c.stem() + ".source_map.json")
+	rule.Command().BuiltTool("source_map").
+		Text("generate").
+		FlagWithInput("-i ", conf).
+		FlagWithOutput("-o ", sourceMap)
+
+	if variant != "" {
+		rule.Build("conf_"+variant, "Transform policy to conf: "+ctx.ModuleName()+"{"+variant+"}")
+	} else {
+		rule.Build("conf", "Transform policy to conf: "+ctx.ModuleName())
+	}
+	return policyConfOutputs{
+		Conf:       conf,
+		SourceMap:  sourceMap,
+		Macros:     macros,
+		MacrosFile: macrosFile,
+		MacroTable: macroTable,
+	}
 }
 
 func (c *policyConf) DepsMutator(ctx android.BottomUpMutatorContext) {
@@ -293,11 +576,51 @@ func (c *policyConf) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		c.SkipInstall()
 	}
 
-	c.installSource = c.transformPolicyToConf(ctx)
+	srcs := android.PathsForModuleSrc(ctx, c.properties.Srcs)
+	c.sortSrcs(ctx, srcs)
+	c.sortSrcs(ctx, android.PathsForModuleSrc(ctx, c.properties.Build_variant_srcs))
+
+	outputs := c.transformPolicyToConf(ctx, c.buildVariantSrcs(ctx, srcs, c.buildVariant(ctx)), "")
+	c.installSource = outputs.Conf
+	c.sourceMap = outputs.SourceMap
+	c.macros = outputs.Macros
+	c.macrosFile = outputs.MacrosFile
+	c.macroTable = outputs.MacroTable
 	c.installPath = android.PathForModuleInstall(ctx, "etc")
 	ctx.InstallFile(c.installPath, c.stem(), c.installSource)
 
 	ctx.SetOutputFiles(android.Paths{c.installSource}, "")
+	ctx.SetOutputFiles(android.Paths{c.sourceMap}, ".source_map")
+	ctx.SetOutputFiles(android.Paths{c.macrosFile}, ".macros")
+	ctx.SetOutputFiles(android.Paths{c.macroTable}, ".m4_macros")
+
+	variants := make(map[string]policyConfOutputs)
+	for _, variant := range c.variants(ctx) {
+		variants[variant] = c.transformPolicyToConf(ctx, c.buildVariantSrcs(ctx, srcs, variant), variant)
+		ctx.SetOutputFiles(android.Paths{variants[variant].Conf}, variant)
+	}
+
+	android.SetProvider(ctx, policyConfProviderKey, policyConfInfo{
+		policyConfOutputs: outputs,
+		Variants:          variants,
+	})
+}
+
+// buildVariantSrcs returns srcs, sorted, with the conditional srcs of buildVariant.
+func (c *policyConf) buildVariantSrcs(ctx android.ModuleContext, srcs android.Paths, buildVariant string) android.Paths {
+	var extra android.Paths
+	for _, entry := range c.properties.Build_variant_conditional_srcs {
+		if android.InList(buildVariant, entry.Build_variants) {
+			extra = append(extra, android.PathsForModuleSrc(ctx, entry.Srcs)...)
+		}
+	}
+	if len(extra) == 0 {
+		return srcs
+	}
+	ret := append(append(android.Paths(nil), srcs...), extra...)
+	// Files matching no entry of the order were reported by GenerateAndroidBuildActions.
+	c.sortSrcsReporting(ctx, ret, false)
+	return ret
 }
 
 func (c *policyConf) AndroidMkEntries() []android.AndroidMkEntries {
@@ -333,7 +656,10 @@ type policyCilProperties struct {
 	// exported policies
 	Filter_out []string `android:"path"`
 
-	// Whether to remove line markers (denoted by ;;) out of compiled cil files. Defaults to false
+	// Whether to remove line markers (denoted by ;;*) out of compiled cil files. If true, the cil
+	// file is also normalized: statements are written in canonical order and whitespace, and the
+	// removed markers are kept in {stem}.source_map.json, available with the ".source_map" tag.
+	// Defaults to false
 	Remove_line_marker *bool
 
 	// Whether to run secilc to check compiled policy or not. Defaults to true
@@ -343,6 +669,13 @@ type policyCilProperties struct {
 	// SELINUX_IGNORE_NEVERALLOWS.
 	Ignore_neverallow *bool
 
+	// Ledger of allowed neverallow violations, as written to the ".neverallow_ledger" output. If
+	// set, secilc ignores neverallows as with ignore_neverallow, but the violations are written to
+	// the ledger, and the build fails on violations missing from this file. Can't be set with
+	// ignore_neverallow, nor with secilc_check: false. SELINUX_IGNORE_NEVERALLOWS still ignores
+	// all violations.
+	Neverallow_allowlist *string `android:"path"`
+
 	// Whether this module is directly installable to one of the partitions. Default is true
 	Installable *bool
 }
@@ -352,12 +685,17 @@ type policyCil struct {
 
 	properties policyCilProperties
 
-	installSource android.Path
-	installPath   android.InstallPath
+	installSource    android.Path
+	installPath      android.InstallPath
+	sourceMap        android.Path
+	neverallowLedger android.Path
 }
 
 // se_policy_cil compiles a policy.conf file to a cil file with checkpolicy, and optionally runs
-// secilc to check the output cil file. Affected by SELINUX_IGNORE_NEVERALLOWS.
+// secilc to check the output cil file. Affected by SELINUX_IGNORE_NEVERALLOWS. If src is a
+// se_policy_conf module with variants, a cil file is also compiled for each variant and is
+// available with the variant as output tag, so that e.g. se_policy_binary can pick one with
+// ":module{user}". A single variant can be compiled instead by setting src to ":conf{variant}".
 func policyCilFactory() android.Module {
 	c := &policyCil{}
 	c.AddProperties(&c.properties)
@@ -373,10 +711,46 @@ func (c *policyCil) stem() string {
 	return proptools.StringDefault(c.properties.Stem, c.Name())
 }
 
-func (c *policyCil) compileConfToCil(ctx android.ModuleContext, conf android.Path) android.OutputPath {
-	cil := pathForModuleOut(ctx, c.stem())
+// confInfo returns the policyConfInfo of src and the output tag src refers to, if src is the
+// output of a se_policy_conf module.
+func (c *policyCil) confInfo(ctx android.ModuleContext) (policyConfInfo, string, bool) {
+	module, tag := android.SrcIsModuleWithTag(proptools.String(c.properties.Src))
+	if module == "" {
+		return policyConfInfo{}, "", false
+	}
+	var ret policyConfInfo
+	found := false
+	ctx.VisitDirectDeps(func(dep android.Module) {
+		if ctx.OtherModuleName(dep) != module {
+			return
+		}
+		ret, found = android.OtherModuleProvider(ctx, dep, policyConfProviderKey)
+	})
+	return ret, tag, found
+}
+
+// compileConfToCil compiles conf to a cil file. confSourceMap is the source map of conf, if any.
+// If variant is not empty, outputs are placed in a directory named after the variant. Returns
+// the cil file and its source map, if line markers are removed.
+func (c *policyCil) compileConfToCil(ctx android.ModuleContext, conf, confSourceMap android.Path, variant string) (android.OutputPath, android.Path) {
+	outPath := func(name string) android.OutputPath {
+		if variant != "" {
+			return pathForModuleOut(ctx, variant, name)
+		}
+		return pathForModuleOut(ctx, name)
+	}
+	cil := outPath(c.stem())
+	var sourceMap android.Path
 	rule := android.NewRuleBuilder(pctx, ctx)
-	checkpolicyCmd := rule.Command().BuiltTool("checkpolicy").
+	checkpolicyCmd := rule.Command()
+	if confSourceMap != nil {
+		// Point checkpolicy errors at the original .te files rather than the conf file.
+		checkpolicyCmd.BuiltTool("source_map").
+			Text("rewrite").
+			FlagWithInput("-m ", confSourceMap).
+			Text("--")
+	}
+	checkpolicyCmd.BuiltTool("checkpolicy").
 		Flag("-C"). // Write CIL
 		Flag("-M"). // Enable MLS
 		FlagWithArg("-c ", strconv.Itoa(PolicyVers)).
@@ -402,18 +776,33 @@ func (c *policyCil) compileConfToCil(ctx android.ModuleContext, conf android.Pat
 	}
 
 	if proptools.Bool(c.properties.Remove_line_marker) {
-		rule.Command().Text("grep -v").
-			Text(proptools.ShellEscape(";;")).
-			Text(cil.String()).
-			Text(">").
-			Text(cil.String() + ".tmp").
-			Text("&& mv").
-			Text(cil.String() + ".tmp").
-			Text(cil.String())
+		normalizerMap := outPath(c.stem() + ".source_map.json")
+		rule.Command().BuiltTool("cil_normalizer").
+			FlagWithArg("-i ", cil.String()).
+			FlagWithOutput("-o ", cil).
+			FlagWithOutput("-source_map ", normalizerMap)
+		sourceMap = normalizerMap
 	}
 
 	if proptools.BoolDefault(c.properties.Secilc_check, true) {
-		secilcCmd := rule.Command().BuiltTool("secilc").
+		secilcCmd := rule.Command()
+		if sourceMap != nil {
+			// Line markers were removed; point secilc errors at the original .te files instead.
+			secilcCmd.BuiltTool("source_map").
+				Text("rewrite").
+				FlagWithInput("-m ", sourceMap).
+				Text("--")
+		}
+		ignoreNeverallow, allowlist := neverallowCheck(ctx, c.properties.Ignore_neverallow, c.properties.Neverallow_allowlist)
+		ledgerMode := c.properties.Neverallow_allowlist != nil
+		if ledgerMode {
+			ledger := outPath(c.stem() + "_neverallow_ledger.txt")
+			wrapSecilcWithLedger(secilcCmd, outPath(c.stem()+"_diagnostics.json"), ledger, allowlist)
+			if variant == "" {
+				c.neverallowLedger = ledger
+			}
+		}
+		secilcCmd.BuiltTool("secilc").
 			Flag("-m").                 // Multiple decls
 			FlagWithArg("-M ", "true"). // Enable MLS
 			Flag("-G").                 // expand and remove auto generated attributes
@@ -423,13 +812,17 @@ func (c *policyCil) compileConfToCil(ctx android.ModuleContext, conf android.Pat
 			FlagWithArg("-o ", os.DevNull).
 			FlagWithArg("-f ", os.DevNull)
 
-		if proptools.BoolDefault(c.properties.Ignore_neverallow, ctx.Config().SelinuxIgnoreNeverallows()) {
+		if ignoreNeverallow && !ledgerMode {
 			secilcCmd.Flag("-N")
 		}
 	}
 
-	rule.Build("cil", "Building cil for "+ctx.ModuleName())
-	return cil
+	if variant != "" {
+		rule.Build("cil_"+variant, "Building cil for "+ctx.ModuleName()+"{"+variant+"}")
+	} else {
+		rule.Build("cil", "Building cil for "+ctx.ModuleName())
+	}
+	return cil, sourceMap
 }
 
 func (c *policyCil) GenerateAndroidBuildActions(ctx android.ModuleContext) {
@@ -437,8 +830,22 @@ func (c *policyCil) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		ctx.PropertyErrorf("src", "must be specified")
 		return
 	}
+	if c.properties.Neverallow_allowlist != nil && !proptools.BoolDefault(c.properties.Secilc_check, true) {
+		ctx.PropertyErrorf("neverallow_allowlist", "can't be set with secilc_check: false")
+		return
+	}
 	conf := android.PathForModuleSrc(ctx, *c.properties.Src)
-	cil := c.compileConfToCil(ctx, conf)
+	var confSourceMap android.Path
+	confInfo, tag, isConf := c.confInfo(ctx)
+	if isConf {
+		if tag == "" {
+			confSourceMap = confInfo.SourceMap
+		} else if variant, ok := confInfo.Variants[tag]; ok {
+			confSourceMap = variant.SourceMap
+		}
+	}
+	cil, sourceMap := c.compileConfToCil(ctx, conf, confSourceMap, "")
+	c.sourceMap = sourceMap
 
 	if !c.Installable() {
 		c.SkipInstall()
@@ -454,6 +861,20 @@ func (c *policyCil) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	ctx.InstallFile(c.installPath, c.stem(), c.installSource)
 
 	ctx.SetOutputFiles(android.Paths{c.installSource}, "")
+	if c.sourceMap != nil {
+		ctx.SetOutputFiles(android.Paths{c.sourceMap}, ".source_map")
+	}
+	if c.neverallowLedger != nil {
+		ctx.SetOutputFiles(android.Paths{c.neverallowLedger}, ".neverallow_ledger")
+	}
+
+	if isConf && tag == "" {
+		for _, variant := range android.SortedKeys(confInfo.Variants) {
+			outputs := confInfo.Variants[variant]
+			variantCil, _ := c.compileConfToCil(ctx, outputs.Conf, outputs.SourceMap, variant)
+			ctx.SetOutputFiles(android.Paths{variantCil}, variant)
+		}
+	}
 }
 
 func (c *policyCil) AndroidMkEntries() []android.AndroidMkEntries {
@@ -481,11 +902,21 @@ type policyBinaryProperties struct {
 	// SELINUX_IGNORE_NEVERALLOWS.
 	Ignore_neverallow *bool
 
+	// Ledger of allowed neverallow violations, as written to the ".neverallow_ledger" output. If
+	// set, secilc ignores neverallows as with ignore_neverallow, but the violations are written to
+	// the ledger, and the build fails on violations missing from this file. Can't be set with
+	// ignore_neverallow. SELINUX_IGNORE_NEVERALLOWS still ignores all violations.
+	Neverallow_allowlist *string `android:"path"`
+
 	// Whether this module is directly installable to one of the partitions. Default is true
 	Installable *bool
 
 	// List of domains that are allowed to be in permissive mode on user builds.
 	Permissive_domains_on_user_builds []string
+
+	// Maximum number of permissive domains on debuggable (userdebug and eng) builds. Unlimited if
+	// unset.
+	Max_permissive_domains_on_debuggable *int64
 }
 
 type policyBinary struct {
@@ -493,12 +924,29 @@ type policyBinary struct {
 
 	properties policyBinaryProperties
 
-	installSource android.Path
-	installPath   android.InstallPath
+	installSource     android.Path
+	installPath       android.InstallPath
+	permissiveDomains android.Path
+	diagnostics       android.Path
+	neverallowLedger  android.Path
 }
 
+type policyBinaryInfo struct {
+	// Sorted list of permissive domains of the policy, one per line.
+	PermissiveDomains android.Path
+
+	// JSON diagnostics of secilc, including the neverallow failures ignored by ignore_neverallow.
+	Diagnostics android.Path
+}
+
+var policyBinaryProviderKey = blueprint.NewProvider[policyBinaryInfo]()
+
 // se_policy_binary compiles cil files to a binary sepolicy file with secilc.  Usually sources of
-// se_policy_binary come from outputs of se_policy_cil modules.
+// se_policy_binary come from outputs of se_policy_cil modules. Errors of secilc are written as
+// JSON diagnostics, available as the ".diagnostics" output, and summarized by domain. Permissive
+// domains of the policy are listed in the ".permissive" output; the build fails if there are
+// permissive domains other than permissive_domains_on_user_builds on user builds, or more than
+// max_permissive_domains_on_debuggable on debuggable builds.
 func policyBinaryFactory() android.Module {
 	c := &policyBinary{}
 	c.AddProperties(&c.properties)
@@ -523,9 +971,25 @@ func (c *policyBinary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		ctx.PropertyErrorf("srcs", "must be specified")
 		return
 	}
+	if budget := c.properties.Max_permissive_domains_on_debuggable; budget != nil && *budget < 0 {
+		ctx.PropertyErrorf("max_permissive_domains_on_debuggable", "must not be negative")
+		return
+	}
 	bin := pathForModuleOut(ctx, c.stem()+"_policy")
+	c.diagnostics = pathForModuleOut(ctx, c.stem()+"_diagnostics.json")
 	rule := android.NewRuleBuilder(pctx, ctx)
-	secilcCmd := rule.Command().BuiltTool("secilc").
+	// secilc_diagnostics passes -N to secilc itself, so that it can also report the neverallow
+	// failures which were ignored.
+	secilcCmd := rule.Command()
+	if ignoreNeverallow, allowlist := neverallowCheck(ctx, c.properties.Ignore_neverallow, c.properties.Neverallow_allowlist); ignoreNeverallow {
+		c.neverallowLedger = pathForModuleOut(ctx, c.stem()+"_neverallow_ledger.txt")
+		wrapSecilcWithLedger(secilcCmd, c.diagnostics, c.neverallowLedger, allowlist)
+	} else {
+		secilcCmd.BuiltTool("secilc_diagnostics").
+			FlagWithOutput("-o ", c.diagnostics).
+			Text("--")
+	}
+	secilcCmd.BuiltTool("secilc").
 		Flag("-m").                 // Multiple decls
 		FlagWithArg("-M ", "true"). // Enable MLS
 		Flag("-G").                 // expand and remove auto generated attributes
@@ -533,18 +997,25 @@ func (c *policyBinary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		Inputs(android.PathsForModuleSrc(ctx, c.properties.Srcs)).
 		FlagWithOutput("-o ", bin).
 		FlagWithArg("-f ", os.DevNull)
-
-	if proptools.BoolDefault(c.properties.Ignore_neverallow, ctx.Config().SelinuxIgnoreNeverallows()) {
-		secilcCmd.Flag("-N")
-	}
 	rule.Temporary(bin)
 
-	// permissive check is performed only in user build (not debuggable).
+	// List permissive domains on every build for the report, then check them against the
+	// allowlist on user builds, or against the budget on debuggable builds.
+	// The output is sorted by a separate command, as a pipe would hide failures of sepolicy-analyze.
+	c.permissiveDomains = pathForModuleOut(ctx, c.stem()+"_permissive.txt")
+	unsortedDomains := pathForModuleOut(ctx, c.stem()+"_permissive_unsorted.txt")
+	rule.Command().BuiltTool("sepolicy-analyze").
+		Input(bin).
+		Text("permissive").
+		FlagWithOutput("> ", unsortedDomains)
+	rule.Temporary(unsortedDomains)
+	rule.Command().Text("sort").
+		Input(unsortedDomains).
+		FlagWithOutput("> ", c.permissiveDomains)
+
 	if !ctx.Config().Debuggable() {
-		permissiveDomains := pathForModuleOut(ctx, c.stem()+"_permissive")
-		cmd := rule.Command().BuiltTool("sepolicy-analyze").
-			Input(bin).
-			Text("permissive")
+		invalidDomains := pathForModuleOut(ctx, c.stem()+"_permissive")
+		cmd := rule.Command().Text("cat").Input(c.permissiveDomains)
 		// Filter-out domains listed in permissive_domains_on_user_builds
 		allowedDomains := c.properties.Permissive_domains_on_user_builds
 		if len(allowedDomains) != 0 {
@@ -554,20 +1025,35 @@ func (c *policyBinary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			}
 			cmd.Text(" || true; }") // no match doesn't fail the cmd
 		}
-		cmd.Text(" > ").Output(permissiveDomains)
-		rule.Temporary(permissiveDomains)
+		cmd.Text(" > ").Output(invalidDomains)
+		rule.Temporary(invalidDomains)
 
 		msg := `==========\n` +
 			`ERROR: permissive domains not allowed in user builds\n` +
 			`List of invalid domains:`
 
 		rule.Command().Text("if test").
-			FlagWithInput("-s ", permissiveDomains).
+			FlagWithInput("-s ", invalidDomains).
+			Text("; then echo").
+			Flag("-e").
+			Text(`"` + msg + `"`).
+			Text("&& cat ").
+			Input(invalidDomains).
+			Text("; exit 1; fi")
+	} else if budget := c.properties.Max_permissive_domains_on_debuggable; budget != nil {
+		msg := `==========\n` +
+			`ERROR: more than ` + strconv.FormatInt(*budget, 10) + ` permissive domains on debuggable builds\n` +
+			`List of permissive domains:`
+
+		rule.Command().Text("if test $(wc -l <").
+			Input(c.permissiveDomains).
+			Text(") -gt").
+			Text(strconv.FormatInt(*budget, 10)).
 			Text("; then echo").
 			Flag("-e").
 			Text(`"` + msg + `"`).
 			Text("&& cat ").
-			Input(permissiveDomains).
+			Input(c.permissiveDomains).
 			Text("; exit 1; fi")
 	}
 
@@ -594,6 +1080,16 @@ func (c *policyBinary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	ctx.InstallFile(c.installPath, c.stem(), c.installSource)
 
 	ctx.SetOutputFiles(android.Paths{c.installSource}, "")
+	ctx.SetOutputFiles(android.Paths{c.permissiveDomains}, ".permissive")
+	ctx.SetOutputFiles(android.Paths{c.diagnostics}, ".diagnostics")
+	if c.neverallowLedger != nil {
+		ctx.SetOutputFiles(android.Paths{c.neverallowLedger}, ".neverallow_ledger")
+	}
+
+	android.SetProvider(ctx, policyBinaryProviderKey, policyBinaryInfo{
+		PermissiveDomains: c.permissiveDomains,
+		Diagnostics:       c.diagnostics,
+	})
 }
 
 func (c *policyBinary) AndroidMkEntries() []android.AndroidMkEntries {
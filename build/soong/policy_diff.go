@@ -0,0 +1,133 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selinux
+
+import (
+	"strconv"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+var (
+	diffBaseTag   = dependencyTag{name: "diff_base"}
+	diffTargetTag = dependencyTag{name: "diff_target"}
+)
+
+func init() {
+	android.RegisterModuleType("se_policy_diff", policyDiffFactory)
+}
+
+type policyDiffProperties struct {
+	// se_policy_cil or se_policy_binary module to compare against.
+	Base *string
+
+	// se_policy_cil or se_policy_binary module to compare with base.
+	Target *string
+}
+
+type policyDiff struct {
+	android.ModuleBase
+
+	properties policyDiffProperties
+}
+
+// se_policy_diff reports the semantic difference between two compiled policies: added and removed
+// types and attributes, allow rules grouped by source domain, and changed type transitions. The
+// report is written both as text, which is the default output, and as JSON, which is the ".json"
+// output.
+func policyDiffFactory() android.Module {
+	d := &policyDiff{}
+	d.AddProperties(&d.properties)
+	android.InitAndroidArchModule(d, android.DeviceSupported, android.MultilibCommon)
+	return d
+}
+
+func (d *policyDiff) DepsMutator(ctx android.BottomUpMutatorContext) {
+	if base := proptools.String(d.properties.Base); base != "" {
+		ctx.AddDependency(ctx.Module(), diffBaseTag, base)
+	}
+	if target := proptools.String(d.properties.Target); target != "" {
+		ctx.AddDependency(ctx.Module(), diffTargetTag, target)
+	}
+}
+
+// cilOfDep returns the CIL policy of the dependency with the given tag, decompiling it first if
+// the dependency is a binary policy.
+func (d *policyDiff) cilOfDep(ctx android.ModuleContext, depTag dependencyTag) android.Path {
+	deps := ctx.GetDirectDepsWithTag(depTag)
+	if len(deps) != 1 {
+		ctx.ModuleErrorf("%d deps having tag %q; expected only one dep", len(deps), depTag)
+		return nil
+	}
+
+	dep := deps[0]
+	output := android.OutputFilesForModule(ctx, dep, "")
+	if len(output) != 1 {
+		ctx.ModuleErrorf("module %q produced %d outputs; expected only one output", dep.String(), len(output))
+		return nil
+	}
+
+	switch dep.(type) {
+	case *policyCil:
+		return output[0]
+	case *policyBinary:
+		cil := android.PathForModuleOut(ctx, depTag.name+".cil")
+		rule := android.NewRuleBuilder(pctx, ctx)
+		rule.Command().BuiltTool("checkpolicy").
+			Flag("-b"). // Read binary
+			Flag("-C"). // Write CIL
+			Flag("-M"). // Enable MLS
+			FlagWithArg("-c ", strconv.Itoa(PolicyVers)).
+			FlagWithOutput("-o ", cil).
+			Input(output[0])
+		rule.Build("decompile_"+depTag.name, "Decompiling "+ctx.OtherModuleName(dep)+" for "+ctx.ModuleName())
+		return cil
+	}
+	ctx.ModuleErrorf("module %q is neither se_policy_cil nor se_policy_binary", ctx.OtherModuleName(dep))
+	return nil
+}
+
+func (d *policyDiff) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if proptools.String(d.properties.Base) == "" {
+		ctx.PropertyErrorf("base", "must be specified")
+	}
+	if proptools.String(d.properties.Target) == "" {
+		ctx.PropertyErrorf("target", "must be specified")
+	}
+	if ctx.Failed() {
+		return
+	}
+
+	base := d.cilOfDep(ctx, diffBaseTag)
+	target := d.cilOfDep(ctx, diffTargetTag)
+	if ctx.Failed() {
+		return
+	}
+
+	textReport := android.PathForModuleOut(ctx, ctx.ModuleName()+".txt")
+	jsonReport := android.PathForModuleOut(ctx, ctx.ModuleName()+".json")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("policy_diff").
+		FlagWithInput("-base ", base).
+		FlagWithInput("-target ", target).
+		FlagWithOutput("-o ", textReport).
+		FlagWithOutput("-json ", jsonReport)
+	rule.Build("policy_diff", "Comparing policies for "+ctx.ModuleName())
+
+	ctx.SetOutputFiles(android.Paths{textReport}, "")
+	ctx.SetOutputFiles(android.Paths{jsonReport}, ".json")
+}
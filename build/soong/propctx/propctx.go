@@ -0,0 +1,164 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package propctx reads property_contexts files and sysprop_library API files, and generates
+// property_contexts entries from sysprops.
+package propctx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Match kinds of property_contexts entries.
+const (
+	Exact  = "exact"
+	Prefix = "prefix"
+)
+
+// Entry is a line of a property_contexts file.
+type Entry struct {
+	Name    string
+	Context string
+
+	// Match is Exact or Prefix.
+	Match string
+
+	// Type is the type of the property, e.g. "bool" or "enum a b", or empty if not given.
+	Type string
+
+	// Source is where the entry comes from: "file:line" for parsed entries, or the sysprop
+	// module for generated entries.
+	Source string
+}
+
+// String returns the entry in property_contexts syntax.
+func (e Entry) String() string {
+	ret := e.Name + " " + e.Context + " " + e.Match
+	if e.Type != "" {
+		ret += " " + e.Type
+	}
+	return ret
+}
+
+// ParseContexts parses a property_contexts file. name is only used in error messages and sources.
+func ParseContexts(r io.Reader, name string) ([]Entry, error) {
+	var ret []Entry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected a property name and a context", name, line)
+		}
+		e := Entry{Name: fields[0], Context: fields[1], Match: Prefix, Source: fmt.Sprintf("%s:%d", name, line)}
+		if len(fields) > 2 {
+			if fields[2] != Exact && fields[2] != Prefix {
+				return nil, fmt.Errorf("%s:%d: expected exact or prefix, got %q", name, line, fields[2])
+			}
+			e.Match = fields[2]
+			e.Type = strings.Join(fields[3:], " ")
+		}
+		ret = append(ret, e)
+	}
+	return ret, scanner.Err()
+}
+
+// Conflict is a generated entry which disagrees with another entry for the same property.
+type Conflict struct {
+	Generated Entry
+	Other     Entry
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %q from %s conflicts with %q from %s",
+		c.Generated.Name, c.Generated.String(), c.Generated.Source, c.Other.String(), c.Other.Source)
+}
+
+// labels looks up the entries labeling properties the way property_info does: an exact entry for
+// the name first, then the prefix entry with the longest name which is a prefix of the name.
+type labels struct {
+	exact    map[string]Entry
+	prefixes []Entry
+}
+
+func newLabels(entries []Entry) *labels {
+	l := &labels{exact: make(map[string]Entry)}
+	for _, e := range entries {
+		if e.Match == Exact {
+			l.exact[e.Name] = e
+		} else {
+			l.prefixes = append(l.prefixes, e)
+		}
+	}
+	sort.SliceStable(l.prefixes, func(i, j int) bool {
+		return len(l.prefixes[i].Name) > len(l.prefixes[j].Name)
+	})
+	return l
+}
+
+// lookup returns the entry labeling the properties of e: the property named e.Name for an exact
+// entry, or every property starting with e.Name for a prefix entry, which only a prefix entry can
+// label.
+func (l *labels) lookup(e Entry) (Entry, bool) {
+	if e.Match == Exact {
+		if ret, ok := l.exact[e.Name]; ok {
+			return ret, true
+		}
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(e.Name, p.Name) {
+			return p, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Merge returns the generated entries for properties which the handwritten entries don't label,
+// looked up as property_info does. A generated entry for a property which is already labeled is
+// dropped, whatever its context, as the handwritten entry is what the device uses. Entries
+// generated more than once for an unlabeled property are deduplicated, and are conflicts if their
+// context or type differ.
+func Merge(handwritten, generated []Entry) ([]Entry, []Conflict) {
+	l := newLabels(handwritten)
+
+	type key struct{ name, match string }
+	seen := make(map[key]Entry)
+	var added []Entry
+	var conflicts []Conflict
+	for _, g := range generated {
+		if _, ok := l.lookup(g); ok {
+			continue
+		}
+		k := key{g.Name, g.Match}
+		if e, ok := seen[k]; ok {
+			if e.Context != g.Context || e.Type != g.Type {
+				conflicts = append(conflicts, Conflict{Generated: g, Other: e})
+			}
+			continue
+		}
+		seen[k] = g
+		added = append(added, g)
+	}
+	return added, conflicts
+}
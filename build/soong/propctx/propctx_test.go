@@ -0,0 +1,186 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package propctx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const api = `props {
+  module: "android.sysprop.AdbProperties"
+  prop {
+    api_name: "secure"
+    scope: Internal
+    access: ReadWrite
+    prop_name: "ro.adb.secure"
+    integer_as_bool: true
+  }
+}
+props {
+  owner: Vendor
+  module: "vendor.foo.FooProperties"
+  # A comment.
+  prop {
+    api_name: "mode"
+    type: Enum
+    enum_values: "on|off|auto"
+    prop_name: "vendor.foo.mode"
+  }
+  prop {
+    api_name: "ids"
+    type: IntegerList
+    prop_name: 'vendor.foo.ids'
+  }
+}
+`
+
+func TestParseSyspropApi(t *testing.T) {
+	t.Parallel()
+
+	sysprops, err := ParseSyspropApi(strings.NewReader(api), "Foo-current.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Sysprop{
+		{Module: "android.sysprop.AdbProperties", Owner: "Platform", Name: "ro.adb.secure", Type: "Boolean"},
+		{Module: "vendor.foo.FooProperties", Owner: "Vendor", Name: "vendor.foo.mode", Type: "Enum", EnumValues: []string{"on", "off", "auto"}},
+		{Module: "vendor.foo.FooProperties", Owner: "Vendor", Name: "vendor.foo.ids", Type: "IntegerList"},
+	}
+	if !reflect.DeepEqual(sysprops, expected) {
+		t.Errorf("expected %+v, got %+v", expected, sysprops)
+	}
+
+	// A single Properties message, without the props wrapper.
+	sysprops, err = ParseSyspropApi(strings.NewReader(`owner: Odm
+module: "odm.Bar"
+prop { api_name: "odm.bar" type: UInt }
+`), "Bar-current.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Sysprop{{Module: "odm.Bar", Owner: "Odm", Name: "odm.bar", Type: "UInt"}}
+	if !reflect.DeepEqual(sysprops, expected) {
+		t.Errorf("expected %+v, got %+v", expected, sysprops)
+	}
+
+	for _, bad := range []string{
+		"props {",
+		"}",
+		`props { prop { type: "unterminated } }`,
+		"props { prop { type: String } }",
+	} {
+		if _, err := ParseSyspropApi(strings.NewReader(bad), "bad.txt"); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestGenerateAndMerge(t *testing.T) {
+	t.Parallel()
+
+	sysprops, err := ParseSyspropApi(strings.NewReader(api), "Foo-current.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sysprops = append(sysprops,
+		Sysprop{Module: "vendor.foo.Other", Owner: "Vendor", Name: "vendor.foo.", Type: "String"},
+		Sysprop{Module: "vendor.bar.BarProperties", Owner: "Vendor", Name: "vendor.bar.level", Type: "Integer"},
+		Sysprop{Module: "vendor.bar.Same", Owner: "Vendor", Name: "vendor.bar.level", Type: "Integer"},
+		Sysprop{Module: "vendor.bar.Dup", Owner: "Vendor", Name: "vendor.bar.level", Type: "String"},
+		Sysprop{Module: "vendor.bar.Prefix", Owner: "Vendor", Name: "vendor.bar.", Type: "String"})
+	generated, err := Generate(sysprops, map[string]string{
+		"Platform": "u:object_r:system_prop:s0",
+		"Vendor":   "u:object_r:vendor_default_prop:s0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ro.adb.secure has an exact entry with another context, and the vendor.foo properties are
+	// covered by a prefix entry.
+	handwritten, err := ParseContexts(strings.NewReader(`# comment
+ro.adb.secure u:object_r:build_prop:s0 exact bool
+vendor.foo.mode   u:object_r:vendor_default_prop:s0 exact
+vendor.f   u:object_r:vendor_f_prop:s0
+vendor.foo.   u:object_r:vendor_foo_prop:s0
+vendor.bar.level.max u:object_r:vendor_bar_prop:s0
+`), "property_contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lookups follow property_info: an exact entry first, then the longest prefix.
+	l := newLabels(handwritten)
+	for _, tc := range []struct {
+		entry    Entry
+		expected string
+	}{
+		{Entry{Name: "vendor.foo.mode", Match: Exact}, "property_contexts:3"},
+		{Entry{Name: "vendor.foo.ids", Match: Exact}, "property_contexts:5"},
+		{Entry{Name: "vendor.foo.", Match: Prefix}, "property_contexts:5"},
+		{Entry{Name: "vendor.fo", Match: Prefix}, "property_contexts:4"},
+		{Entry{Name: "vendor.bar.level", Match: Exact}, ""},
+		{Entry{Name: "vendor.bar.", Match: Prefix}, ""},
+	} {
+		e, _ := l.lookup(tc.entry)
+		if e.Source != tc.expected {
+			t.Errorf("%s %s: expected the entry from %q, got %q", tc.entry.Name, tc.entry.Match, tc.expected, e.Source)
+		}
+	}
+
+	added, conflicts := Merge(handwritten, generated)
+	var actual []string
+	for _, e := range added {
+		actual = append(actual, e.String())
+	}
+	expected := []string{
+		"vendor.bar.level u:object_r:vendor_default_prop:s0 exact int",
+		"vendor.bar. u:object_r:vendor_default_prop:s0 prefix string",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// Only entries generated for an unlabeled property can conflict.
+	actual = nil
+	for _, c := range conflicts {
+		actual = append(actual, c.String())
+	}
+	expected = []string{
+		`vendor.bar.level: "vendor.bar.level u:object_r:vendor_default_prop:s0 exact string" from vendor.bar.Dup ` +
+			`conflicts with "vendor.bar.level u:object_r:vendor_default_prop:s0 exact int" from vendor.bar.BarProperties`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// Only the sysprops of owners with a context are generated.
+	vendor, err := Generate(sysprops, map[string]string{"Vendor": "u:object_r:vendor_default_prop:s0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vendor) != len(sysprops)-1 {
+		t.Errorf("expected the vendor sysprops only, got %v", vendor)
+	}
+	if _, err := Generate([]Sysprop{{Owner: "Vendor", Name: "vendor.x", Type: "Enum"}},
+		map[string]string{"Vendor": "u:object_r:vendor_default_prop:s0"}); err == nil {
+		t.Error("expected an error for an enum without values")
+	}
+	if _, err := ParseContexts(strings.NewReader("foo u:object_r:foo:s0 sometimes\n"), "bad"); err == nil {
+		t.Error("expected an error for an invalid match kind")
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package propctx
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Sysprop is a property of a sysprop_library API file.
+type Sysprop struct {
+	// Module is the sysprop module declaring the property, e.g. "android.sysprop.AdbProperties".
+	Module string
+
+	// Owner is Platform, Vendor or Odm.
+	Owner string
+
+	// Name is the name of the system property, e.g. "ro.adb.secure".
+	Name string
+
+	// Type is the sysprop type, e.g. "Boolean", "Enum" or "StringList".
+	Type string
+
+	// EnumValues are the values of an Enum or EnumList property.
+	EnumValues []string
+}
+
+// field is a field of a text format protocol buffer message. Message is nil for scalar fields.
+type field struct {
+	name    string
+	value   string
+	message []field
+	line    int
+}
+
+type textProtoParser struct {
+	data []byte
+	pos  int
+	line int
+	name string
+}
+
+func (p *textProtoParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.name, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *textProtoParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',' || c == ';':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '+' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *textProtoParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentChar(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// value parses a scalar value: an identifier, a number or a quoted string.
+func (p *textProtoParser) value() (string, error) {
+	if p.pos >= len(p.data) {
+		return "", p.errorf("expected a value")
+	}
+	quote := p.data[p.pos]
+	if quote != '"' && quote != '\'' {
+		v := p.ident()
+		if v == "" {
+			return "", p.errorf("unexpected %q", p.data[p.pos])
+		}
+		return v, nil
+	}
+	start := p.pos
+	for p.pos++; p.pos < len(p.data) && p.data[p.pos] != quote; p.pos++ {
+		if p.data[p.pos] == '\\' {
+			p.pos++
+		} else if p.data[p.pos] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+	}
+	if p.pos >= len(p.data) {
+		return "", p.errorf("unterminated string")
+	}
+	p.pos++
+	text := string(p.data[start:p.pos])
+	if quote == '\'' {
+		text = `"` + strings.ReplaceAll(text[1:len(text)-1], `"`, `\"`) + `"`
+	}
+	v, err := strconv.Unquote(text)
+	if err != nil {
+		return "", p.errorf("invalid string %s", text)
+	}
+	return v, nil
+}
+
+// message parses fields until the end of the file, or until '}' if nested.
+func (p *textProtoParser) message(nested bool) ([]field, error) {
+	var ret []field
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			if nested {
+				return nil, p.errorf("missing '}'")
+			}
+			return ret, nil
+		}
+		if p.data[p.pos] == '}' {
+			if !nested {
+				return nil, p.errorf("unexpected '}'")
+			}
+			p.pos++
+			return ret, nil
+		}
+
+		f := field{name: p.ident(), line: p.line}
+		if f.name == "" {
+			return nil, p.errorf("expected a field name, got %q", p.data[p.pos])
+		}
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ':' {
+			p.pos++
+			p.skipSpace()
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == '{' {
+			p.pos++
+			m, err := p.message(true)
+			if err != nil {
+				return nil, err
+			}
+			f.message = m
+			if f.message == nil {
+				f.message = []field{}
+			}
+		} else {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			f.value = v
+		}
+		ret = append(ret, f)
+	}
+}
+
+// ParseSyspropApi parses a sysprop_library API file, e.g. "api/Foo-current.txt", in the text format
+// of the SyspropLibraryApis message, or of a single Properties message. name is only used in error
+// messages.
+func ParseSyspropApi(r io.Reader, name string) ([]Sysprop, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &textProtoParser{data: data, line: 1, name: name}
+	fields, err := p.message(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Sysprop
+	addProperties := func(fields []field) error {
+		// The text format leaves out fields set to their default value, which is the first value
+		// of enums: owner Platform and type Boolean.
+		module, owner := "", "Platform"
+		for _, f := range fields {
+			switch f.name {
+			case "module":
+				module = f.value
+			case "owner":
+				owner = f.value
+			}
+		}
+		for _, f := range fields {
+			if f.name != "prop" {
+				continue
+			}
+			if f.message == nil {
+				return fmt.Errorf("%s:%d: prop must be a message", name, f.line)
+			}
+			s := Sysprop{Module: module, Owner: owner, Type: "Boolean"}
+			apiName := ""
+			for _, pf := range f.message {
+				switch pf.name {
+				case "prop_name":
+					s.Name = pf.value
+				case "api_name":
+					apiName = pf.value
+				case "type":
+					s.Type = pf.value
+				case "enum_values":
+					s.EnumValues = strings.Split(pf.value, "|")
+				}
+			}
+			if s.Name == "" {
+				// Without prop_name, the API name is the property name.
+				s.Name = apiName
+			}
+			if s.Name == "" {
+				return fmt.Errorf("%s:%d: prop without prop_name", name, f.line)
+			}
+			ret = append(ret, s)
+		}
+		return nil
+	}
+
+	wrapped := false
+	for _, f := range fields {
+		if f.name == "props" && f.message != nil {
+			wrapped = true
+			if err := addProperties(f.message); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !wrapped {
+		if err := addProperties(fields); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// contextsType returns the type of a sysprop in property_contexts syntax, e.g. "bool" or
+// "enum a b c".
+func (s Sysprop) contextsType() (string, error) {
+	switch s.Type {
+	case "Boolean":
+		return "bool", nil
+	case "Integer", "Long":
+		return "int", nil
+	case "UInt", "ULong":
+		return "uint", nil
+	case "Double":
+		return "double", nil
+	case "String":
+		return "string", nil
+	case "Enum":
+		if len(s.EnumValues) == 0 {
+			return "", fmt.Errorf("enum property %q has no enum_values", s.Name)
+		}
+		return "enum " + strings.Join(s.EnumValues, " "), nil
+	}
+	if strings.HasSuffix(s.Type, "List") {
+		// Lists are stored as comma separated strings.
+		return "string", nil
+	}
+	return "", fmt.Errorf("property %q has unknown type %q", s.Name, s.Type)
+}
+
+// Generate returns a property_contexts entry for each sysprop. A property whose name ends with "."
+// is a prefix entry, any other an exact entry. The context of each entry is looked up by the owner
+// of the sysprop in ownerContexts, and sysprops of other owners are skipped.
+func Generate(sysprops []Sysprop, ownerContexts map[string]string) ([]Entry, error) {
+	var ret []Entry
+	for _, s := range sysprops {
+		context, ok := ownerContexts[s.Owner]
+		if !ok {
+			continue
+		}
+		typ, err := s.contextsType()
+		if err != nil {
+			return nil, err
+		}
+		match := Exact
+		if strings.HasSuffix(s.Name, ".") {
+			match = Prefix
+		}
+		ret = append(ret, Entry{
+			Name:    s.Name,
+			Context: context,
+			Match:   match,
+			Type:    typ,
+			Source:  s.Module,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selinux
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func init() {
+	android.RegisterModuleType("se_property_namespace", propertyNamespaceFactory)
+}
+
+// defaultPropertyNamespace is the se_property_namespace used by vendor and odm property_contexts
+// modules which don't set property_namespaces.
+const defaultPropertyNamespace = "vendor_property_namespace"
+
+var propertyNamespaceDepTag = dependencyTag{name: "property_namespace"}
+
+type propertyNamespaceRuleProperties struct {
+	// Allowed prefixes of property names, e.g. "vendor.".
+	Property_prefixes []string `json:"property_prefixes,omitempty"`
+
+	// Allowed prefixes of property contexts, e.g. "vendor_". If no rule of a device has context
+	// prefixes, contexts aren't checked.
+	Context_prefixes []string `json:"context_prefixes,omitempty"`
+
+	// The rule only applies to devices whose shipping API level is at least this level, e.g. "R".
+	Min_shipping_api_level *string `json:"min_shipping_api_level,omitempty"`
+
+	// The rule only applies to devices whose shipping API level is at most this level, e.g. "R".
+	Max_shipping_api_level *string `json:"max_shipping_api_level,omitempty"`
+
+	// The rule no longer applies from this platform security patch level on, as YYYY-MM-DD.
+	// Use this for temporary exceptions.
+	Expires *string `json:"expires,omitempty"`
+}
+
+type propertyNamespaceProperties struct {
+	// Rules of the namespace. A device may use the prefixes of every rule which applies to it.
+	Rules []propertyNamespaceRuleProperties
+}
+
+type propertyNamespaceInfo struct {
+	// PropertyPrefixes and ContextPrefixes are those of the rules which apply to the device.
+	PropertyPrefixes []string
+	ContextPrefixes  []string
+}
+
+var propertyNamespaceProviderKey = blueprint.NewProvider[propertyNamespaceInfo]()
+
+type propertyNamespace struct {
+	android.ModuleBase
+	properties propertyNamespaceProperties
+}
+
+// se_property_namespace declares the property name and context prefixes which vendor and odm
+// property_contexts may use, with rules depending on the shipping API level of the device, and
+// expiry dates. It is used by the build check of property_contexts. Its output is the JSON of
+// every rule; it isn't installed.
+func propertyNamespaceFactory() android.Module {
+	n := &propertyNamespace{}
+	n.AddProperties(&n.properties)
+	android.InitAndroidModule(n)
+	return n
+}
+
+func (n *propertyNamespace) DepsMutator(ctx android.BottomUpMutatorContext) {
+	// do nothing
+}
+
+// applies returns whether a rule applies to the device, reporting invalid rules.
+func (n *propertyNamespace) applies(ctx android.ModuleContext, rule propertyNamespaceRuleProperties) bool {
+	shippingApiLevel := ctx.DeviceConfig().ShippingApiLevel()
+	ret := true
+	if minLevel := proptools.String(rule.Min_shipping_api_level); minLevel != "" {
+		level, err := android.ApiLevelFromUser(ctx, minLevel)
+		if err != nil {
+			ctx.PropertyErrorf("rules", "invalid min_shipping_api_level %q: %s", minLevel, err)
+			return false
+		}
+		ret = ret && shippingApiLevel.GreaterThanOrEqualTo(level)
+	}
+	if maxLevel := proptools.String(rule.Max_shipping_api_level); maxLevel != "" {
+		level, err := android.ApiLevelFromUser(ctx, maxLevel)
+		if err != nil {
+			ctx.PropertyErrorf("rules", "invalid max_shipping_api_level %q: %s", maxLevel, err)
+			return false
+		}
+		ret = ret && shippingApiLevel.LessThanOrEqualTo(level)
+	}
+	if expires := proptools.String(rule.Expires); expires != "" {
+		if _, err := time.Parse("2006-01-02", expires); err != nil {
+			ctx.PropertyErrorf("rules", "invalid expires %q, expected YYYY-MM-DD", expires)
+			return false
+		}
+		// Both dates are YYYY-MM-DD, so they compare as strings. Using the security patch level
+		// rather than the current date keeps the build reproducible.
+		ret = ret && ctx.Config().PlatformSecurityPatch() < expires
+	}
+	return ret
+}
+
+func (n *propertyNamespace) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	var info propertyNamespaceInfo
+	for _, rule := range n.properties.Rules {
+		if len(rule.Property_prefixes) == 0 && len(rule.Context_prefixes) == 0 {
+			ctx.PropertyErrorf("rules", "a rule must have property_prefixes or context_prefixes")
+			continue
+		}
+		if n.applies(ctx, rule) {
+			info.PropertyPrefixes = append(info.PropertyPrefixes, rule.Property_prefixes...)
+			info.ContextPrefixes = append(info.ContextPrefixes, rule.Context_prefixes...)
+		}
+	}
+	if ctx.Failed() {
+		return
+	}
+	info.PropertyPrefixes = android.FirstUniqueStrings(info.PropertyPrefixes)
+	info.ContextPrefixes = android.FirstUniqueStrings(info.ContextPrefixes)
+	android.SetProvider(ctx, propertyNamespaceProviderKey, info)
+
+	rules := n.properties.Rules
+	if rules == nil {
+		rules = []propertyNamespaceRuleProperties{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Rules []propertyNamespaceRuleProperties `json:"rules"`
+	}{rules}, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("%s", err)
+		return
+	}
+	out := android.PathForModuleOut(ctx, ctx.ModuleName()+".json")
+	android.WriteFileRule(ctx, out, string(data))
+	ctx.SetOutputFiles(android.Paths{out}, "")
+}
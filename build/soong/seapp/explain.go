@@ -0,0 +1,267 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seapp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// UIDs of android_filesystem_config.h which libselinux uses to find the user and the app ID of a
+// process.
+const (
+	aidUserOffset             = 100000
+	aidAppStart               = 10000
+	aidSdkSandboxProcessStart = 20000
+	aidIsolatedStart          = 90000
+)
+
+// Query is an app to resolve, with the expected results if any. Queries are written as
+// seapp_contexts entries, e.g.
+//
+//	user=_app seinfo=platform name=com.android.foo isPrivApp=true targetSdkVersion=34 uid=10123 domain=priv_app
+//
+// where domain=, type= and level= are the expected results.
+type Query struct {
+	App App
+
+	// UID is the UID of the process, which gives its categories. If App.User is unspecified and
+	// uid= is specified, App.User is found from UID as libselinux does.
+	UID int
+
+	ExpectedDomain string
+	ExpectedType   string
+	ExpectedLevel  string
+
+	// Line is the line of the query, without leading and trailing spaces.
+	Line string
+
+	// Source is where the query comes from, as "file:line".
+	Source string
+}
+
+func (q *Query) set(key, value string) error {
+	var err error
+	switch strings.ToLower(key) {
+	case "issystemserver":
+		q.App.IsSystemServer, err = parseBool(key, value)
+	case "isephemeralapp":
+		q.App.IsEphemeralApp, err = parseBool(key, value)
+	case "user":
+		q.App.User = value
+	case "seinfo":
+		q.App.Seinfo = value
+	case "name":
+		q.App.Name = value
+	case "isprivapp":
+		q.App.IsPrivApp, err = parseBool(key, value)
+	case "targetsdkversion":
+		q.App.TargetSdkVersion, err = strconv.Atoi(value)
+	case "fromrunas":
+		q.App.FromRunAs, err = parseBool(key, value)
+	case "isisolatedcomputeapp":
+		q.App.IsIsolatedComputeApp, err = parseBool(key, value)
+	case "issdksandbox":
+		var b bool
+		if b, err = parseBool(key, value); b && q.App.User == "" {
+			q.App.User = "_sdksandbox"
+		}
+	case "issdksandboxaudit":
+		q.App.IsSdkSandboxAudit, err = parseBool(key, value)
+	case "issdksandboxnext":
+		q.App.IsSdkSandboxNext, err = parseBool(key, value)
+	case "uid":
+		q.UID, err = strconv.Atoi(value)
+		if err == nil && q.UID < 0 {
+			err = fmt.Errorf("uid must not be negative")
+		}
+	case "domain":
+		q.ExpectedDomain = value
+	case "type":
+		q.ExpectedType = value
+	case "level":
+		q.ExpectedLevel = value
+	default:
+		err = fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+// ParseQuery parses a query. source is only used in error messages and the result.
+func ParseQuery(text, source string) (Query, error) {
+	q := Query{Line: strings.TrimSpace(text), Source: source}
+	hasUID := false
+	for _, f := range strings.Fields(text) {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return q, fmt.Errorf("%s: expected key=value, got %q", source, f)
+		}
+		if err := q.set(key, value); err != nil {
+			return q, fmt.Errorf("%s: %s", source, err)
+		}
+		hasUID = hasUID || strings.EqualFold(key, "uid")
+	}
+	if q.App.User == "" && hasUID {
+		q.App.User = userOf(q.UID)
+	}
+	return q, nil
+}
+
+// ParseQueries parses a file of queries, one per line. Comments and empty lines are skipped. name
+// is only used in error messages and sources.
+func ParseQueries(r io.Reader, name string) ([]Query, error) {
+	var ret []Query
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		q, err := ParseQuery(text, fmt.Sprintf("%s:%d", name, line))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, q)
+	}
+	return ret, scanner.Err()
+}
+
+// userOf returns the user selector of a UID, as seapp_context_lookup() of libselinux. UIDs below
+// the first app UID are found by name on the device, so they are returned as numbers.
+func userOf(uid int) string {
+	switch appID := uid % aidUserOffset; {
+	case appID < aidAppStart:
+		return strconv.Itoa(uid)
+	case appID < aidSdkSandboxProcessStart:
+		return "_app"
+	case appID < aidIsolatedStart:
+		return "_sdksandbox"
+	}
+	return "_isolated"
+}
+
+// Level returns the MLS level given by the levelFrom= or level= of an entry to a process or the
+// files of an app with the given UID, as libselinux: levelFrom=app gives categories of the app
+// ID, levelFrom=user categories of the user, and levelFrom=all both. It returns "s0" if the entry
+// gives no level.
+func Level(e *Entry, uid int) string {
+	userID, appID := uid/aidUserOffset, uid%aidUserOffset
+	switch {
+	case appID >= aidIsolatedStart:
+		appID -= aidIsolatedStart
+	case appID >= aidSdkSandboxProcessStart:
+		appID -= aidSdkSandboxProcessStart
+	case appID >= aidAppStart:
+		appID -= aidAppStart
+	}
+	appCats := fmt.Sprintf("c%d,c%d", appID&0xff, 256+(appID>>8&0xff))
+	userCats := fmt.Sprintf("c%d,c%d", 512+(userID&0xff), 768+(userID>>8&0xff))
+
+	switch {
+	case e == nil:
+	case e.LevelFrom == "app":
+		return "s0:" + appCats
+	case e.LevelFrom == "user":
+		return "s0:" + userCats
+	case e.LevelFrom == "all":
+		return "s0:" + appCats + "," + userCats
+	case e.Level != "":
+		return e.Level
+	}
+	return "s0"
+}
+
+// Explanation is the result of resolving a query.
+type Explanation struct {
+	Query Query
+
+	// DomainEntry and TypeEntry are the entries giving the domain and the type, or nil if none
+	// does.
+	DomainEntry *Entry
+	TypeEntry   *Entry
+
+	// Level is the level of the process, and TypeLevel the level of the files of the app.
+	Level     string
+	TypeLevel string
+}
+
+// Explain resolves a query against sorted entries.
+func Explain(sorted []Entry, q Query) Explanation {
+	domain, typ := Resolve(sorted, q.App)
+	return Explanation{
+		Query:       q,
+		DomainEntry: domain,
+		TypeEntry:   typ,
+		Level:       Level(domain, q.UID),
+		TypeLevel:   Level(typ, q.UID),
+	}
+}
+
+// Domain returns the resolved domain, or an empty string if there is none.
+func (x Explanation) Domain() string {
+	if x.DomainEntry == nil {
+		return ""
+	}
+	return x.DomainEntry.Domain
+}
+
+// Type returns the resolved type, or an empty string if there is none.
+func (x Explanation) Type() string {
+	if x.TypeEntry == nil {
+		return ""
+	}
+	return x.TypeEntry.Type
+}
+
+// Mismatches returns the expected results of the query which differ from the explanation.
+func (x Explanation) Mismatches() []string {
+	var ret []string
+	check := func(what, expected, got string) {
+		if expected != "" && expected != got {
+			ret = append(ret, fmt.Sprintf("expected %s %s, got %q", what, expected, got))
+		}
+	}
+	check("domain", x.Query.ExpectedDomain, x.Domain())
+	check("type", x.Query.ExpectedType, x.Type())
+	check("level", x.Query.ExpectedLevel, x.Level)
+	return ret
+}
+
+func (x Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %q\n", x.Query.Source, x.Query.Line)
+	fmt.Fprintf(&b, "  selectors: user=%s seinfo=%s name=%s isPrivApp=%t targetSdkVersion=%d\n",
+		x.Query.App.User, x.Query.App.Seinfo, x.Query.App.Name, x.Query.App.IsPrivApp, x.Query.App.TargetSdkVersion)
+	if x.DomainEntry != nil {
+		fmt.Fprintf(&b, "  domain: %s (level %s) from %s\n", x.Domain(), x.Level, x.DomainEntry)
+	} else {
+		b.WriteString("  domain: none\n")
+	}
+	if x.TypeEntry != nil {
+		fmt.Fprintf(&b, "  type: %s (level %s) from %s\n", x.Type(), x.TypeLevel, x.TypeEntry)
+	} else {
+		b.WriteString("  type: none\n")
+	}
+	for _, m := range x.Mismatches() {
+		fmt.Fprintf(&b, "  FAIL: %s\n", m)
+	}
+	return b.String()
+}
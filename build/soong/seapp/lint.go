@@ -0,0 +1,228 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seapp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of lint findings.
+const (
+	// Dead is an entry which never gives its domain or type, because an entry with precedence
+	// matches every app it matches.
+	Dead = "dead"
+
+	// VendorShadowsPlatform is a vendor entry which has precedence over a platform entry and
+	// matches some of the apps it matches, so it overrides the platform domain or type of those
+	// apps. Vendor entries selecting packages by name= are allowed to override platform entries
+	// which don't.
+	VendorShadowsPlatform = "vendor_shadows_platform"
+
+	// SystemServerDomain is an app entry assigning a domain of the system server.
+	SystemServerDomain = "system_server_domain"
+
+	// LevelFrom is an entry whose levelFrom= breaks the MLS isolation of apps.
+	LevelFrom = "level_from"
+)
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Kind    string
+	Entry   Entry
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s: %q", f.Entry.Source, f.Kind, f.Message, f.Entry.Line)
+}
+
+// coversString returns whether a user= or name= selector matches every value other matches.
+func coversString(selector, other string) bool {
+	if selector == "" {
+		return true
+	}
+	if other == "" || (strings.HasSuffix(other, "*") && !strings.HasSuffix(selector, "*")) {
+		return false
+	}
+	return matchString(selector, strings.TrimSuffix(other, "*"))
+}
+
+func coversBool(selector, other *bool) bool {
+	return selector == nil || (other != nil && *selector == *other)
+}
+
+// overlapsString returns whether some value is matched by both user= or name= selectors.
+func overlapsString(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	aPrefix, aOk := strings.CutSuffix(a, "*")
+	bPrefix, bOk := strings.CutSuffix(b, "*")
+	switch {
+	case aOk && bOk:
+		return matchString(a, bPrefix) || matchString(b, aPrefix)
+	case aOk:
+		return matchString(a, b)
+	case bOk:
+		return matchString(b, a)
+	}
+	return strings.EqualFold(a, b)
+}
+
+func overlapsBool(a, b *bool) bool {
+	return a == nil || b == nil || *a == *b
+}
+
+// covers returns whether the input selectors of e match every app other matches.
+func covers(e, other Entry) bool {
+	return e.IsSystemServer == other.IsSystemServer &&
+		coversBool(e.IsEphemeralApp, other.IsEphemeralApp) &&
+		coversString(e.User, other.User) &&
+		(e.Seinfo == "" || strings.EqualFold(e.Seinfo, other.Seinfo)) &&
+		coversString(e.Name, other.Name) &&
+		coversBool(e.IsPrivApp, other.IsPrivApp) &&
+		e.MinTargetSdkVersion <= other.MinTargetSdkVersion &&
+		e.FromRunAs == other.FromRunAs &&
+		e.IsIsolatedComputeApp == other.IsIsolatedComputeApp &&
+		e.IsSdkSandboxAudit == other.IsSdkSandboxAudit &&
+		e.IsSdkSandboxNext == other.IsSdkSandboxNext
+}
+
+// overlaps returns whether some app is matched by the input selectors of both e and other. As
+// minTargetSdkVersion= only gives a lower bound, it never prevents an overlap.
+func overlaps(e, other Entry) bool {
+	return e.IsSystemServer == other.IsSystemServer &&
+		overlapsBool(e.IsEphemeralApp, other.IsEphemeralApp) &&
+		overlapsString(e.User, other.User) &&
+		(e.Seinfo == "" || other.Seinfo == "" || strings.EqualFold(e.Seinfo, other.Seinfo)) &&
+		overlapsString(e.Name, other.Name) &&
+		overlapsBool(e.IsPrivApp, other.IsPrivApp) &&
+		e.FromRunAs == other.FromRunAs &&
+		e.IsIsolatedComputeApp == other.IsIsolatedComputeApp &&
+		e.IsSdkSandboxAudit == other.IsSdkSandboxAudit &&
+		e.IsSdkSandboxNext == other.IsSdkSandboxNext
+}
+
+// appUsers are the users of app processes, whose categories isolate them from each other.
+var appUsers = map[string]bool{"_app": true, "_isolated": true, "_sdksandbox": true}
+
+// Lint returns the problems of entries:
+//   - entries which never give their domain or type, because an entry with precedence, with a
+//     domain or type respectively, matches every app they match;
+//   - vendor entries overriding the domain or type of some apps of a platform entry, unless
+//     only the vendor entry selects packages by name;
+//   - app entries with a domain of the system server;
+//   - entries of app users without categories, or with per-app categories for isolated
+//     processes, whose app IDs aren't app IDs.
+func Lint(entries []Entry) []Finding {
+	sorted := append([]Entry(nil), entries...)
+	Sort(sorted)
+
+	var ret []Finding
+	dead := make(map[int]bool)
+	for i, e := range sorted {
+		if e.Domain == "" && e.Type == "" {
+			continue
+		}
+		var domainBy, typeBy *Entry
+		for j := 0; j < i; j++ {
+			other := &sorted[j]
+			if !covers(*other, e) {
+				continue
+			}
+			if domainBy == nil && other.Domain != "" {
+				domainBy = other
+			}
+			if typeBy == nil && other.Type != "" {
+				typeBy = other
+			}
+		}
+		if (e.Domain != "" && domainBy == nil) || (e.Type != "" && typeBy == nil) {
+			continue
+		}
+		by := domainBy
+		if by == nil {
+			by = typeBy
+		}
+		dead[i] = true
+		ret = append(ret, Finding{
+			Kind:    Dead,
+			Entry:   e,
+			Message: fmt.Sprintf("never used, %s has precedence and matches every app it matches", by),
+		})
+	}
+
+	// Only the first platform entry overridden by a vendor entry is reported, as most vendor
+	// entries overlapping a platform entry also overlap the fallback entries below it.
+	for i, e := range sorted {
+		if !e.Vendor || dead[i] {
+			continue
+		}
+		for _, other := range sorted[i+1:] {
+			if other.Vendor || (e.Name != "" && other.Name == "") || !overlaps(e, other) {
+				continue
+			}
+			if (e.Domain != "" && other.Domain != "" && e.Domain != other.Domain) ||
+				(e.Type != "" && other.Type != "" && e.Type != other.Type) {
+				ret = append(ret, Finding{
+					Kind:    VendorShadowsPlatform,
+					Entry:   e,
+					Message: fmt.Sprintf("overrides platform entry %s for some of its apps", other),
+				})
+				break
+			}
+		}
+	}
+
+	systemServerDomains := make(map[string]Entry)
+	for _, e := range sorted {
+		if e.IsSystemServer && e.Domain != "" {
+			if _, ok := systemServerDomains[e.Domain]; !ok {
+				systemServerDomains[e.Domain] = e
+			}
+		}
+	}
+	for _, e := range sorted {
+		if ss, ok := systemServerDomains[e.Domain]; ok && !e.IsSystemServer {
+			ret = append(ret, Finding{
+				Kind:    SystemServerDomain,
+				Entry:   e,
+				Message: fmt.Sprintf("domain %s is also assigned to the system server by %s", e.Domain, ss),
+			})
+		}
+	}
+
+	for _, e := range sorted {
+		var msg string
+		switch e.LevelFrom {
+		case "", "none", "app", "all", "user":
+		default:
+			msg = fmt.Sprintf("unknown levelFrom=%s", e.LevelFrom)
+		}
+		user := strings.ToLower(e.User)
+		switch {
+		case msg != "":
+		case appUsers[user] && e.Domain != "" && (e.LevelFrom == "" || e.LevelFrom == "none") && e.Level == "":
+			msg = fmt.Sprintf("processes of user=%s get no categories, so they aren't isolated from each other", e.User)
+		case user == "_isolated" && (e.LevelFrom == "app" || e.LevelFrom == "all"):
+			msg = fmt.Sprintf("levelFrom=%s is only supported for _app and _sdksandbox users", e.LevelFrom)
+		}
+		if msg != "" {
+			ret = append(ret, Finding{Kind: LevelFrom, Entry: e, Message: msg})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,319 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seapp parses seapp_contexts files, orders their entries by the precedence libselinux
+// uses, resolves apps to entries, and lints the entries.
+package seapp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Entry is a line of a seapp_contexts file, with its input selectors and outputs.
+type Entry struct {
+	IsSystemServer bool
+
+	// IsEphemeralApp and IsPrivApp are nil if unspecified.
+	IsEphemeralApp *bool
+	IsPrivApp      *bool
+
+	// User, Seinfo and Name are empty if unspecified. User and Name are prefixes if they end with
+	// "*".
+	User   string
+	Seinfo string
+	Name   string
+
+	MinTargetSdkVersion  int
+	FromRunAs            bool
+	IsIsolatedComputeApp bool
+	IsSdkSandboxAudit    bool
+	IsSdkSandboxNext     bool
+
+	Domain    string
+	Type      string
+	LevelFrom string
+	Level     string
+
+	// Vendor is whether the entry comes from a vendor seapp_contexts file (vendor or odm), which
+	// have lower precedence than platform files (system, system_ext and product).
+	Vendor bool
+
+	// Line is the line of the entry, without leading and trailing spaces.
+	Line string
+
+	// Source is where the entry comes from, as "file:line".
+	Source string
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s: %q", e.Source, e.Line)
+}
+
+func parseBool(key, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s must be true or false, got %q", key, value)
+}
+
+func (e *Entry) set(key, value string) error {
+	var err error
+	switch strings.ToLower(key) {
+	case "issystemserver":
+		e.IsSystemServer, err = parseBool(key, value)
+	case "isephemeralapp":
+		var b bool
+		b, err = parseBool(key, value)
+		e.IsEphemeralApp = &b
+	case "isprivapp":
+		var b bool
+		b, err = parseBool(key, value)
+		e.IsPrivApp = &b
+	case "user":
+		e.User = value
+	case "seinfo":
+		e.Seinfo = value
+	case "name":
+		e.Name = value
+	case "mintargetsdkversion":
+		e.MinTargetSdkVersion, err = strconv.Atoi(value)
+		if err == nil && e.MinTargetSdkVersion < 0 {
+			err = fmt.Errorf("minTargetSdkVersion must not be negative")
+		}
+	case "fromrunas":
+		e.FromRunAs, err = parseBool(key, value)
+	case "isisolatedcomputeapp":
+		e.IsIsolatedComputeApp, err = parseBool(key, value)
+	case "issdksandboxaudit":
+		e.IsSdkSandboxAudit, err = parseBool(key, value)
+	case "issdksandboxnext":
+		e.IsSdkSandboxNext, err = parseBool(key, value)
+	case "domain":
+		e.Domain = value
+	case "type":
+		e.Type = value
+	case "levelfrom":
+		e.LevelFrom = strings.ToLower(value)
+	case "levelfromuid":
+		// Deprecated alias of levelFrom=app.
+		var b bool
+		if b, err = parseBool(key, value); b {
+			e.LevelFrom = "app"
+		}
+	case "level":
+		e.Level = value
+	default:
+		err = fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+// Parse parses a seapp_contexts file. Comments and neverallow rules are skipped. vendor is whether
+// the file is a vendor seapp_contexts file. name is only used in error messages and sources.
+func Parse(r io.Reader, name string, vendor bool) ([]Entry, error) {
+	var ret []Entry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.EqualFold(fields[0], "neverallow") {
+			continue
+		}
+		e := Entry{Vendor: vendor, Line: text, Source: fmt.Sprintf("%s:%d", name, line)}
+		for _, f := range fields {
+			key, value, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s: expected key=value, got %q", e.Source, f)
+			}
+			if err := e.set(key, value); err != nil {
+				return nil, fmt.Errorf("%s: %s", e.Source, err)
+			}
+		}
+		ret = append(ret, e)
+	}
+	return ret, scanner.Err()
+}
+
+// compareString compares user= or name= selectors as libselinux: a specified string before an
+// unspecified one, a fixed string before a prefix, and a longer prefix before a shorter one.
+func compareString(a, b string) int {
+	if (a != "") != (b != "") {
+		if a != "" {
+			return -1
+		}
+		return 1
+	}
+	if a == "" {
+		return 0
+	}
+	aPrefix, bPrefix := strings.HasSuffix(a, "*"), strings.HasSuffix(b, "*")
+	if aPrefix != bPrefix {
+		if bPrefix {
+			return -1
+		}
+		return 1
+	}
+	if aPrefix && len(a) != len(b) {
+		if len(a) > len(b) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// compareBool returns -1 if only a is true, 1 if only b is true, and 0 otherwise.
+func compareBool(a, b bool) int {
+	switch {
+	case a && !b:
+		return -1
+	case b && !a:
+		return 1
+	}
+	return 0
+}
+
+// compare compares entries as seapp_context_cmp() of libselinux: entries which compare lower
+// have precedence.
+func compare(a, b Entry) int {
+	if c := compareBool(a.IsSystemServer, b.IsSystemServer); c != 0 {
+		return c
+	}
+	if c := compareBool(a.IsEphemeralApp != nil, b.IsEphemeralApp != nil); c != 0 {
+		return c
+	}
+	if c := compareString(a.User, b.User); c != 0 {
+		return c
+	}
+	if c := compareBool(a.Seinfo != "", b.Seinfo != ""); c != 0 {
+		return c
+	}
+	if c := compareString(a.Name, b.Name); c != 0 {
+		return c
+	}
+	if c := compareBool(a.IsPrivApp != nil, b.IsPrivApp != nil); c != 0 {
+		return c
+	}
+	if a.MinTargetSdkVersion != b.MinTargetSdkVersion {
+		if a.MinTargetSdkVersion > b.MinTargetSdkVersion {
+			return -1
+		}
+		return 1
+	}
+	for _, c := range []int{
+		compareBool(a.FromRunAs, b.FromRunAs),
+		compareBool(a.IsIsolatedComputeApp, b.IsIsolatedComputeApp),
+		compareBool(a.IsSdkSandboxAudit, b.IsSdkSandboxAudit),
+		compareBool(a.IsSdkSandboxNext, b.IsSdkSandboxNext),
+		compareBool(!a.Vendor, !b.Vendor),
+	} {
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Sort sorts entries by precedence, the first entry having the highest precedence. Entries of the
+// same precedence keep their order.
+func Sort(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compare(entries[i], entries[j]) < 0
+	})
+}
+
+// App describes an app process being labeled.
+type App struct {
+	IsSystemServer bool
+	IsEphemeralApp bool
+
+	// User is "_app", "_isolated" or "_sdksandbox" for app, isolated and SDK sandbox processes,
+	// and the name of the UID otherwise.
+	User string
+
+	Seinfo               string
+	Name                 string
+	IsPrivApp            bool
+	TargetSdkVersion     int
+	FromRunAs            bool
+	IsIsolatedComputeApp bool
+	IsSdkSandboxAudit    bool
+	IsSdkSandboxNext     bool
+}
+
+// matchString matches a user= or name= selector, which is a prefix if it ends with "*".
+func matchString(selector, value string) bool {
+	if prefix, ok := strings.CutSuffix(selector, "*"); ok {
+		return len(value) >= len(prefix) && strings.EqualFold(value[:len(prefix)], prefix)
+	}
+	return strings.EqualFold(selector, value)
+}
+
+// Matches returns whether the input selectors of the entry match the app, as
+// seapp_context_lookup() of libselinux.
+func (e Entry) Matches(app App) bool {
+	switch {
+	case e.IsSystemServer != app.IsSystemServer:
+		return false
+	case e.IsEphemeralApp != nil && *e.IsEphemeralApp != app.IsEphemeralApp:
+		return false
+	case e.User != "" && !matchString(e.User, app.User):
+		return false
+	case e.Seinfo != "" && !strings.EqualFold(e.Seinfo, app.Seinfo):
+		return false
+	case e.Name != "" && (app.Name == "" || !matchString(e.Name, app.Name)):
+		return false
+	case e.IsPrivApp != nil && *e.IsPrivApp != app.IsPrivApp:
+		return false
+	case e.MinTargetSdkVersion > app.TargetSdkVersion:
+		return false
+	}
+	return e.FromRunAs == app.FromRunAs &&
+		e.IsIsolatedComputeApp == app.IsIsolatedComputeApp &&
+		e.IsSdkSandboxAudit == app.IsSdkSandboxAudit &&
+		e.IsSdkSandboxNext == app.IsSdkSandboxNext
+}
+
+// Resolve returns the entries giving the domain and the type of the app, or nil if none does.
+// Entries must be sorted. As libselinux, the domain and the type are looked up separately: entries
+// without domain= are ignored for the domain, and entries without type= for the type.
+func Resolve(sorted []Entry, app App) (domain, typ *Entry) {
+	for i := range sorted {
+		e := &sorted[i]
+		if !e.Matches(app) {
+			continue
+		}
+		if domain == nil && e.Domain != "" {
+			domain = e
+		}
+		if typ == nil && e.Type != "" {
+			typ = e
+		}
+		if domain != nil && typ != nil {
+			break
+		}
+	}
+	return domain, typ
+}
@@ -0,0 +1,220 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seapp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, text, name string, vendor bool) []Entry {
+	t.Helper()
+	entries, err := Parse(strings.NewReader(text), name, vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func lines(entries []Entry) []string {
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.Line)
+	}
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, `# comment
+neverallow isSystemServer=false domain=system_server
+isSystemServer=true domain=system_server_startup
+user=_app isPrivApp=true name=com.foo:* domain=foo_app type=privapp_data_file levelFrom=all # comment
+user=_app minTargetSdkVersion=30 levelFromUid=true domain=untrusted_app_30
+`, "seapp_contexts", false)
+	privApp := true
+	expected := []Entry{
+		{IsSystemServer: true, Domain: "system_server_startup", Line: "isSystemServer=true domain=system_server_startup", Source: "seapp_contexts:3"},
+		{User: "_app", IsPrivApp: &privApp, Name: "com.foo:*", Domain: "foo_app", Type: "privapp_data_file", LevelFrom: "all",
+			Line: "user=_app isPrivApp=true name=com.foo:* domain=foo_app type=privapp_data_file levelFrom=all", Source: "seapp_contexts:4"},
+		{User: "_app", MinTargetSdkVersion: 30, LevelFrom: "app", Domain: "untrusted_app_30",
+			Line: "user=_app minTargetSdkVersion=30 levelFromUid=true domain=untrusted_app_30", Source: "seapp_contexts:5"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	for _, text := range []string{"user", "foo=bar", "isPrivApp=yes", "minTargetSdkVersion=-1"} {
+		if _, err := Parse(strings.NewReader(text), "seapp_contexts", false); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
+
+const platform = `isSystemServer=true domain=system_server_startup
+user=system seinfo=platform domain=system_app type=system_app_data_file
+user=_app domain=untrusted_app_25 type=app_data_file levelFrom=user
+user=_app minTargetSdkVersion=30 domain=untrusted_app_30 type=app_data_file levelFrom=all
+user=_app fromRunAs=true domain=runas_app levelFrom=user
+user=_app isPrivApp=true domain=priv_app type=privapp_data_file levelFrom=user
+user=_app isPrivApp=true name=com.foo domain=foo_app type=privapp_data_file levelFrom=all
+user=_app isPrivApp=true name=com.bar* domain=bar_app type=privapp_data_file levelFrom=all
+user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user
+user=_isolated domain=isolated_app levelFrom=user
+`
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+
+	entries := append(parse(t, platform, "plat_seapp_contexts", false),
+		parse(t, `user=_app seinfo=platform domain=vendor_platform_app type=app_data_file levelFrom=user
+user=_app isPrivApp=true name=com.bar.baz domain=baz_app type=privapp_data_file levelFrom=all
+`, "vendor_seapp_contexts", true)...)
+	Sort(entries)
+	expected := []string{
+		"isSystemServer=true domain=system_server_startup",
+		"user=system seinfo=platform domain=system_app type=system_app_data_file",
+		// Platform entries before vendor entries of the same precedence.
+		"user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user",
+		"user=_app seinfo=platform domain=vendor_platform_app type=app_data_file levelFrom=user",
+		"user=_app isPrivApp=true name=com.foo domain=foo_app type=privapp_data_file levelFrom=all",
+		"user=_app isPrivApp=true name=com.bar.baz domain=baz_app type=privapp_data_file levelFrom=all",
+		"user=_app isPrivApp=true name=com.bar* domain=bar_app type=privapp_data_file levelFrom=all",
+		"user=_app isPrivApp=true domain=priv_app type=privapp_data_file levelFrom=user",
+		"user=_app minTargetSdkVersion=30 domain=untrusted_app_30 type=app_data_file levelFrom=all",
+		"user=_app fromRunAs=true domain=runas_app levelFrom=user",
+		"user=_app domain=untrusted_app_25 type=app_data_file levelFrom=user",
+		"user=_isolated domain=isolated_app levelFrom=user",
+	}
+	if got := lines(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, platform, "plat_seapp_contexts", false)
+	Sort(entries)
+	for _, tc := range []struct {
+		app         App
+		domain, typ string
+	}{
+		{App{IsSystemServer: true}, "system_server_startup", ""},
+		{App{User: "_app", TargetSdkVersion: 34}, "untrusted_app_30", "app_data_file"},
+		{App{User: "_app", TargetSdkVersion: 29}, "untrusted_app_25", "app_data_file"},
+		{App{User: "_app", TargetSdkVersion: 29, FromRunAs: true}, "runas_app", ""},
+		{App{User: "_app", Seinfo: "Platform", TargetSdkVersion: 34}, "platform_app", "app_data_file"},
+		{App{User: "_app", IsPrivApp: true, Name: "com.foo"}, "foo_app", "privapp_data_file"},
+		{App{User: "_app", IsPrivApp: true, Name: "com.foo.bar"}, "priv_app", "privapp_data_file"},
+		{App{User: "_app", IsPrivApp: true, Name: "com.barbaz"}, "bar_app", "privapp_data_file"},
+		{App{User: "system", Seinfo: "platform"}, "system_app", "system_app_data_file"},
+		{App{User: "radio"}, "", ""},
+	} {
+		domain, typ := Resolve(entries, tc.app)
+		gotDomain, gotType := "", ""
+		if domain != nil {
+			gotDomain = domain.Domain
+		}
+		if typ != nil {
+			gotType = typ.Type
+		}
+		if gotDomain != tc.domain || gotType != tc.typ {
+			t.Errorf("Resolve(%+v): expected %q %q, got %q %q", tc.app, tc.domain, tc.typ, gotDomain, gotType)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	entries := append(parse(t, platform+`user=_app isPrivApp=true name=com.foo.bar domain=foo_bar_app levelFrom=all
+user=_app isPrivApp=true name=com.bar.qux domain=qux_app type=privapp_data_file levelFrom=all
+user=_app seinfo=media domain=system_server_startup type=app_data_file levelFrom=user
+user=_app seinfo=legacy domain=legacy_app type=app_data_file
+user=_isolated seinfo=foo domain=isolated_foo levelFrom=all
+`, "plat_seapp_contexts", false),
+		parse(t, `user=_app seinfo=platform isPrivApp=true domain=vendor_priv_app type=privapp_data_file levelFrom=all
+user=_app seinfo=vendor name=com.foo domain=vendor_foo_app type=app_data_file levelFrom=all
+user=_app seinfo=vendor name=com.vendor.bar domain=vendor_bar_app type=app_data_file levelFrom=all
+user=_app minTargetSdkVersion=30 domain=vendor_untrusted_app levelFrom=all
+`, "vendor_seapp_contexts", true)...)
+	var got []string
+	for _, f := range Lint(entries) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		`vendor_seapp_contexts:4: dead: never used, plat_seapp_contexts:4: "user=_app minTargetSdkVersion=30 domain=untrusted_app_30 type=app_data_file levelFrom=all" has precedence and matches every app it matches: "user=_app minTargetSdkVersion=30 domain=vendor_untrusted_app levelFrom=all"`,
+		`vendor_seapp_contexts:2: vendor_shadows_platform: overrides platform entry plat_seapp_contexts:7: "user=_app isPrivApp=true name=com.foo domain=foo_app type=privapp_data_file levelFrom=all" for some of its apps: "user=_app seinfo=vendor name=com.foo domain=vendor_foo_app type=app_data_file levelFrom=all"`,
+		`vendor_seapp_contexts:1: vendor_shadows_platform: overrides platform entry plat_seapp_contexts:9: "user=_app seinfo=platform domain=platform_app type=app_data_file levelFrom=user" for some of its apps: "user=_app seinfo=platform isPrivApp=true domain=vendor_priv_app type=privapp_data_file levelFrom=all"`,
+		`plat_seapp_contexts:13: system_server_domain: domain system_server_startup is also assigned to the system server by plat_seapp_contexts:1: "isSystemServer=true domain=system_server_startup": "user=_app seinfo=media domain=system_server_startup type=app_data_file levelFrom=user"`,
+		`plat_seapp_contexts:14: level_from: processes of user=_app get no categories, so they aren't isolated from each other: "user=_app seinfo=legacy domain=legacy_app type=app_data_file"`,
+		`plat_seapp_contexts:15: level_from: levelFrom=all is only supported for _app and _sdksandbox users: "user=_isolated seinfo=foo domain=isolated_foo levelFrom=all"`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	entries := parse(t, platform, "plat_seapp_contexts", false)
+	Sort(entries)
+	for _, tc := range []struct {
+		query      string
+		mismatches []string
+		level      string
+		typeLevel  string
+	}{
+		{
+			query: "uid=10123 targetSdkVersion=34 domain=untrusted_app_30 type=app_data_file level=s0:c123,c256,c512,c768",
+			level: "s0:c123,c256,c512,c768", typeLevel: "s0:c123,c256,c512,c768",
+		},
+		{
+			query: "uid=1010300 isPrivApp=true name=com.foo.bar domain=priv_app",
+			level: "s0:c522,c768", typeLevel: "s0:c522,c768",
+		},
+		{
+			query: "uid=99001 domain=isolated_app",
+			level: "s0:c512,c768", typeLevel: "s0",
+		},
+		{
+			query:      "user=_app seinfo=platform isPrivApp=true domain=priv_app type=privapp_data_file",
+			mismatches: []string{`expected domain priv_app, got "platform_app"`, `expected type privapp_data_file, got "app_data_file"`},
+			level:      "s0:c512,c768", typeLevel: "s0:c512,c768",
+		},
+	} {
+		q, err := ParseQuery(tc.query, "query")
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := Explain(entries, q)
+		if !reflect.DeepEqual(x.Mismatches(), tc.mismatches) {
+			t.Errorf("%q: expected mismatches %q, got %q\n%s", tc.query, tc.mismatches, x.Mismatches(), x)
+		}
+		if x.Level != tc.level || x.TypeLevel != tc.typeLevel {
+			t.Errorf("%q: expected levels %q %q, got %q %q", tc.query, tc.level, tc.typeLevel, x.Level, x.TypeLevel)
+		}
+	}
+
+	for _, text := range []string{"uid", "foo=bar", "uid=-1", "isSdkSandbox=maybe"} {
+		if _, err := ParseQuery(text, "query"); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
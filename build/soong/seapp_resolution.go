@@ -0,0 +1,99 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selinux
+
+import (
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func init() {
+	android.RegisterModuleType("seapp_contexts_resolution_test", seappResolutionTestFactory)
+}
+
+type seappResolutionTestProperties struct {
+	// Platform seapp_contexts files, e.g. plat_seapp_contexts.
+	Srcs []string `android:"path"`
+
+	// Vendor seapp_contexts files, e.g. vendor_seapp_contexts, which have lower precedence than
+	// platform files.
+	Vendor_srcs []string `android:"path"`
+
+	// Apps to resolve, as seapp_contexts style selectors, with the UID and the expected results,
+	// e.g. "user=_app seinfo=platform isPrivApp=true uid=10123 domain=priv_app". See
+	// seapp_resolve for the keys.
+	Apps []string
+
+	// Files of apps to resolve, one per line.
+	App_files []string `android:"path"`
+}
+
+type seappResolutionTest struct {
+	android.ModuleBase
+
+	properties seappResolutionTestProperties
+	testResult android.Path
+}
+
+// seapp_contexts_resolution_test resolves apps against seapp_contexts files with the precedence
+// libselinux uses, and fails if the domain, type or level of an app isn't the expected one. The
+// explanation of every app, with the entries giving its domain and type, is the output.
+func seappResolutionTestFactory() android.Module {
+	m := &seappResolutionTest{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
+	return m
+}
+
+func (m *seappResolutionTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if len(m.properties.Srcs)+len(m.properties.Vendor_srcs) == 0 {
+		ctx.PropertyErrorf("srcs", "either srcs or vendor_srcs must be specified")
+	}
+	if len(m.properties.Apps)+len(m.properties.App_files) == 0 {
+		ctx.PropertyErrorf("apps", "either apps or app_files must be specified")
+	}
+	if ctx.Failed() {
+		return
+	}
+
+	result := pathForModuleOut(ctx, ctx.ModuleName()+".txt")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("seapp_resolve").
+		FlagForEachInput("-platform ", android.PathsForModuleSrc(ctx, m.properties.Srcs)).
+		FlagForEachInput("-vendor ", android.PathsForModuleSrc(ctx, m.properties.Vendor_srcs)).
+		FlagForEachArg("-app ", proptools.ShellEscapeList(m.properties.Apps)).
+		FlagForEachInput("-apps ", android.PathsForModuleSrc(ctx, m.properties.App_files)).
+		FlagWithOutput("-o ", result)
+	rule.Build("seapp_resolution_test", "Resolving apps with seapp_contexts: "+ctx.ModuleName())
+
+	m.testResult = result
+	ctx.SetOutputFiles(android.Paths{result}, "")
+}
+
+func (m *seappResolutionTest) AndroidMkEntries() []android.AndroidMkEntries {
+	return []android.AndroidMkEntries{android.AndroidMkEntries{
+		Class: "FAKE",
+		// OutputFile is needed, even though BUILD_PHONY_PACKAGE doesn't use it.
+		// Without OutputFile this module won't be exported to Makefile.
+		OutputFile: android.OptionalPathForPath(m.testResult),
+		Include:    "$(BUILD_PHONY_PACKAGE)",
+		ExtraEntries: []android.AndroidMkExtraEntriesFunc{
+			func(ctx android.AndroidMkExtraEntriesContext, entries *android.AndroidMkEntries) {
+				entries.SetString("LOCAL_ADDITIONAL_DEPENDENCIES", m.testResult.String())
+			},
+		},
+	}}
+}
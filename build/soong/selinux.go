@@ -16,6 +16,7 @@ package selinux
 
 import (
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
 )
@@ -50,3 +51,36 @@ func flagsToM4Macros(flags map[string]string) []string {
 	}
 	return flagMacros
 }
+
+// neverallowCheck returns whether secilc should ignore neverallows, and the neverallow allowlist
+// to check ignored violations against. ignoreNeverallow and allowlist are the ignore_neverallow
+// and neverallow_allowlist properties of the module. Setting an allowlist ignores neverallows
+// except for violations missing from the allowlist, unless SELINUX_IGNORE_NEVERALLOWS ignores all
+// of them.
+func neverallowCheck(ctx android.ModuleContext, ignoreNeverallow *bool, allowlist *string) (bool, android.Path) {
+	if allowlist == nil {
+		return proptools.BoolDefault(ignoreNeverallow, ctx.Config().SelinuxIgnoreNeverallows()), nil
+	}
+	if proptools.Bool(ignoreNeverallow) {
+		ctx.PropertyErrorf("neverallow_allowlist", "can't be set with ignore_neverallow")
+	}
+	path := android.PathForModuleSrc(ctx, *allowlist)
+	if ctx.Config().SelinuxIgnoreNeverallows() {
+		return true, nil
+	}
+	return true, path
+}
+
+// wrapSecilcWithLedger prefixes cmd with secilc_diagnostics, which runs secilc with -N and writes
+// the neverallow violations it ignored to ledger. The build fails on violations missing from
+// allowlist, if given. The secilc command must follow, without -N.
+func wrapSecilcWithLedger(cmd *android.RuleBuilderCommand, diagnostics, ledger android.WritablePath, allowlist android.Path) {
+	cmd.BuiltTool("secilc_diagnostics").
+		FlagWithOutput("-o ", diagnostics).
+		Flag("-ignore_neverallow").
+		FlagWithOutput("-ledger ", ledger)
+	if allowlist != nil {
+		cmd.FlagWithInput("-allowlist ", allowlist)
+	}
+	cmd.Text("--")
+}
@@ -32,7 +32,12 @@ type selinuxContextsProperties struct {
 	// Output file name. Defaults to module name
 	Stem *string
 
+	// Files added to srcs under conditions on the build configuration: sanitizers, coverage
+	// modes, build variants or Soong config variables.
+	Conditional_srcs []conditionalSrcsProperties
+
 	Product_variables struct {
+		// Deprecated: use conditional_srcs with sanitizers: ["address"].
 		Address_sanitize struct {
 			Srcs []string `android:"path"`
 		}
@@ -46,6 +51,18 @@ type selinuxContextsProperties struct {
 
 	// Make this module available when building for recovery
 	Recovery_available *bool
+
+	// Changes to the srcs of the recovery variant of a recovery_available module. By default the
+	// recovery variant reuses the output of the core variant. With an overlay, it is built from
+	// srcs without exclude_srcs, followed by the srcs of the overlay, and its difference with the
+	// core variant is reported in the ".recovery_diff" output.
+	Recovery_overlay struct {
+		// Files appended to srcs for recovery.
+		Srcs []string `android:"path"`
+
+		// Files of srcs which aren't used for recovery.
+		Exclude_srcs []string `android:"path"`
+	}
 }
 
 type seappProperties struct {
@@ -54,6 +71,31 @@ type seappProperties struct {
 
 	// Precompiled sepolicy binary file which will be fed to checkseapp.
 	Sepolicy *string `android:"path"`
+
+	// Platform seapp_contexts files which the entries of this module are linted against, e.g. the
+	// platform seapp_contexts modules for a vendor seapp_contexts module. See seapp_lint.
+	Lint_platform_srcs []string `android:"path"`
+
+	// Whether seapp_lint findings fail the build. Defaults to false: findings are only written to
+	// the report, which is the ".lint" output of this module.
+	Lint_fatal *bool
+}
+
+type propertyContextsProperties struct {
+	// Whether to generate property_contexts entries for the properties of sysprop_library APIs
+	// owned by the partition of this module: Platform, Vendor or Odm. Generated entries are
+	// appended to srcs for the properties which srcs doesn't label, by an exact entry or a prefix
+	// entry, and entries generated differently for the same property are errors.
+	Generate_from_sysprop *bool
+
+	// Context of the generated entries. Defaults to u:object_r:system_prop:s0, or to
+	// u:object_r:vendor_default_prop:s0 for vendor and odm property_contexts.
+	Sysprop_context *string
+
+	// se_property_namespace modules declaring the property name and context prefixes that vendor
+	// and odm property_contexts may use. The prefixes of every module are allowed. Defaults to
+	// vendor_property_namespace.
+	Property_namespaces []string
 }
 
 type selinuxContextsModule struct {
@@ -61,12 +103,13 @@ type selinuxContextsModule struct {
 	android.DefaultableModuleBase
 	flaggableModuleBase
 
-	properties      selinuxContextsProperties
-	seappProperties seappProperties
-	build           func(ctx android.ModuleContext, inputs android.Paths) android.Path
-	deps            func(ctx android.BottomUpMutatorContext)
-	outputPath      android.Path
-	installPath     android.InstallPath
+	properties                 selinuxContextsProperties
+	seappProperties            seappProperties
+	propertyContextsProperties propertyContextsProperties
+	build                      func(ctx android.ModuleContext, inputs android.Paths) android.Path
+	deps                       func(ctx android.BottomUpMutatorContext)
+	outputPath                 android.Path
+	installPath                android.InstallPath
 }
 
 var _ flaggableModule = (*selinuxContextsModule)(nil)
@@ -77,8 +120,6 @@ var (
 )
 
 func init() {
-	pctx.HostBinToolVariable("fc_sort", "fc_sort")
-
 	android.RegisterModuleType("contexts_defaults", contextsDefaultsFactory)
 	android.RegisterModuleType("file_contexts", fileFactory)
 	android.RegisterModuleType("hwservice_contexts", hwServiceFactory)
@@ -93,6 +134,8 @@ func init() {
 	android.RegisterModuleType("hwservice_contexts_test", hwserviceContextsTestFactory)
 	android.RegisterModuleType("service_contexts_test", serviceContextsTestFactory)
 	android.RegisterModuleType("vndservice_contexts_test", vndServiceContextsTestFactory)
+	android.RegisterModuleType("keystore2_key_contexts_test", keystoreKeyContextsTestFactory)
+	android.RegisterModuleType("seapp_contexts_test", seappContextsTestFactory)
 }
 
 func (m *selinuxContextsModule) InstallInRoot() bool {
@@ -127,6 +170,13 @@ func (m *selinuxContextsModule) propertyContextsDeps(ctx android.BottomUpMutator
 	for _, lib := range sysprop.SyspropLibraries(ctx.Config()) {
 		ctx.AddFarVariationDependencies([]blueprint.Variation{}, syspropLibraryDepTag, lib)
 	}
+	if ctx.SocSpecific() || ctx.DeviceSpecific() {
+		namespaces := m.propertyContextsProperties.Property_namespaces
+		if namespaces == nil {
+			namespaces = []string{defaultPropertyNamespace}
+		}
+		ctx.AddFarVariationDependencies([]blueprint.Variation{}, propertyNamespaceDepTag, namespaces...)
+	}
 }
 
 func (m *selinuxContextsModule) stem() string {
@@ -145,6 +195,10 @@ func (m *selinuxContextsModule) GenerateAndroidBuildActions(ctx android.ModuleCo
 		dep := ctx.GetDirectDepWithTag(m.Name(), reuseContextsDepTag)
 
 		if reuseDeps, ok := dep.(*selinuxContextsModule); ok {
+			if m.hasRecoveryOverlay() {
+				m.buildRecoveryOverlay(ctx, reuseDeps.outputPath)
+				return
+			}
 			m.outputPath = reuseDeps.outputPath
 			ctx.InstallFile(m.installPath, m.stem(), m.outputPath)
 			return
@@ -157,11 +211,42 @@ func (m *selinuxContextsModule) GenerateAndroidBuildActions(ctx android.ModuleCo
 	ctx.SetOutputFiles([]android.Path{m.outputPath}, "")
 }
 
+func (m *selinuxContextsModule) hasRecoveryOverlay() bool {
+	overlay := m.properties.Recovery_overlay
+	return len(overlay.Srcs) > 0 || len(overlay.Exclude_srcs) > 0
+}
+
+// buildRecoveryOverlay builds the recovery variant from srcs and the recovery overlay, and reports
+// its difference with the output of the core variant.
+func (m *selinuxContextsModule) buildRecoveryOverlay(ctx android.ModuleContext, coreOutput android.Path) {
+	overlay := m.properties.Recovery_overlay
+	inputs := android.PathsForModuleSrcExcludes(ctx, m.properties.Srcs, overlay.Exclude_srcs)
+	inputs = append(inputs, android.PathsForModuleSrc(ctx, overlay.Srcs)...)
+	m.outputPath = m.build(ctx, inputs)
+	ctx.InstallFile(m.installPath, m.stem(), m.outputPath)
+
+	diff := pathForModuleOut(ctx, m.stem()+"_recovery_diff.txt")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("( diff").
+		Flag("-u").
+		Input(coreOutput).
+		Input(m.outputPath).
+		Text(">").
+		Output(diff).
+		Text("|| true )") // diff fails if the files differ
+	rule.Build("recovery_diff", "Comparing recovery contexts with core: "+ctx.ModuleName())
+
+	ctx.SetOutputFiles([]android.Path{m.outputPath}, "")
+	ctx.SetOutputFiles(android.Paths{diff}, ".recovery_diff")
+}
+
 func newModule() *selinuxContextsModule {
 	m := &selinuxContextsModule{}
 	m.AddProperties(
 		&m.properties,
 		&m.seappProperties,
+		&m.propertyContextsProperties,
 	)
 	initFlaggableModule(m)
 	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
@@ -186,6 +271,7 @@ func contextsDefaultsFactory() android.Module {
 	m.AddProperties(
 		&selinuxContextsProperties{},
 		&seappProperties{},
+		&propertyContextsProperties{},
 		&flaggableModuleProperties{},
 	)
 	android.InitDefaultsModule(m)
@@ -193,17 +279,14 @@ func contextsDefaultsFactory() android.Module {
 }
 
 func (m *selinuxContextsModule) selinuxContextsHook(ctx android.LoadHookContext) {
-	// TODO: clean this up to use build/soong/android/variable.go after b/79249983
-	var srcs []string
-
-	for _, sanitize := range ctx.Config().SanitizeDevice() {
-		if sanitize == "address" {
-			srcs = append(srcs, m.properties.Product_variables.Address_sanitize.Srcs...)
-			break
-		}
+	conditionalSrcs := m.properties.Conditional_srcs
+	if asanSrcs := m.properties.Product_variables.Address_sanitize.Srcs; len(asanSrcs) > 0 {
+		conditionalSrcs = append(conditionalSrcs, conditionalSrcsProperties{
+			Sanitizers: []string{"address"},
+			Srcs:       asanSrcs,
+		})
 	}
-
-	m.properties.Srcs = append(m.properties.Srcs, srcs...)
+	m.properties.Srcs = append(m.properties.Srcs, selectConditionalSrcs(ctx, "conditional_srcs", conditionalSrcs)...)
 }
 
 func (m *selinuxContextsModule) AndroidMk() android.AndroidMkData {
@@ -229,6 +312,9 @@ func (m *selinuxContextsModule) ImageMutatorBegin(ctx android.BaseModuleContext)
 		ctx.PropertyErrorf("recovery_available",
 			"doesn't make sense at the same time as `recovery: true`")
 	}
+	if m.hasRecoveryOverlay() && !proptools.Bool(m.properties.Recovery_available) {
+		ctx.PropertyErrorf("recovery_overlay", "requires `recovery_available: true`")
+	}
 }
 
 func (m *selinuxContextsModule) VendorVariantNeeded(ctx android.BaseModuleContext) bool {
@@ -285,9 +371,10 @@ func (m *selinuxContextsModule) buildGeneralContexts(ctx android.ModuleContext,
 
 	flags := m.getBuildFlags(ctx)
 	rule.Command().
-		Tool(ctx.Config().PrebuiltBuildTool(ctx, "m4")).
-		Text("--fatal-warnings -s").
-		FlagForEachArg("-D", ctx.DeviceConfig().SepolicyM4Defs()).
+		BuiltTool("sepolicy_m4").
+		Flag("--fatal-warnings").
+		Flag("-s").
+		FlagForEachArg("-D ", ctx.DeviceConfig().SepolicyM4Defs()).
 		Flags(flagsToM4Macros(flags)).
 		Inputs(inputsWithNewline).
 		FlagWithOutput("> ", builtContext)
@@ -309,11 +396,16 @@ func (m *selinuxContextsModule) buildGeneralContexts(ctx android.ModuleContext,
 		rule.Temporary(builtContext)
 
 		sorted_output := pathForModuleOut(ctx, ctx.ModuleName()+"_sorted")
+		shadowed := pathForModuleOut(ctx, ctx.ModuleName()+"_shadowed.txt")
 
 		rule.Command().
-			Tool(ctx.Config().HostToolPath(ctx, "fc_sort")).
+			BuiltTool("fc_sort").
 			FlagWithInput("-i ", builtContext).
-			FlagWithOutput("-o ", sorted_output)
+			FlagWithOutput("-o ", sorted_output).
+			FlagWithOutput("-shadowed ", shadowed)
+
+		// The entries which are never used because a more specific entry matches first.
+		ctx.SetOutputFiles(android.Paths{shadowed}, ".shadowed")
 
 		builtContext = sorted_output
 	}
@@ -350,45 +442,20 @@ func (m *selinuxContextsModule) buildServiceContexts(ctx android.ModuleContext,
 }
 
 func (m *selinuxContextsModule) checkVendorPropertyNamespace(ctx android.ModuleContext, input android.Path) android.Path {
-	shippingApiLevel := ctx.DeviceConfig().ShippingApiLevel()
-	ApiLevelR := android.ApiLevelOrPanic(ctx, "R")
-
 	rule := android.NewRuleBuilder(pctx, ctx)
 
-	// This list is from vts_treble_sys_prop_test.
-	allowedPropertyPrefixes := []string{
-		"ctl.odm.",
-		"ctl.vendor.",
-		"ctl.start$odm.",
-		"ctl.start$vendor.",
-		"ctl.stop$odm.",
-		"ctl.stop$vendor.",
-		"init.svc.odm.",
-		"init.svc.vendor.",
-		"ro.boot.",
-		"ro.hardware.",
-		"ro.odm.",
-		"ro.vendor.",
-		"odm.",
-		"persist.odm.",
-		"persist.vendor.",
-		"vendor.",
-	}
-
-	// persist.camera is also allowed for devices launching with R or eariler
-	if shippingApiLevel.LessThanOrEqualTo(ApiLevelR) {
-		allowedPropertyPrefixes = append(allowedPropertyPrefixes, "persist.camera.")
-	}
-
-	var allowedContextPrefixes []string
-
-	if shippingApiLevel.GreaterThanOrEqualTo(ApiLevelR) {
-		// This list is from vts_treble_sys_prop_test.
-		allowedContextPrefixes = []string{
-			"vendor_",
-			"odm_",
+	var allowedPropertyPrefixes, allowedContextPrefixes []string
+	ctx.VisitDirectDepsWithTag(propertyNamespaceDepTag, func(c android.Module) {
+		info, ok := android.OtherModuleProvider(ctx, c, propertyNamespaceProviderKey)
+		if !ok {
+			ctx.PropertyErrorf("property_namespaces", "%q is not an se_property_namespace module", ctx.OtherModuleName(c))
+			return
 		}
-	}
+		allowedPropertyPrefixes = append(allowedPropertyPrefixes, info.PropertyPrefixes...)
+		allowedContextPrefixes = append(allowedContextPrefixes, info.ContextPrefixes...)
+	})
+	allowedPropertyPrefixes = android.FirstUniqueStrings(allowedPropertyPrefixes)
+	allowedContextPrefixes = android.FirstUniqueStrings(allowedContextPrefixes)
 
 	cmd := rule.Command().
 		BuiltTool("check_prop_prefix").
@@ -406,17 +473,32 @@ func (m *selinuxContextsModule) checkVendorPropertyNamespace(ctx android.ModuleC
 	return out
 }
 
+// generateFromSysprop appends property_contexts entries for the sysprops of apiFiles owned by the
+// partition of the module to input, for the properties which input doesn't label.
+func (m *selinuxContextsModule) generateFromSysprop(ctx android.ModuleContext, input android.Path, apiFiles android.Paths) android.Path {
+	owner, context := "Platform", "u:object_r:system_prop:s0"
+	if ctx.SocSpecific() {
+		owner, context = "Vendor", "u:object_r:vendor_default_prop:s0"
+	} else if ctx.DeviceSpecific() {
+		owner, context = "Odm", "u:object_r:vendor_default_prop:s0"
+	}
+	context = proptools.StringDefault(m.propertyContextsProperties.Sysprop_context, context)
+
+	out := pathForModuleOut(ctx, ctx.ModuleName()+"_sysprop_generated")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("sysprop_contexts").
+		FlagForEachInput("-api ", apiFiles).
+		FlagWithArg("-owner_context ", owner+"="+context).
+		FlagWithInput("-contexts ", input).
+		FlagWithOutput("-o ", out)
+	rule.Build("property_contexts_sysprop", "generating property_contexts from sysprop: "+m.Name())
+	return out
+}
+
 func (m *selinuxContextsModule) buildPropertyContexts(ctx android.ModuleContext, inputs android.Paths) android.Path {
-	// vendor/odm properties are enforced for devices launching with Android Q or later. So, if
-	// vendor/odm, make sure that only vendor/odm properties exist.
 	builtCtxFile := m.buildGeneralContexts(ctx, inputs)
 
-	shippingApiLevel := ctx.DeviceConfig().ShippingApiLevel()
-	ApiLevelQ := android.ApiLevelOrPanic(ctx, "Q")
-	if (ctx.SocSpecific() || ctx.DeviceSpecific()) && shippingApiLevel.GreaterThanOrEqualTo(ApiLevelQ) {
-		builtCtxFile = m.checkVendorPropertyNamespace(ctx, builtCtxFile)
-	}
-
 	var apiFiles android.Paths
 	ctx.VisitDirectDepsWithTag(syspropLibraryDepTag, func(c android.Module) {
 		i, ok := c.(interface{ CurrentSyspropApiFile() android.OptionalPath })
@@ -428,6 +510,18 @@ func (m *selinuxContextsModule) buildPropertyContexts(ctx android.ModuleContext,
 		}
 	})
 
+	if proptools.Bool(m.propertyContextsProperties.Generate_from_sysprop) {
+		builtCtxFile = m.generateFromSysprop(ctx, builtCtxFile, apiFiles)
+	}
+
+	// vendor/odm properties are enforced for devices launching with Android Q or later. So, if
+	// vendor/odm, make sure that only vendor/odm properties exist.
+	shippingApiLevel := ctx.DeviceConfig().ShippingApiLevel()
+	ApiLevelQ := android.ApiLevelOrPanic(ctx, "Q")
+	if (ctx.SocSpecific() || ctx.DeviceSpecific()) && shippingApiLevel.GreaterThanOrEqualTo(ApiLevelQ) {
+		builtCtxFile = m.checkVendorPropertyNamespace(ctx, builtCtxFile)
+	}
+
 	// check compatibility with sysprop_library
 	if len(apiFiles) > 0 {
 		out := pathForModuleOut(ctx, ctx.ModuleName()+"_api_checked")
@@ -472,9 +566,9 @@ func (m *selinuxContextsModule) buildSeappContexts(ctx android.ModuleContext, in
 	m4NeverallowFile := pathForModuleOut(ctx, "neverallow.m4out")
 	rule := android.NewRuleBuilder(pctx, ctx)
 	rule.Command().
-		Tool(ctx.Config().PrebuiltBuildTool(ctx, "m4")).
+		BuiltTool("sepolicy_m4").
 		Flag("--fatal-warnings").
-		FlagForEachArg("-D", ctx.DeviceConfig().SepolicyM4Defs()).
+		FlagForEachArg("-D ", ctx.DeviceConfig().SepolicyM4Defs()).
 		Flags(flagsToM4Macros(flags)).
 		Inputs(android.PathsForModuleSrc(ctx, m.seappProperties.Neverallow_files)).
 		FlagWithOutput("> ", m4NeverallowFile)
@@ -504,7 +598,22 @@ func (m *selinuxContextsModule) buildSeappContexts(ctx android.ModuleContext, in
 		checkCmd.Flag("-c") // check coredomain for vendor contexts
 	}
 
+	// Step 4. seapp_lint
+	lintReport := pathForModuleOut(ctx, m.stem()+"_lint.txt")
+	lintCmd := rule.Command().BuiltTool("seapp_lint")
+	if ctx.SocSpecific() || ctx.DeviceSpecific() {
+		lintCmd.FlagWithInput("-vendor ", builtCtx)
+	} else {
+		lintCmd.FlagWithInput("-platform ", builtCtx)
+	}
+	lintCmd.FlagForEachInput("-platform ", android.PathsForModuleSrc(ctx, m.seappProperties.Lint_platform_srcs)).
+		FlagWithOutput("-o ", lintReport)
+	if proptools.Bool(m.seappProperties.Lint_fatal) {
+		lintCmd.Flag("-fatal")
+	}
+
 	rule.Build("seapp_contexts", "Building seapp_contexts: "+m.Name())
+	ctx.SetOutputFiles(android.Paths{lintReport}, ".lint")
 	return ret
 }
 
@@ -562,6 +671,25 @@ type contextsTestProperties struct {
 type fileContextsTestProperties struct {
 	// Test data. File passed to `checkfc -t` to validate how contexts are resolved.
 	Test_data *string `android:"path"`
+
+	// If true, srcs are the file_contexts files of every partition, in the order the device loads
+	// them, and the test fails on entries which can never match a path, e.g. because an entry of
+	// another partition is checked first and matches every path they match, and on entries whose
+	// file type contradicts the file type of a broader entry. sepolicy and test_data are optional.
+	Check_shadowing *bool
+
+	// A filesystem manifest of an image: a path and a file type per line, e.g. the output of
+	// `find . -printf '%P %y\n'` in its staging directory. Every path is labeled with srcs, merged
+	// as in check_shadowing, and the test fails if a path under /vendor or /odm is unlabeled or
+	// gets one of labeling_disallowed_types. sepolicy and test_data are optional.
+	Labeling_manifest *string `android:"path"`
+
+	// Directory of the relative paths of labeling_manifest, e.g. "/vendor". Defaults to "/".
+	Labeling_root *string
+
+	// Types which paths under /vendor and /odm must not get. Defaults to default_file and
+	// unlabeled.
+	Labeling_disallowed_types []string
 }
 
 type contextsTestModule struct {
@@ -572,7 +700,7 @@ type contextsTestModule struct {
 
 	properties     contextsTestProperties
 	fileProperties fileContextsTestProperties
-	testTimestamp  android.OutputPath
+	testResult     android.OutputPath
 }
 
 type contextType int
@@ -583,8 +711,63 @@ const (
 	ServiceContext
 	HwServiceContext
 	VndServiceContext
+	KeystoreKeyContext
+	SeappContext
 )
 
+// contextTypeInfo describes how contexts files of a type are tested against a policy.
+type contextTypeInfo struct {
+	// Name of the contexts files, e.g. "file_contexts", in test results.
+	name string
+
+	// The checker, run as `tool flags... sepolicy srcs...`.
+	tool  string
+	flags []string
+
+	// If set, adds the commands testing srcs against sepolicy to rule instead of tool. The last
+	// command must be created with newCheck, which returns a contexts_check command writing the
+	// test result.
+	check func(ctx android.ModuleContext, rule *android.RuleBuilder, newCheck func() *android.RuleBuilderCommand,
+		sepolicy android.Path, srcs android.Paths)
+}
+
+var contextTypes = map[contextType]contextTypeInfo{
+	FileContext:     {name: "file_contexts", tool: "checkfc"},
+	PropertyContext: {name: "property_contexts", tool: "property_info_checker"},
+	ServiceContext:  {name: "service_contexts", tool: "checkfc", flags: []string{"-s" /* binder services */}},
+	HwServiceContext: {name: "hwservice_contexts", tool: "checkfc",
+		flags: []string{"-e" /* allow empty */, "-l" /* hwbinder services */}},
+	VndServiceContext: {name: "vndservice_contexts", tool: "checkfc",
+		flags: []string{"-e" /* allow empty */, "-v" /* vnd service */}},
+	KeystoreKeyContext: {name: "keystore2_key_contexts", check: checkKeystoreKeyContexts},
+	SeappContext:       {name: "seapp_contexts", check: checkSeappContexts},
+}
+
+// checkKeystoreKeyContexts checks that namespaces are unique, and that contexts have types with
+// the keystore2_key_type attribute.
+func checkKeystoreKeyContexts(ctx android.ModuleContext, rule *android.RuleBuilder,
+	newCheck func() *android.RuleBuilderCommand, sepolicy android.Path, srcs android.Paths) {
+	keyTypes := pathForModuleOut(ctx, "keystore2_key_types.txt")
+	rule.Command().BuiltTool("sepolicy-analyze").
+		Input(sepolicy).
+		Text("attribute keystore2_key_type").
+		FlagWithOutput("> ", keyTypes)
+	rule.Temporary(keyTypes)
+	newCheck().FlagWithInput("-keystore2_key_types ", keyTypes)
+}
+
+// checkSeappContexts checks srcs with checkseapp.
+func checkSeappContexts(ctx android.ModuleContext, rule *android.RuleBuilder,
+	newCheck func() *android.RuleBuilderCommand, sepolicy android.Path, srcs android.Paths) {
+	merged := pathForModuleOut(ctx, "seapp_contexts")
+	newCheck().Text("--").
+		BuiltTool("checkseapp").
+		FlagWithInput("-p ", sepolicy).
+		FlagWithOutput("-o ", merged).
+		Inputs(srcs)
+	rule.Temporary(merged)
+}
+
 // checkfc parses a context file and checks for syntax errors.
 // If -s is specified, the service backend is used to verify binder services.
 // If -l is specified, the service backend is used to verify hwbinder services.
@@ -633,21 +816,40 @@ func vndServiceContextsTestFactory() android.Module {
 	return m
 }
 
+// keystore2_key_contexts_test tests given keystore2_key_contexts files: namespaces must be unique,
+// and the types of contexts must have the keystore2_key_type attribute in sepolicy.
+func keystoreKeyContextsTestFactory() android.Module {
+	m := &contextsTestModule{context: KeystoreKeyContext}
+	m.AddProperties(&m.properties)
+	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
+	return m
+}
+
+// seapp_contexts_test tests given seapp_contexts files with checkseapp.
+func seappContextsTestFactory() android.Module {
+	m := &contextsTestModule{context: SeappContext}
+	m.AddProperties(&m.properties)
+	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
+	return m
+}
+
 func (m *contextsTestModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
-	tool := "checkfc"
-	if m.context == PropertyContext {
-		tool = "property_info_checker"
-	}
+	info := contextTypes[m.context]
 
 	if len(m.properties.Srcs) == 0 {
 		ctx.PropertyErrorf("srcs", "can't be empty")
 		return
 	}
 
+	checkShadowing := m.context == FileContext && proptools.Bool(m.fileProperties.Check_shadowing)
+	labelingManifest := ""
+	if m.context == FileContext {
+		labelingManifest = proptools.String(m.fileProperties.Labeling_manifest)
+	}
 	validateWithPolicy := true
 	if proptools.String(m.properties.Sepolicy) == "" {
 		if m.context == FileContext {
-			if proptools.String(m.fileProperties.Test_data) == "" {
+			if proptools.String(m.fileProperties.Test_data) == "" && !checkShadowing && labelingManifest == "" {
 				ctx.PropertyErrorf("test_data", "Either test_data or sepolicy should be provided")
 				return
 			}
@@ -658,40 +860,70 @@ func (m *contextsTestModule) GenerateAndroidBuildActions(ctx android.ModuleConte
 		}
 	}
 
-	flags := []string(nil)
-	switch m.context {
-	case FileContext:
-		if !validateWithPolicy {
-			flags = []string{"-t"}
-		}
-	case ServiceContext:
-		flags = []string{"-s" /* binder services */}
-	case HwServiceContext:
-		flags = []string{"-e" /* allow empty */, "-l" /* hwbinder services */}
-	case VndServiceContext:
-		flags = []string{"-e" /* allow empty */, "-v" /* vnd service */}
-	}
-
 	srcs := android.PathsForModuleSrc(ctx, m.properties.Srcs)
 	rule := android.NewRuleBuilder(pctx, ctx)
 
+	// The result lists the failing entries of the checkers, and is written even if they fail.
+	m.testResult = pathForModuleOut(ctx, "result.json")
+	var check *android.RuleBuilderCommand
+	newCheck := func() *android.RuleBuilderCommand {
+		check = rule.Command().BuiltTool("contexts_check").
+			FlagWithArg("-module ", ctx.ModuleName()).
+			FlagWithArg("-contexts ", info.name).
+			FlagForEachInput("-src ", srcs).
+			FlagWithOutput("-o ", m.testResult)
+		return check
+	}
+
 	if validateWithPolicy {
 		sepolicy := android.PathForModuleSrc(ctx, proptools.String(m.properties.Sepolicy))
-		rule.Command().BuiltTool(tool).
-			Flags(flags).
-			Input(sepolicy).
-			Inputs(srcs)
-	} else {
+		if info.check != nil {
+			info.check(ctx, rule, newCheck, sepolicy, srcs)
+		} else {
+			newCheck().Text("--").
+				BuiltTool(info.tool).
+				Flags(info.flags).
+				Input(sepolicy).
+				Inputs(srcs)
+		}
+	} else if proptools.String(m.fileProperties.Test_data) != "" {
 		test_data := android.PathForModuleSrc(ctx, proptools.String(m.fileProperties.Test_data))
-		rule.Command().BuiltTool(tool).
-			Flags(flags).
+		newCheck().Text("--").
+			BuiltTool(info.tool).
+			Flag("-t").
 			Inputs(srcs).
 			Input(test_data)
+	} else {
+		// Only the checkers below.
+		newCheck()
+	}
+
+	// fc_shadowing and fc_labeling are further checkers of contexts_check, so that their findings
+	// are failures of the test result. Their reports are separate outputs.
+	if checkShadowing {
+		report := pathForModuleOut(ctx, "shadowing.txt")
+		check.Text("--").
+			BuiltTool("fc_shadowing").
+			FlagForEachInput("-i ", srcs).
+			FlagWithOutput("-o ", report)
+		ctx.SetOutputFiles(android.Paths{report}, ".shadowing")
 	}
 
-	m.testTimestamp = pathForModuleOut(ctx, "timestamp")
-	rule.Command().Text("touch").Output(m.testTimestamp)
+	if labelingManifest != "" {
+		report := pathForModuleOut(ctx, "labeling.txt")
+		check.Text("--").
+			BuiltTool("fc_labeling").
+			FlagForEachInput("-i ", srcs).
+			FlagWithInput("-manifest ", android.PathForModuleSrc(ctx, labelingManifest)).
+			FlagWithArg("-root ", proptools.StringDefault(m.fileProperties.Labeling_root, "/")).
+			FlagForEachArg("-disallowed_type ", m.fileProperties.Labeling_disallowed_types).
+			FlagWithOutput("-o ", report)
+		ctx.SetOutputFiles(android.Paths{report}, ".labeling")
+	}
+
+	rule.DeleteTemporaryFiles()
 	rule.Build("contexts_test", "running contexts test: "+ctx.ModuleName())
+	ctx.SetOutputFiles(android.Paths{m.testResult}, "")
 }
 
 func (m *contextsTestModule) AndroidMkEntries() []android.AndroidMkEntries {
@@ -699,11 +931,11 @@ func (m *contextsTestModule) AndroidMkEntries() []android.AndroidMkEntries {
 		Class: "FAKE",
 		// OutputFile is needed, even though BUILD_PHONY_PACKAGE doesn't use it.
 		// Without OutputFile this module won't be exported to Makefile.
-		OutputFile: android.OptionalPathForPath(m.testTimestamp),
+		OutputFile: android.OptionalPathForPath(m.testResult),
 		Include:    "$(BUILD_PHONY_PACKAGE)",
 		ExtraEntries: []android.AndroidMkExtraEntriesFunc{
 			func(ctx android.AndroidMkExtraEntriesContext, entries *android.AndroidMkEntries) {
-				entries.SetString("LOCAL_ADDITIONAL_DEPENDENCIES", m.testTimestamp.String())
+				entries.SetString("LOCAL_ADDITIONAL_DEPENDENCIES", m.testResult.String())
 			},
 		},
 	}}
@@ -16,9 +16,13 @@ package selinux
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/google/blueprint/proptools"
+
 	"android/soong/android"
 )
 
@@ -27,6 +31,8 @@ func TestMain(m *testing.M) {
 }
 
 var prepareForTest = android.GroupFixturePreparers(
+	android.PrepareForTestWithArchMutator,
+	android.PrepareForTestWithDefaults,
 	android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
 		buildFlags := make(map[string]string)
 		buildFlags["RELEASE_FLAGS_BAR"] = "true"
@@ -38,9 +44,62 @@ var prepareForTest = android.GroupFixturePreparers(
 	android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
 		ctx.RegisterModuleType("se_flags", flagsFactory)
 		ctx.RegisterModuleType("se_flags_collector", flagsCollectorFactory)
+		ctx.RegisterModuleType("se_policy_conf", policyConfFactory)
+		ctx.RegisterModuleType("se_policy_cil", policyCilFactory)
+		ctx.RegisterModuleType("se_policy_binary", policyBinaryFactory)
+		ctx.RegisterModuleType("se_versioned_policy", versionedPolicyFactory)
+		ctx.RegisterModuleType("se_neverallow_test", neverallowTestFactory)
+		ctx.RegisterModuleType("se_property_namespace", propertyNamespaceFactory)
+		ctx.RegisterModuleType("se_merged_contexts", mergedContextsFactory)
+		ctx.RegisterModuleType("file_contexts", fileFactory)
+		ctx.RegisterModuleType("property_contexts", propertyFactory)
+		ctx.RegisterModuleType("seapp_contexts", seappFactory)
+		ctx.RegisterModuleType("file_contexts_test", fileContextsTestFactory)
+		ctx.RegisterModuleType("hwservice_contexts_test", hwserviceContextsTestFactory)
+		ctx.RegisterModuleType("keystore2_key_contexts_test", keystoreKeyContextsTestFactory)
+		ctx.RegisterModuleType("seapp_contexts_test", seappContextsTestFactory)
+		ctx.RegisterModuleType("seapp_contexts_resolution_test", seappResolutionTestFactory)
 	}),
 )
 
+// hasInput returns whether params reads path, given relative to the source tree or as the last
+// elements of an intermediate path.
+func hasInput(params android.TestingBuildParams, path string) bool {
+	return hasPath(append(append(android.Paths(nil), params.Inputs...), params.Implicits...), path)
+}
+
+// hasOutput returns whether params writes path, given as the last elements of an intermediate
+// path.
+func hasOutput(params android.TestingBuildParams, path string) bool {
+	var outputs android.Paths
+	if params.Output != nil {
+		outputs = append(outputs, params.Output)
+	}
+	for _, p := range params.ImplicitOutputs {
+		outputs = append(outputs, p)
+	}
+	return hasPath(outputs, path)
+}
+
+func hasPath(paths android.Paths, path string) bool {
+	for _, p := range paths {
+		if s := p.String(); s == path || strings.HasSuffix(s, "/"+path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTool returns whether params runs the host tool named tool.
+func hasTool(params android.TestingBuildParams, tool string) bool {
+	for _, dep := range params.RuleParams.CommandDeps {
+		if filepath.Base(dep) == tool {
+			return true
+		}
+	}
+	return false
+}
+
 func TestFlagCollector(t *testing.T) {
 	t.Parallel()
 
@@ -94,3 +153,1331 @@ func TestFlagCollector(t *testing.T) {
 		)
 	}
 }
+
+func TestFindPolicyConfOrder(t *testing.T) {
+	t.Parallel()
+
+	entries := []policyConfOrderEntry{
+		{patterns: []string{"te_macros"}, rank: 100},
+		{patterns: []string{"attributes", "*.te"}, rank: 130},
+		{patterns: []string{"vendor_macros"}, rank: 105},
+		{patterns: []string{"*_debug.te"}, rank: 200},
+	}
+	testCases := []struct {
+		name    string
+		rank    int
+		matched bool
+	}{
+		{"te_macros", 100, true},
+		{"attributes", 130, true},
+		{"init.te", 130, true},
+		{"vendor_macros", 105, true},
+		{"init_debug.te", 200, true},
+		{"unknown", 0, false},
+	}
+	for _, tc := range testCases {
+		rank, matched := findPolicyConfOrder(entries, tc.name)
+		if rank != tc.rank || matched != tc.matched {
+			t.Errorf("%s: expected (%d, %t), got (%d, %t)", tc.name, tc.rank, tc.matched, rank, matched)
+		}
+	}
+}
+
+func TestPolicyConfMacros(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		props    string
+		eng      bool
+		expected map[string]string
+
+		// Expected provenance of macros, checked through policyConfInfo.
+		provenance map[string]string
+	}{
+		{
+			name: "default",
+			expected: map[string]string{
+				"target_build_variant":       "user",
+				"target_full_treble":         "true",
+				"target_compatible_property": "true",
+				"target_recovery":            "false",
+				"target_exclude_build_test":  "false",
+			},
+			provenance: map[string]string{
+				"target_build_variant":             "default",
+				"target_arch":                      "DeviceArch",
+				"target_treble_sysprop_neverallow": "BuildBrokenTrebleSyspropNeverallow",
+				"target_board_api_level":           "RELEASE_BOARD_API_LEVEL",
+			},
+		},
+		{
+			name: "eng",
+			eng:  true,
+			expected: map[string]string{
+				"target_build_variant": "eng",
+			},
+			provenance: map[string]string{
+				"target_build_variant": "Eng",
+			},
+		},
+		{
+			name:  "build_variant",
+			props: `build_variant: "userdebug", exclude_build_test: true,`,
+			eng:   true,
+			expected: map[string]string{
+				"target_build_variant":      "userdebug",
+				"target_exclude_build_test": "true",
+			},
+			provenance: map[string]string{
+				"target_build_variant":      "property:build_variant",
+				"target_exclude_build_test": "property:exclude_build_test",
+			},
+		},
+		{
+			name:  "cts",
+			props: `cts: true,`,
+			expected: map[string]string{
+				"target_full_treble":                 "cts",
+				"target_compatible_property":         "cts",
+				"target_treble_sysprop_neverallow":   "cts",
+				"target_enforce_sysprop_owner":       "cts",
+				"target_enforce_debugfs_restriction": "cts",
+			},
+			provenance: map[string]string{
+				"target_treble_sysprop_neverallow":   "property:cts",
+				"target_enforce_debugfs_restriction": "property:cts",
+			},
+		},
+		{
+			name:  "recovery",
+			props: `target_recovery: true,`,
+			expected: map[string]string{
+				"target_full_treble":               "false",
+				"target_compatible_property":       "false",
+				"target_treble_sysprop_neverallow": "false",
+				"target_enforce_sysprop_owner":     "false",
+				"target_recovery":                  "true",
+			},
+			provenance: map[string]string{
+				"target_full_treble": "property:target_recovery",
+				"target_recovery":    "property:target_recovery",
+			},
+		},
+		{
+			name:  "board api level",
+			props: `board_api_level: "202404", mls_cats: 256,`,
+			expected: map[string]string{
+				"target_board_api_level": "202404",
+				"mls_num_cats":           "256",
+			},
+			provenance: map[string]string{
+				"target_board_api_level": "property:board_api_level",
+				"mls_num_cats":           "property:mls_cats",
+				"mls_num_sens":           "default",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+					variables.Eng = proptools.BoolPtr(tc.eng)
+				}),
+				android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+					se_policy_conf {
+						name: "test.conf",
+						srcs: ["public/foo.te"],
+						`+tc.props+`
+					}
+					`),
+			).RunTest(t).TestContext
+
+			conf := ctx.ModuleForTests("test.conf", "android_common").Module().(*policyConf)
+			actual := make(map[string]string)
+			for _, m := range conf.macros {
+				actual[m.Name] = m.Value
+			}
+			for name, value := range tc.expected {
+				if actual[name] != value {
+					t.Errorf("expected %s=%s, got %q", name, value, actual[name])
+				}
+			}
+
+			info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), conf, policyConfProviderKey)
+			if !ok {
+				t.Fatalf("expected test.conf to provide policyConfInfo")
+			}
+			provenance := make(map[string]string)
+			for _, m := range info.Macros {
+				provenance[m.Name] = m.Provenance
+			}
+			for name, expected := range tc.provenance {
+				if provenance[name] != expected {
+					t.Errorf("expected provenance of %s to be %q, got %q", name, expected, provenance[name])
+				}
+			}
+			if info.MacrosFile == nil || info.MacrosFile.Base() != "test.conf.macros.json" {
+				t.Errorf("expected macros file test.conf.macros.json, got %v", info.MacrosFile)
+			}
+		})
+	}
+}
+
+func TestPolicyConfVariants(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_conf {
+				name: "test.conf",
+				srcs: ["public/foo.te"],
+				variants: ["user", "eng"],
+			}
+			se_policy_cil {
+				name: "test.cil",
+				src: ":test.conf",
+			}
+			se_policy_cil {
+				name: "test_eng.cil",
+				src: ":test.conf{eng}",
+			}
+			se_policy_binary {
+				name: "test_policy",
+				srcs: [":test.cil{user}"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	conf := ctx.ModuleForTests("test.conf", "android_common").Module()
+	info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), conf, policyConfProviderKey)
+	if !ok {
+		t.Fatalf("expected test.conf to provide policyConfInfo")
+	}
+	if keys := android.SortedKeys(info.Variants); !reflect.DeepEqual(keys, []string{"eng", "user"}) {
+		t.Errorf("expected variants [eng user], got %q", keys)
+	}
+	for variant, outputs := range info.Variants {
+		for _, m := range outputs.Macros {
+			if m.Name == "target_build_variant" && (m.Value != variant || m.Provenance != "property:variants") {
+				t.Errorf("expected %s conf to have target_build_variant=%s from variants, got %+v", variant, variant, m)
+			}
+		}
+	}
+
+	// Each variant is compiled both by the se_policy_cil taking all variants and by the one
+	// taking a single variant.
+	cil := ctx.ModuleForTests("test.cil", "android_common")
+	for _, variant := range []string{"user", "eng"} {
+		if params := cil.Output(variant + "/test.cil"); !hasInput(params, variant+"/test.conf") {
+			t.Errorf("expected %s/test.cil to be compiled from %s/test.conf, got inputs %q", variant, variant, params.Implicits)
+		}
+	}
+	if params := ctx.ModuleForTests("test_eng.cil", "android_common").Output("test_eng.cil"); !hasInput(params, "eng/test.conf") {
+		t.Errorf("expected test_eng.cil to be compiled from eng/test.conf, got inputs %q", params.Implicits)
+	}
+	if params := ctx.ModuleForTests("test_policy", "android_common").Rule("secilc"); !hasInput(params, "user/test.cil") || hasInput(params, "eng/test.cil") {
+		t.Errorf("expected test_policy to be compiled from user/test.cil only, got inputs %q", params.Implicits)
+	}
+}
+
+func TestPolicyConfVariantsErrors(t *testing.T) {
+	t.Parallel()
+
+	android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_conf {
+				name: "test.conf",
+				srcs: ["public/foo.te"],
+				variants: ["user", "debug", "user"],
+			}
+			`),
+	).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+		`unknown build variant "debug"`,
+		`duplicate build variant "user"`,
+	})).RunTest(t)
+}
+
+func TestPolicyConfWarnUndefinedMacros(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_conf {
+				name: "test.conf",
+				srcs: ["public/foo.te"],
+			}
+			se_policy_conf {
+				name: "test_warn.conf",
+				srcs: ["public/foo.te"],
+				warn_undefined_macros: true,
+			}
+			`),
+	).RunTest(t).TestContext
+
+	for module, expected := range map[string]bool{"test.conf": false, "test_warn.conf": true} {
+		cmd := ctx.ModuleForTests(module, "android_common").Rule("conf").RuleParams.Command
+		if actual := strings.Contains(cmd, "-warn_undefined"); actual != expected {
+			t.Errorf("%s: expected -warn_undefined %t, got command %q", module, expected, cmd)
+		}
+	}
+}
+
+func TestPolicyBinaryPermissiveDomains(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		debuggable bool
+		props      string
+		contains   []string
+		excludes   []string
+	}{
+		{
+			name:     "user",
+			props:    `permissive_domains_on_user_builds: ["su"],`,
+			contains: []string{"ERROR: permissive domains not allowed in user builds", "-e su"},
+		},
+		{
+			name:       "debuggable without budget",
+			debuggable: true,
+			excludes:   []string{"ERROR:"},
+		},
+		{
+			name:       "debuggable with budget",
+			debuggable: true,
+			props:      `max_permissive_domains_on_debuggable: 3,`,
+			contains:   []string{"ERROR: more than 3 permissive domains on debuggable builds", "-gt 3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+					variables.Debuggable = proptools.BoolPtr(tc.debuggable)
+				}),
+				android.FixtureAddFile("system/sepolicy/plat.cil", nil),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+					se_policy_binary {
+						name: "test_policy",
+						srcs: ["plat.cil"],
+						`+tc.props+`
+					}
+					`),
+			).RunTest(t).TestContext
+
+			m := ctx.ModuleForTests("test_policy", "android_common")
+			info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), m.Module(), policyBinaryProviderKey)
+			if !ok || info.PermissiveDomains == nil || info.PermissiveDomains.Base() != "test_policy_permissive.txt" {
+				t.Errorf("expected test_policy_permissive.txt in policyBinaryInfo, got %+v", info)
+			}
+			rule := m.Rule("secilc")
+			if !hasTool(rule, "sepolicy-analyze") || !hasOutput(rule, "test_policy_permissive.txt") {
+				t.Errorf("expected permissive domains to be listed on every build, got tools %q and outputs %q",
+					rule.RuleParams.CommandDeps, rule.ImplicitOutputs)
+			}
+			cmd := rule.RuleParams.Command
+			if strings.Contains(cmd, "permissive |") {
+				t.Errorf("expected failures of sepolicy-analyze not to be hidden by a pipe, got %q", cmd)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(cmd, s) {
+					t.Errorf("expected %q in command %q", s, cmd)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(cmd, s) {
+					t.Errorf("unexpected %q in command %q", s, cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyBinaryDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat.cil", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_binary {
+				name: "test_policy",
+				srcs: ["plat.cil"],
+				ignore_neverallow: true,
+			}
+			`),
+	).RunTest(t).TestContext
+
+	m := ctx.ModuleForTests("test_policy", "android_common")
+	info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), m.Module(), policyBinaryProviderKey)
+	if !ok || info.Diagnostics == nil || info.Diagnostics.Base() != "test_policy_diagnostics.json" {
+		t.Errorf("expected test_policy_diagnostics.json in policyBinaryInfo, got %+v", info)
+	}
+	rule := m.Rule("secilc")
+	if !hasTool(rule, "secilc_diagnostics") || !hasOutput(rule, "test_policy_diagnostics.json") ||
+		!hasOutput(rule, "test_policy_neverallow_ledger.txt") {
+		t.Errorf("expected secilc to be wrapped by secilc_diagnostics writing a ledger, got tools %q and outputs %q",
+			rule.RuleParams.CommandDeps, rule.ImplicitOutputs)
+	}
+	if cmd := rule.RuleParams.Command; !strings.Contains(cmd, "-ignore_neverallow") || strings.Contains(cmd, " -N") {
+		t.Errorf("expected -N to be passed by secilc_diagnostics -ignore_neverallow rather than the module, got %q", cmd)
+	}
+}
+
+func TestNeverallowAllowlist(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"system/sepolicy/plat.conf":     nil,
+			"system/sepolicy/plat.cil":      nil,
+			"system/sepolicy/allowlist.txt": nil,
+			"system/sepolicy/base.cil":      nil,
+			"system/sepolicy/vendor.cil":    nil,
+			"system/sepolicy/dependent.cil": nil,
+		}),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_cil {
+				name: "test.cil",
+				src: "plat.conf",
+				neverallow_allowlist: "allowlist.txt",
+			}
+			se_policy_binary {
+				name: "test_policy",
+				srcs: ["plat.cil"],
+				neverallow_allowlist: "allowlist.txt",
+			}
+			se_versioned_policy {
+				name: "test_versioned.cil",
+				base: "base.cil",
+				target_policy: "vendor.cil",
+				version: "30.0",
+				dependent_cils: ["dependent.cil"],
+				neverallow_allowlist: "allowlist.txt",
+			}
+			`),
+	).RunTest(t).TestContext
+
+	for _, tc := range []struct {
+		module string
+		rule   string
+	}{
+		{"test.cil", "cil"},
+		{"test_policy", "secilc"},
+		{"test_versioned.cil", "mapping"},
+	} {
+		rule := ctx.ModuleForTests(tc.module, "android_common").Rule(tc.rule)
+		if !hasTool(rule, "secilc_diagnostics") || !hasInput(rule, "system/sepolicy/allowlist.txt") ||
+			!hasOutput(rule, tc.module+"_neverallow_ledger.txt") {
+			t.Errorf("%s: expected secilc to check ignored neverallows against the allowlist, got inputs %q and outputs %q",
+				tc.module, rule.Implicits, rule.ImplicitOutputs)
+		}
+		if cmd := rule.RuleParams.Command; strings.Contains(cmd, " -N") {
+			t.Errorf("%s: expected -N to be passed by secilc_diagnostics rather than the module, got %q", tc.module, cmd)
+		}
+	}
+}
+
+func TestNeverallowAllowlistWithIgnoreNeverallow(t *testing.T) {
+	t.Parallel()
+
+	android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"system/sepolicy/plat.conf":     nil,
+			"system/sepolicy/plat.cil":      nil,
+			"system/sepolicy/allowlist.txt": nil,
+		}),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_policy_binary {
+				name: "test_policy",
+				srcs: ["plat.cil"],
+				ignore_neverallow: true,
+				neverallow_allowlist: "allowlist.txt",
+			}
+			se_policy_cil {
+				name: "test.cil",
+				src: "plat.conf",
+				secilc_check: false,
+				neverallow_allowlist: "allowlist.txt",
+			}
+			`),
+	).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+		`neverallow_allowlist: can't be set with ignore_neverallow`,
+		`neverallow_allowlist: can't be set with secilc_check: false`,
+	})).RunTest(t)
+}
+
+// neverallowTestSourceMap returns the source map of the sepolicy-analyze conf of the
+// se_neverallow_test module named name.
+func neverallowTestSourceMap(t *testing.T, ctx *android.TestContext, name string) android.Path {
+	t.Helper()
+	conf := ctx.ModuleForTests(name+".sepolicy_analyze.conf", "android_common").Module()
+	info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), conf, policyConfProviderKey)
+	if !ok || info.SourceMap == nil {
+		t.Fatalf("expected %s.sepolicy_analyze.conf to provide a source map", name)
+	}
+	return info.SourceMap
+}
+
+func TestNeverallowTestGroups(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_neverallow_test {
+				name: "test_neverallow",
+				srcs: ["public/foo.te"],
+				groups: [
+					{
+						name: "vendor",
+						patterns: ["vendor/", "device/*/sepolicy/*.te"],
+					},
+				],
+				non_blocking_groups: ["vendor"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	m := ctx.ModuleForTests("test_neverallow", "")
+	rule := m.Rule("neverallow_sepolicy-analyze")
+	for _, tool := range []string{"neverallow_groups", "sepolicy-analyze"} {
+		if !hasTool(rule, tool) {
+			t.Errorf("expected %s to be a tool of the check, got tools %q", tool, rule.RuleParams.CommandDeps)
+		}
+	}
+	if sourceMap := neverallowTestSourceMap(t, ctx, "test_neverallow"); !android.InList(sourceMap.String(), rule.Implicits.Strings()) {
+		t.Errorf("expected the source map %s to be an input, got %q", sourceMap, rule.Implicits)
+	}
+	if !hasOutput(rule, "neverallow_test_results.xml") {
+		t.Errorf("expected the check to write neverallow_test_results.xml, got outputs %q", rule.ImplicitOutputs)
+	}
+	cmd := rule.RuleParams.Command
+	for _, s := range []string{
+		"-group 'vendor=vendor/,device/*/sepolicy/*.te'",
+		"-non_blocking vendor",
+		"-suite test_neverallow",
+	} {
+		if !strings.Contains(cmd, s) {
+			t.Errorf("expected %q in command %q", s, cmd)
+		}
+	}
+}
+
+func TestNeverallowCoverage(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_neverallow_test {
+				name: "test_neverallow",
+				srcs: ["public/foo.te"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	m := ctx.ModuleForTests("test_neverallow", "")
+	if rule := m.Rule("neverallow_decompile"); !hasTool(rule, "checkpolicy") || !hasOutput(rule, "policy.cil") {
+		t.Errorf("expected the policy to be decompiled to policy.cil, got outputs %q", rule.Output)
+	}
+	rule := m.Rule("neverallow_coverage")
+	if !hasTool(rule, "neverallow_coverage") {
+		t.Errorf("expected neverallow_coverage to run, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	for _, input := range []string{"policy.cil", "test_neverallow.sepolicy_analyze.conf"} {
+		if !hasInput(rule, input) {
+			t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+		}
+	}
+	if sourceMap := neverallowTestSourceMap(t, ctx, "test_neverallow"); !android.InList(sourceMap.String(), rule.Implicits.Strings()) {
+		t.Errorf("expected the source map %s to be an input, got %q", sourceMap, rule.Implicits)
+	}
+	for _, output := range []string{"neverallow_coverage.txt", "neverallow_coverage.json"} {
+		if !hasOutput(rule, output) {
+			t.Errorf("expected %s to be an output, got %q", output, rule.ImplicitOutputs)
+		}
+	}
+}
+
+func TestNeverallowTestCache(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		props      string
+		env        map[string]string
+		expectFull bool
+	}{
+		{name: "default"},
+		{name: "property", props: "full_check: true,", expectFull: true},
+		{name: "env", env: map[string]string{"SELINUX_NEVERALLOW_FULL_CHECK": "true"}, expectFull: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.FixtureMergeEnv(tc.env),
+				android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+					se_neverallow_test {
+						name: "test_neverallow",
+						srcs: ["public/foo.te"],
+						`+tc.props+`
+					}
+					`),
+			).RunTest(t).TestContext
+
+			m := ctx.ModuleForTests("test_neverallow", "")
+			rule := m.Rule("neverallow_sepolicy-analyze")
+			if !hasInput(rule, "policy.cil") || !hasOutput(rule, "neverallow_cache.txt") {
+				t.Errorf("expected the cache to be written from policy.cil, got inputs %q and outputs %q",
+					rule.Implicits, rule.ImplicitOutputs)
+			}
+
+			// The cache of the previous build is read from the output, without depending on it.
+			cache := m.Output("neverallow_cache.txt").Output.String()
+			if hasInput(rule, "neverallow_cache.txt") {
+				t.Errorf("expected the cache not to be an input, got inputs %q", rule.Implicits)
+			}
+			if cmd := rule.RuleParams.Command; !strings.Contains(cmd, "-cache "+cache+" ") {
+				t.Errorf("expected the cache of the previous build %s to be read, got command %q", cache, cmd)
+			}
+			if full := strings.Contains(rule.RuleParams.Command, " -full "); full != tc.expectFull {
+				t.Errorf("expected -full %t, got command %q", tc.expectFull, rule.RuleParams.Command)
+			}
+		})
+	}
+}
+
+func TestPropertyContextsGenerateFromSysprop(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		props    string
+		expected string
+	}{
+		{
+			name:     "default context",
+			expected: "-owner_context Platform=u:object_r:system_prop:s0",
+		},
+		{
+			name:     "sysprop_context",
+			props:    `sysprop_context: "u:object_r:exported_system_prop:s0",`,
+			expected: "-owner_context Platform=u:object_r:exported_system_prop:s0",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.PrepareForTestWithAndroidBuildComponents,
+				android.FixtureAddFile("system/sepolicy/private/property_contexts", nil),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+					property_contexts {
+						name: "test_property_contexts",
+						srcs: ["private/property_contexts"],
+						generate_from_sysprop: true,
+						`+tc.props+`
+					}
+					`),
+			).RunTest(t).TestContext
+
+			rule := ctx.ModuleForTests("test_property_contexts", "android_common").Rule("property_contexts_sysprop")
+			if !hasTool(rule, "sysprop_contexts") || !hasInput(rule, "test_property_contexts_m4out") ||
+				!hasOutput(rule, "test_property_contexts_sysprop_generated") {
+				t.Errorf("expected sysprop_contexts to generate entries from the built contexts, got inputs %q and outputs %q",
+					rule.Implicits, rule.Output)
+			}
+			if cmd := rule.RuleParams.Command; !strings.Contains(cmd, tc.expected) {
+				t.Errorf("expected %q in command %q", tc.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestPropertyNamespace(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		shippingApiLevel string
+		propertyPrefixes []string
+		contextPrefixes  []string
+	}{
+		{
+			name:             "Q",
+			shippingApiLevel: "29",
+			propertyPrefixes: []string{"vendor.", "persist.camera.", "acme."},
+		},
+		{
+			name:             "S",
+			shippingApiLevel: "31",
+			propertyPrefixes: []string{"vendor.", "acme."},
+			contextPrefixes:  []string{"vendor_"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+					variables.Shipping_api_level = proptools.StringPtr(tc.shippingApiLevel)
+					variables.Platform_security_patch = proptools.StringPtr("2026-03-05")
+				}),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+					se_property_namespace {
+						name: "test_namespace",
+						rules: [
+							{
+								property_prefixes: ["vendor."],
+							},
+							{
+								property_prefixes: ["persist.camera."],
+								max_shipping_api_level: "R",
+							},
+							{
+								context_prefixes: ["vendor_"],
+								min_shipping_api_level: "R",
+							},
+							{
+								property_prefixes: ["acme."],
+								expires: "2026-06-01",
+							},
+							{
+								property_prefixes: ["expired."],
+								expires: "2026-03-01",
+							},
+						],
+					}
+					`),
+			).RunTest(t).TestContext
+
+			m := ctx.ModuleForTests("test_namespace", "")
+			info, ok := android.OtherModuleProvider(ctx.OtherModuleProviderAdaptor(), m.Module(), propertyNamespaceProviderKey)
+			if !ok {
+				t.Fatal("se_property_namespace must provide propertyNamespaceInfo")
+			}
+			if !reflect.DeepEqual(info.PropertyPrefixes, tc.propertyPrefixes) {
+				t.Errorf("expected property prefixes %q, got %q", tc.propertyPrefixes, info.PropertyPrefixes)
+			}
+			if !reflect.DeepEqual(info.ContextPrefixes, tc.contextPrefixes) {
+				t.Errorf("expected context prefixes %q, got %q", tc.contextPrefixes, info.ContextPrefixes)
+			}
+			content := android.ContentFromFileRuleForTests(t, ctx, m.Output("test_namespace.json"))
+			for _, s := range []string{`"max_shipping_api_level": "R"`, `"expires": "2026-03-01"`} {
+				if !strings.Contains(content, s) {
+					t.Errorf("expected %q in %s", s, content)
+				}
+			}
+		})
+	}
+}
+
+func TestPropertyNamespaceErrors(t *testing.T) {
+	t.Parallel()
+
+	android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_property_namespace {
+				name: "test_namespace",
+				rules: [
+					{
+						min_shipping_api_level: "R",
+					},
+					{
+						property_prefixes: ["acme."],
+						expires: "June",
+					},
+				],
+			}
+			`),
+	).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+		`a rule must have property_prefixes or context_prefixes`,
+		`invalid expires "June"`,
+	})).RunTest(t)
+}
+
+func TestFileContextsFcSort(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/private/file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts {
+				name: "test_file_contexts",
+				srcs: ["private/file_contexts"],
+				fc_sort: true,
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_file_contexts", "android_common").Rule("selinux_contexts")
+	if !hasTool(rule, "fc_sort") || !hasOutput(rule, "test_file_contexts_shadowed.txt") {
+		t.Errorf("expected fc_sort to report shadowed entries, got tools %q and outputs %q",
+			rule.RuleParams.CommandDeps, rule.ImplicitOutputs)
+	}
+}
+
+// contextsCheckCommand returns the contexts_check command of the command of a contexts_test rule.
+func contextsCheckCommand(cmd string) string {
+	for _, c := range strings.Split(cmd, " && ") {
+		if strings.Contains(c, "contexts_check ") {
+			return c
+		}
+	}
+	return ""
+}
+
+func TestFileContextsTestCheckShadowing(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor_file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts_test {
+				name: "test_file_contexts_shadowing",
+				srcs: [
+					"plat_file_contexts",
+					"vendor_file_contexts",
+				],
+				check_shadowing: true,
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_file_contexts_shadowing", "android_common").Rule("contexts_test")
+	if hasTool(rule, "checkfc") {
+		t.Errorf("expected no checkfc without sepolicy and test_data, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	if !hasTool(rule, "fc_shadowing") {
+		t.Errorf("expected fc_shadowing to run, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	// The findings of fc_shadowing are failures of the test result.
+	if check := contextsCheckCommand(rule.RuleParams.Command); !strings.Contains(check, "fc_shadowing -i ") || !hasOutput(rule, "result.json") {
+		t.Errorf("expected fc_shadowing to be a checker of contexts_check, got %q", rule.RuleParams.Command)
+	}
+	for _, input := range []string{"system/sepolicy/plat_file_contexts", "system/sepolicy/vendor_file_contexts"} {
+		if !hasInput(rule, input) {
+			t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+		}
+	}
+	if !hasOutput(rule, "shadowing.txt") {
+		t.Errorf("expected shadowing.txt to be an output, got %q", rule.ImplicitOutputs)
+	}
+}
+
+func TestFileContextsTestLabelingManifest(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor_manifest.txt", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts_test {
+				name: "test_file_contexts_labeling",
+				srcs: [
+					"plat_file_contexts",
+					"vendor_file_contexts",
+				],
+				labeling_manifest: "vendor_manifest.txt",
+				labeling_root: "/vendor",
+				labeling_disallowed_types: ["vendor_file"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_file_contexts_labeling", "android_common").Rule("contexts_test")
+	if !hasTool(rule, "fc_labeling") {
+		t.Errorf("expected fc_labeling to run, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	// The paths fc_labeling fails on are failures of the test result.
+	if check := contextsCheckCommand(rule.RuleParams.Command); !strings.Contains(check, "fc_labeling -i ") || !hasOutput(rule, "result.json") {
+		t.Errorf("expected fc_labeling to be a checker of contexts_check, got %q", rule.RuleParams.Command)
+	}
+	for _, input := range []string{
+		"system/sepolicy/plat_file_contexts",
+		"system/sepolicy/vendor_file_contexts",
+		"system/sepolicy/vendor_manifest.txt",
+	} {
+		if !hasInput(rule, input) {
+			t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+		}
+	}
+	if !hasOutput(rule, "labeling.txt") {
+		t.Errorf("expected labeling.txt to be an output, got %q", rule.ImplicitOutputs)
+	}
+	cmd := rule.RuleParams.Command
+	for _, s := range []string{"-root /vendor", "-disallowed_type vendor_file"} {
+		if !strings.Contains(cmd, s) {
+			t.Errorf("expected %q in command %q", s, cmd)
+		}
+	}
+}
+
+func TestSeappContextsLint(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat_seapp_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor/seapp_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/sepolicy", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			seapp_contexts {
+				name: "test_vendor_seapp_contexts",
+				srcs: ["vendor/seapp_contexts"],
+				lint_platform_srcs: ["plat_seapp_contexts"],
+				lint_fatal: true,
+				soc_specific: true,
+				sepolicy: "sepolicy",
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_vendor_seapp_contexts", "android_common").Rule("seapp_contexts")
+	if !hasTool(rule, "seapp_lint") || !hasInput(rule, "system/sepolicy/plat_seapp_contexts") ||
+		!hasOutput(rule, "test_vendor_seapp_contexts_lint.txt") {
+		t.Errorf("expected seapp_lint to lint against plat_seapp_contexts, got inputs %q and outputs %q",
+			rule.Implicits, rule.ImplicitOutputs)
+	}
+	if cmd := rule.RuleParams.Command; !strings.Contains(cmd, "-fatal") {
+		t.Errorf("expected -fatal in command %q", cmd)
+	}
+}
+
+func TestSeappContextsResolutionTest(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat_seapp_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor_seapp_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/apps.txt", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			seapp_contexts_resolution_test {
+				name: "test_seapp_contexts_resolution",
+				srcs: ["plat_seapp_contexts"],
+				vendor_srcs: ["vendor_seapp_contexts"],
+				apps: ["uid=10123 targetSdkVersion=34 domain=untrusted_app"],
+				app_files: ["apps.txt"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_seapp_contexts_resolution", "android_common").Rule("seapp_resolution_test")
+	if !hasTool(rule, "seapp_resolve") {
+		t.Errorf("expected seapp_resolve to run, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	for _, input := range []string{
+		"system/sepolicy/plat_seapp_contexts",
+		"system/sepolicy/vendor_seapp_contexts",
+		"system/sepolicy/apps.txt",
+	} {
+		if !hasInput(rule, input) {
+			t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+		}
+	}
+	if !hasOutput(rule, "test_seapp_contexts_resolution.txt") {
+		t.Errorf("expected test_seapp_contexts_resolution.txt to be an output, got %q", rule.Output)
+	}
+	if cmd := rule.RuleParams.Command; !strings.Contains(cmd, "-app 'uid=10123 targetSdkVersion=34 domain=untrusted_app'") {
+		t.Errorf("expected the app of apps in command %q", cmd)
+	}
+}
+
+func TestMergedContexts(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/plat_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/product_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/vendor_file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			se_merged_contexts {
+				name: "test_merged_file_contexts",
+				type: "file_contexts",
+				srcs: [
+					"plat_file_contexts",
+					"product_file_contexts",
+				],
+				vendor_srcs: ["vendor_file_contexts"],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	rule := ctx.ModuleForTests("test_merged_file_contexts", "android_common").Rule("merged_contexts")
+	if !hasTool(rule, "merged_contexts") {
+		t.Errorf("expected merged_contexts to run, got tools %q", rule.RuleParams.CommandDeps)
+	}
+	for _, input := range []string{
+		"system/sepolicy/plat_file_contexts",
+		"system/sepolicy/product_file_contexts",
+		"system/sepolicy/vendor_file_contexts",
+	} {
+		if !hasInput(rule, input) {
+			t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+		}
+	}
+	for _, output := range []string{"test_merged_file_contexts", "test_merged_file_contexts_report.txt"} {
+		if !hasOutput(rule, output) {
+			t.Errorf("expected %s to be an output, got %q and %q", output, rule.Output, rule.ImplicitOutputs)
+		}
+	}
+	if cmd := rule.RuleParams.Command; !strings.Contains(cmd, "-type file_contexts") {
+		t.Errorf("expected -type file_contexts in command %q", cmd)
+	}
+}
+
+func TestRecoveryOverlay(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/private/file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/private/debug_file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/private/recovery_file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts {
+				name: "test_file_contexts",
+				srcs: [
+					"private/file_contexts",
+					"private/debug_file_contexts",
+				],
+				recovery_available: true,
+				recovery_overlay: {
+					srcs: ["private/recovery_file_contexts"],
+					exclude_srcs: ["private/debug_file_contexts"],
+				},
+			}
+			`),
+	).RunTest(t).TestContext
+
+	core := ctx.ModuleForTests("test_file_contexts", "android_common")
+	if rule := core.Rule("selinux_contexts"); !hasInput(rule, "system/sepolicy/private/debug_file_contexts") ||
+		hasInput(rule, "system/sepolicy/private/recovery_file_contexts") {
+		t.Errorf("expected the core variant to be built from srcs only, got inputs %q", rule.Implicits)
+	}
+
+	recovery := ctx.ModuleForTests("test_file_contexts", "android_recovery_common")
+	if rule := recovery.Rule("selinux_contexts"); !hasInput(rule, "system/sepolicy/private/recovery_file_contexts") ||
+		hasInput(rule, "system/sepolicy/private/debug_file_contexts") {
+		t.Errorf("expected the recovery variant to be built with the overlay, got inputs %q", rule.Implicits)
+	}
+	diff := recovery.Rule("recovery_diff")
+	for _, output := range []android.TestingBuildParams{core.Output("test_file_contexts"), recovery.Output("test_file_contexts")} {
+		if !android.InList(output.Output.String(), diff.Implicits.Strings()) {
+			t.Errorf("expected %s to be compared, got inputs %q", output.Output, diff.Implicits)
+		}
+	}
+	if !hasOutput(diff, "test_file_contexts_recovery_diff.txt") {
+		t.Errorf("expected test_file_contexts_recovery_diff.txt to be an output, got %q", diff.Output)
+	}
+}
+
+func TestRecoveryOverlayErrors(t *testing.T) {
+	t.Parallel()
+
+	android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/private/file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts {
+				name: "test_file_contexts",
+				srcs: ["private/file_contexts"],
+				recovery_overlay: {
+					srcs: ["private/file_contexts"],
+				},
+			}
+			`),
+	).ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+		"recovery_overlay: requires `recovery_available: true`",
+	)).RunTest(t)
+}
+
+func TestConditionalSrcs(t *testing.T) {
+	t.Parallel()
+
+	ctx := android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.SanitizeDevice = []string{"hwaddress"}
+			variables.Eng = proptools.BoolPtr(false)
+			variables.Debuggable = proptools.BoolPtr(true)
+			variables.VendorVars = map[string]map[string]string{"acme": {"feature": "on"}}
+		}),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts", nil),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts_asan", nil),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts_hwasan", nil),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts_eng", nil),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts_feature", nil),
+		android.FixtureAddFile("system/sepolicy/private/file_contexts_coverage", nil),
+		android.FixtureAddFile("system/sepolicy/public/foo.te", nil),
+		android.FixtureAddFile("system/sepolicy/public/hwasan.te", nil),
+		android.FixtureAddFile("system/sepolicy/public/asan.te", nil),
+		android.FixtureAddFile("system/sepolicy/public/userdebug.te", nil),
+		android.FixtureAddFile("system/sepolicy/public/eng.te", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts {
+				name: "test_file_contexts",
+				srcs: ["private/file_contexts"],
+				product_variables: {
+					address_sanitize: {
+						srcs: ["private/file_contexts_asan"],
+					},
+				},
+				conditional_srcs: [
+					{
+						sanitizers: ["hwaddress", "memtag_heap"],
+						srcs: ["private/file_contexts_hwasan"],
+					},
+					{
+						build_variants: ["eng"],
+						srcs: ["private/file_contexts_eng"],
+					},
+					{
+						soong_config_variable: {
+							namespace: "acme",
+							variable: "feature",
+							values: ["on"],
+						},
+						srcs: ["private/file_contexts_feature"],
+					},
+					{
+						sanitizers: ["hwaddress"],
+						coverage: ["clang"],
+						srcs: ["private/file_contexts_coverage"],
+					},
+				],
+			}
+			se_policy_conf {
+				name: "test.conf",
+				srcs: ["public/foo.te"],
+				conditional_srcs: [
+					{
+						sanitizers: ["hwaddress"],
+						srcs: ["public/hwasan.te"],
+					},
+					{
+						sanitizers: ["address"],
+						srcs: ["public/asan.te"],
+					},
+				],
+			}
+			se_policy_conf {
+				name: "test_variants.conf",
+				srcs: ["public/foo.te"],
+				build_variant: "user",
+				variants: ["eng"],
+				conditional_srcs: [
+					{
+						build_variants: ["userdebug"],
+						srcs: ["public/userdebug.te"],
+					},
+					{
+						build_variants: ["eng"],
+						sanitizers: ["hwaddress"],
+						srcs: ["public/eng.te"],
+					},
+				],
+			}
+			`),
+	).RunTest(t).TestContext
+
+	// assertSrcs checks that rule reads the source files in srcs, and none of those in excluded.
+	assertSrcs := func(name string, rule android.TestingBuildParams, srcs, excluded []string) {
+		t.Helper()
+		for _, src := range srcs {
+			if !hasInput(rule, "system/sepolicy/"+src) {
+				t.Errorf("%s: expected %s to be an input, got %q", name, src, rule.Implicits)
+			}
+		}
+		for _, src := range excluded {
+			if hasInput(rule, "system/sepolicy/"+src) {
+				t.Errorf("%s: expected %s not to be an input, got %q", name, src, rule.Implicits)
+			}
+		}
+	}
+
+	assertSrcs("test_file_contexts", ctx.ModuleForTests("test_file_contexts", "android_common").Rule("selinux_contexts"),
+		[]string{"private/file_contexts_hwasan", "private/file_contexts_feature"},
+		[]string{"private/file_contexts_asan", "private/file_contexts_eng", "private/file_contexts_coverage"})
+	assertSrcs("test.conf", ctx.ModuleForTests("test.conf", "android_common").Rule("conf"),
+		[]string{"public/hwasan.te"}, []string{"public/asan.te"})
+
+	// Build variants are those of each conf file rather than of the lunch target (userdebug).
+	variantsConf := ctx.ModuleForTests("test_variants.conf", "android_common")
+	assertSrcs("test_variants.conf", variantsConf.Rule("conf"),
+		nil, []string{"public/userdebug.te", "public/eng.te"})
+	assertSrcs("test_variants.conf{eng}", variantsConf.Rule("conf_eng"),
+		[]string{"public/eng.te"}, []string{"public/userdebug.te"})
+}
+
+func TestConditionalSrcsErrors(t *testing.T) {
+	t.Parallel()
+
+	android.GroupFixturePreparers(
+		prepareForTest,
+		android.FixtureAddFile("system/sepolicy/private/file_contexts", nil),
+		android.FixtureAddTextFile("system/sepolicy/Android.bp", `
+			file_contexts {
+				name: "test_file_contexts",
+				srcs: ["private/file_contexts"],
+				conditional_srcs: [
+					{
+						srcs: ["private/file_contexts"],
+					},
+					{
+						build_variants: ["debug"],
+						coverage: ["llvm"],
+						srcs: ["private/file_contexts"],
+					},
+					{
+						soong_config_variable: {
+							namespace: "acme",
+						},
+						srcs: ["private/file_contexts"],
+					},
+				],
+			}
+			`),
+	).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+		"an entry must have sanitizers, coverage, build_variants or soong_config_variable",
+		`unknown coverage mode "llvm"`,
+		`unknown build variant "debug"`,
+		"soong_config_variable must have namespace, variable and values",
+	})).RunTest(t)
+}
+
+func TestContextsTest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		moduleType string
+		props      string
+		tools      []string
+		inputs     []string
+		args       []string
+	}{
+		{
+			name:       "file_contexts",
+			moduleType: "file_contexts_test",
+			props:      `sepolicy: "sepolicy",`,
+			tools:      []string{"checkfc"},
+			inputs:     []string{"system/sepolicy/sepolicy"},
+			args:       []string{"-contexts file_contexts"},
+		},
+		{
+			name:       "file_contexts with test_data",
+			moduleType: "file_contexts_test",
+			props:      `test_data: "test_data",`,
+			tools:      []string{"checkfc"},
+			inputs:     []string{"system/sepolicy/test_data"},
+			args:       []string{"checkfc -t "},
+		},
+		{
+			name:       "hwservice_contexts",
+			moduleType: "hwservice_contexts_test",
+			props:      `sepolicy: "sepolicy",`,
+			tools:      []string{"checkfc"},
+			inputs:     []string{"system/sepolicy/sepolicy"},
+			args:       []string{"-contexts hwservice_contexts", "checkfc -e -l "},
+		},
+		{
+			name:       "keystore2_key_contexts",
+			moduleType: "keystore2_key_contexts_test",
+			props:      `sepolicy: "sepolicy",`,
+			tools:      []string{"sepolicy-analyze"},
+			inputs:     []string{"system/sepolicy/sepolicy"},
+			args:       []string{"-contexts keystore2_key_contexts", "attribute keystore2_key_type", "-keystore2_key_types "},
+		},
+		{
+			name:       "seapp_contexts",
+			moduleType: "seapp_contexts_test",
+			props:      `sepolicy: "sepolicy",`,
+			tools:      []string{"checkseapp"},
+			inputs:     []string{"system/sepolicy/sepolicy"},
+			args:       []string{"-contexts seapp_contexts"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := android.GroupFixturePreparers(
+				prepareForTest,
+				android.FixtureAddFile("system/sepolicy/contexts", nil),
+				android.FixtureAddFile("system/sepolicy/sepolicy", nil),
+				android.FixtureAddFile("system/sepolicy/test_data", nil),
+				android.FixtureAddTextFile("system/sepolicy/Android.bp", tc.moduleType+` {
+						name: "test_contexts",
+						srcs: ["contexts"],
+						`+tc.props+`
+					}
+					`),
+			).RunTest(t).TestContext
+
+			rule := ctx.ModuleForTests("test_contexts", "android_common").Rule("contexts_test")
+			for _, tool := range append([]string{"contexts_check"}, tc.tools...) {
+				if !hasTool(rule, tool) {
+					t.Errorf("expected %s to run, got tools %q", tool, rule.RuleParams.CommandDeps)
+				}
+			}
+			for _, input := range append([]string{"system/sepolicy/contexts"}, tc.inputs...) {
+				if !hasInput(rule, input) {
+					t.Errorf("expected %s to be an input, got %q", input, rule.Implicits)
+				}
+			}
+			if !hasOutput(rule, "result.json") {
+				t.Errorf("expected result.json to be an output, got %q", rule.Output)
+			}
+			cmd := rule.RuleParams.Command
+			for _, s := range append([]string{"-module test_contexts"}, tc.args...) {
+				if !strings.Contains(cmd, s) {
+					t.Errorf("expected %q in command %q", s, cmd)
+				}
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"fmt"
 	"strconv"
+	"strings"
 
 	"android/soong/android"
 )
@@ -34,12 +35,38 @@ type neverallowTestProperties struct {
 
 	// Policy files to be tested.
 	Srcs []string `android:"path"`
+
+	// Named groups of neverallow assertions to be tested separately. Assertions matching no group
+	// are grouped by the policy file they come from.
+	Groups []neverallowTestGroupProperties
+
+	// Groups whose failures are reported without failing the build, given by group name or by
+	// policy file for assertions matching no group.
+	Non_blocking_groups []string
+
+	// Whether to check every neverallow assertion, ignoring the cache of the previous build. Can
+	// also be forced with SELINUX_NEVERALLOW_FULL_CHECK=true.
+	Full_check *bool
+}
+
+type neverallowTestGroupProperties struct {
+	// Name of the test case of the group.
+	Name *string
+
+	// Patterns matched against the policy files of assertions, e.g. "vendor/*/sepolicy/*.te". A
+	// pattern ending with "/" matches every file under the directory. The first matching group
+	// wins.
+	Patterns []string
 }
 
 type neverallowTestModule struct {
 	android.ModuleBase
 	properties    neverallowTestProperties
 	testTimestamp android.OutputPath
+	testResults   android.OutputPath
+	coverage      android.OutputPath
+	coverageJson  android.OutputPath
+	cache         android.OutputPath
 }
 
 type nameProperties struct {
@@ -54,6 +81,19 @@ var sepolicyAnalyzeTag = dependencyTag{name: "sepolicy_analyze"}
 // build test will be compiled with checkpolicy, and policy without build test will be tested with
 // sepolicy-analyze's neverallow tool.  This module's check can be skipped by setting
 // SELINUX_IGNORE_NEVERALLOWS := true.
+//
+// Neverallow assertions are tested separately per policy file, or per named group, and the
+// results are written as a JUnit XML report, available as the ".junit" output.
+//
+// Assertions which passed are written to the ".cache" output, keyed by a hash of their text, the
+// types they refer to and the allow rules overlapping with them. Each build reads the cache left in
+// the out directory by the previous one, and only checks the assertions whose key isn't in it, so
+// entries of changed assertions or policies are never used. Setting full_check, or
+// SELINUX_NEVERALLOW_FULL_CHECK := true, checks every assertion.
+//
+// The ".coverage" output is a report of which neverallow assertions are vacuous, i.e. overlap with
+// no allow rule of the policy on source and target types, and which are meaningful. It is also
+// available as JSON, as the ".coverage.json" output. It isn't built as part of the test.
 func neverallowTestFactory() android.Module {
 	n := &neverallowTestModule{}
 	n.AddProperties(&n.properties)
@@ -110,14 +150,28 @@ func (n *neverallowTestModule) DepsMutator(ctx android.BottomUpMutatorContext) {
 
 func (n *neverallowTestModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	n.testTimestamp = pathForModuleOut(ctx, "timestamp")
+	n.testResults = pathForModuleOut(ctx, "neverallow_test_results.xml")
+	n.coverage = pathForModuleOut(ctx, "neverallow_coverage.txt")
+	n.coverageJson = pathForModuleOut(ctx, "neverallow_coverage.json")
+	n.cache = pathForModuleOut(ctx, "neverallow_cache.txt")
+	ctx.SetOutputFiles(android.Paths{n.testResults}, ".junit")
+	ctx.SetOutputFiles(android.Paths{n.coverage}, ".coverage")
+	ctx.SetOutputFiles(android.Paths{n.coverageJson}, ".coverage.json")
+	ctx.SetOutputFiles(android.Paths{n.cache}, ".cache")
 	if ctx.Config().SelinuxIgnoreNeverallows() {
-		// just touch
+		// just touch, and report that there are no tests
 		android.WriteFileRule(ctx, n.testTimestamp, "")
+		android.WriteFileRule(ctx, n.testResults, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<testsuites><testsuite name="`+ctx.ModuleName()+`" tests="0"></testsuite></testsuites>`)
+		android.WriteFileRule(ctx, n.coverage, "neverallow assertions are ignored (SELINUX_IGNORE_NEVERALLOWS)")
+		android.WriteFileRule(ctx, n.coverageJson, "[]")
+		android.WriteFileRule(ctx, n.cache, "")
 		return
 	}
 
 	var checkpolicyConfPaths android.Paths
 	var sepolicyAnalyzeConfPaths android.Paths
+	var sepolicyAnalyzeSourceMap android.Path
 
 	ctx.VisitDirectDeps(func(child android.Module) {
 		depTag := ctx.OtherModuleDependencyTag(child)
@@ -132,6 +186,9 @@ func (n *neverallowTestModule) GenerateAndroidBuildActions(ctx android.ModuleCon
 			checkpolicyConfPaths = outputs
 		case sepolicyAnalyzeTag:
 			sepolicyAnalyzeConfPaths = outputs
+			if info, ok := android.OtherModuleProvider(ctx, child, policyConfProviderKey); ok {
+				sepolicyAnalyzeSourceMap = info.SourceMap
+			}
 		}
 	})
 
@@ -157,25 +214,90 @@ func (n *neverallowTestModule) GenerateAndroidBuildActions(ctx android.ModuleCon
 		Input(checkpolicyConfPath)
 	rule.Build("neverallow_checkpolicy", "Neverallow check: "+ctx.ModuleName())
 
+	// Decompile the binary policy, so that the attributes of assertions and allow rules can be
+	// expanded to compute cache keys and coverage.
+	policyCil := pathForModuleOut(ctx, "policy.cil")
+	rule = android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("checkpolicy").
+		Flag("-b"). // Read binary
+		Flag("-C"). // Write CIL
+		Flag("-M"). // Enable MLS
+		FlagWithArg("-c ", strconv.Itoa(PolicyVers)).
+		FlagWithOutput("-o ", policyCil).
+		Input(binaryPolicy)
+	rule.Build("neverallow_decompile", "Neverallow decompile: "+ctx.ModuleName())
+
 	// Step 2. Run sepolicy-analyze with the conf file without the build test and binary policy
-	// file from Step 1
+	// file from Step 1, separately for each group of neverallow assertions
 	rule = android.NewRuleBuilder(pctx, ctx)
-	msg := `sepolicy-analyze failed. This is most likely due to the use\n` +
-		`of an expanded attribute in a neverallow assertion. Please fix\n` +
-		`the policy.`
-
-	rule.Command().BuiltTool("sepolicy-analyze").
-		Input(binaryPolicy).
-		Text("neverallow").
-		Flag("-w").
-		FlagWithInput("-f ", sepolicyAnalyzeConfPath).
-		Text("|| (echo").
-		Flag("-e").
-		Text(`"` + msg + `"`).
-		Text("; exit 1)")
+	cmd := rule.Command().BuiltTool("neverallow_groups").
+		Flag("-sepolicy_analyze").BuiltTool("sepolicy-analyze").
+		FlagWithInput("-policy ", binaryPolicy).
+		FlagWithInput("-conf ", sepolicyAnalyzeConfPath)
+	if sepolicyAnalyzeSourceMap != nil {
+		cmd.FlagWithInput("-source_map ", sepolicyAnalyzeSourceMap)
+	}
+	for _, group := range n.groupFlags(ctx) {
+		cmd.FlagWithArg("-group ", proptools.ShellEscape(group))
+	}
+	for _, group := range n.properties.Non_blocking_groups {
+		cmd.FlagWithArg("-non_blocking ", proptools.ShellEscape(group))
+	}
+	cmd.FlagWithInput("-policy_cil ", policyCil)
+	// The cache of the previous build is the output itself rather than an input, so that it
+	// doesn't trigger a rebuild.
+	cmd.FlagWithArg("-cache ", n.cache.String()).
+		FlagWithOutput("-cache_out ", n.cache)
+	if proptools.Bool(n.properties.Full_check) || ctx.Config().IsEnvTrue("SELINUX_NEVERALLOW_FULL_CHECK") {
+		cmd.Flag("-full")
+	}
+	cmd.FlagWithArg("-suite ", ctx.ModuleName()).
+		FlagWithOutput("-junit ", n.testResults)
 
 	rule.Command().Text("touch").Output(n.testTimestamp)
 	rule.Build("neverallow_sepolicy-analyze", "Neverallow check: "+ctx.ModuleName())
+
+	// Coverage report: match the allow rules of the decompiled policy against the assertions of
+	// the sepolicy-analyze conf.
+	rule = android.NewRuleBuilder(pctx, ctx)
+	cmd = rule.Command().BuiltTool("neverallow_coverage").
+		FlagWithInput("-policy ", policyCil).
+		FlagWithInput("-conf ", sepolicyAnalyzeConfPath)
+	if sepolicyAnalyzeSourceMap != nil {
+		cmd.FlagWithInput("-source_map ", sepolicyAnalyzeSourceMap)
+	}
+	cmd.FlagWithOutput("-o ", n.coverage).
+		FlagWithOutput("-json ", n.coverageJson)
+	rule.Build("neverallow_coverage", "Neverallow coverage: "+ctx.ModuleName())
+}
+
+// groupFlags returns the groups property as arguments of neverallow_groups: name=pattern,...
+func (n *neverallowTestModule) groupFlags(ctx android.ModuleContext) []string {
+	var ret []string
+	var names []string
+	for _, g := range n.properties.Groups {
+		name := proptools.String(g.Name)
+		if name == "" || strings.Contains(name, "=") {
+			ctx.PropertyErrorf("groups", "invalid group name %q", name)
+			continue
+		}
+		if android.InList(name, names) {
+			ctx.PropertyErrorf("groups", "duplicate group name %q", name)
+			continue
+		}
+		names = append(names, name)
+		if len(g.Patterns) == 0 {
+			ctx.PropertyErrorf("groups", "group %q must have patterns", name)
+			continue
+		}
+		for _, p := range g.Patterns {
+			if p == "" || strings.Contains(p, ",") {
+				ctx.PropertyErrorf("groups", "invalid pattern %q in group %q", p, name)
+			}
+		}
+		ret = append(ret, name+"="+strings.Join(g.Patterns, ","))
+	}
+	return ret
 }
 
 func (n *neverallowTestModule) AndroidMkEntries() []android.AndroidMkEntries {
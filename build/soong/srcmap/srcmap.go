@@ -0,0 +1,168 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package srcmap maps line ranges of generated policy files (policy.conf, cil) back to the policy
+// source files they were generated from.
+package srcmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Entry maps the output lines [Start, End] to the source File. The first output line corresponds
+// to Line. If Expanded is true, every output line in the range was expanded from Line (e.g. by a
+// macro); otherwise the source line advances together with the output line.
+type Entry struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Expanded bool   `json:"expanded,omitempty"`
+}
+
+// Map is a source map of a single generated file.
+type Map struct {
+	// Output is the name of the generated file.
+	Output string `json:"output"`
+
+	// Entries are sorted by Start, and never overlap.
+	Entries []Entry `json:"entries"`
+}
+
+// Location is a line of a source file.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Add maps the output line to the source location. Consecutive lines are merged into a single
+// entry when possible. Lines must be added in increasing order.
+func (m *Map) Add(outputLine int, file string, line int, expanded bool) {
+	if n := len(m.Entries); n > 0 {
+		last := &m.Entries[n-1]
+		if last.End+1 == outputLine && last.File == file {
+			switch {
+			case last.Expanded && expanded && last.Line == line:
+				last.End = outputLine
+				return
+			case !last.Expanded && !expanded && last.Line+(outputLine-last.Start) == line:
+				last.End = outputLine
+				return
+			case last.Start == last.End && !expanded && last.Line+1 == line:
+				// A single-line entry can always be continued as a non-expanded range.
+				last.Expanded = false
+				last.End = outputLine
+				return
+			}
+		}
+	}
+	m.Entries = append(m.Entries, Entry{Start: outputLine, End: outputLine, File: file, Line: line, Expanded: expanded})
+}
+
+// Lookup returns the source location of the given output line.
+func (m *Map) Lookup(outputLine int) (Location, bool) {
+	i := sort.Search(len(m.Entries), func(i int) bool {
+		return m.Entries[i].End >= outputLine
+	})
+	if i == len(m.Entries) || m.Entries[i].Start > outputLine {
+		return Location{}, false
+	}
+	e := m.Entries[i]
+	if e.Expanded {
+		return Location{File: e.File, Line: e.Line}, true
+	}
+	return Location{File: e.File, Line: e.Line + outputLine - e.Start}, true
+}
+
+// Write writes m as JSON.
+func (m *Map) Write(w io.Writer) error {
+	if m.Entries == nil {
+		m.Entries = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteFile writes m as JSON to the given path.
+func (m *Map) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads a JSON source map written by WriteFile.
+func ReadFile(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Map{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// syncLineRegex matches the sync lines that m4 -s emits, e.g. `#line 12 "public/file.te"`.
+var syncLineRegex = regexp.MustCompile(`^#line (\d+)(?: "(.*)")?$`)
+
+// FromSyncLines builds a source map of a file generated by m4 -s, such as a policy.conf file. The
+// output line after a sync line `#line N "file"` corresponds to line N of file, and following
+// lines advance together until the next sync line. Sync lines themselves aren't mapped.
+func FromSyncLines(r io.Reader, output string) (*Map, error) {
+	m := &Map{Output: output}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	file := ""
+	srcLine := 0
+	for outLine := 1; scanner.Scan(); outLine++ {
+		if match := syncLineRegex.FindStringSubmatch(scanner.Text()); match != nil {
+			n, err := strconv.Atoi(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: malformed sync line: %w", output, outLine, err)
+			}
+			srcLine = n
+			if match[2] != "" {
+				file = match[2]
+			}
+			continue
+		}
+		if file != "" {
+			m.Add(outLine, file, srcLine, false)
+		}
+		srcLine++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srcmap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	m := &Map{}
+	m.Add(1, "a.te", 10, false)
+	m.Add(2, "a.te", 11, false)
+	m.Add(3, "a.te", 12, false)
+	m.Add(4, "b.te", 5, true)
+	m.Add(5, "b.te", 5, true)
+	m.Add(7, "a.te", 20, false)
+
+	if len(m.Entries) != 3 {
+		t.Errorf("expected 3 entries, got %v", m.Entries)
+	}
+
+	testCases := []struct {
+		line     int
+		expected string
+	}{
+		{1, "a.te:10"},
+		{3, "a.te:12"},
+		{4, "b.te:5"},
+		{5, "b.te:5"},
+		{6, ""},
+		{7, "a.te:20"},
+		{8, ""},
+	}
+	for _, tc := range testCases {
+		loc, ok := m.Lookup(tc.line)
+		actual := ""
+		if ok {
+			actual = loc.String()
+		}
+		if actual != tc.expected {
+			t.Errorf("line %d: expected %q, got %q", tc.line, tc.expected, actual)
+		}
+	}
+}
+
+func TestFromSyncLines(t *testing.T) {
+	t.Parallel()
+
+	conf := `#line 1 "security_classes"
+class file
+class dir
+#line 1 "a.te"
+type a;
+#line 5
+allow a self:file read;
+allow a self:dir read;
+#line 3 "b.te"
+type b;
+`
+	m, err := FromSyncLines(strings.NewReader(conf), "policy.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		line     int
+		expected string
+	}{
+		{1, ""},
+		{2, "security_classes:1"},
+		{3, "security_classes:2"},
+		{5, "a.te:1"},
+		{7, "a.te:5"},
+		{8, "a.te:6"},
+		{10, "b.te:3"},
+	}
+	for _, tc := range testCases {
+		loc, ok := m.Lookup(tc.line)
+		actual := ""
+		if ok {
+			actual = loc.String()
+		}
+		if actual != tc.expected {
+			t.Errorf("line %d: expected %q, got %q", tc.line, tc.expected, actual)
+		}
+	}
+}
@@ -51,6 +51,11 @@ type versionedPolicyProperties struct {
 	// file can be merged with specified cil files or not.
 	Dependent_cils []string `android:"path"`
 
+	// Ledger of allowed neverallow violations, as written to the ".neverallow_ledger" output.
+	// secilc ignores neverallows when checking dependent_cils; if set, the violations are written
+	// to the ledger, and the build fails on violations missing from this file.
+	Neverallow_allowlist *string `android:"path"`
+
 	// Whether this module is directly installable to one of the partitions. Default is true
 	Installable *bool
 
@@ -63,8 +68,9 @@ type versionedPolicy struct {
 
 	properties versionedPolicyProperties
 
-	installSource android.Path
-	installPath   android.InstallPath
+	installSource    android.Path
+	installPath      android.InstallPath
+	neverallowLedger android.Path
 }
 
 // se_versioned_policy generates versioned cil file with "version_policy". This can generate either
@@ -138,16 +144,27 @@ func (m *versionedPolicy) GenerateAndroidBuildActions(ctx android.ModuleContext)
 	}
 
 	if len(m.properties.Dependent_cils) > 0 {
-		rule.Command().BuiltTool("secilc").
+		secilcCmd := rule.Command()
+		_, allowlist := neverallowCheck(ctx, nil, m.properties.Neverallow_allowlist)
+		ledgerMode := m.properties.Neverallow_allowlist != nil
+		if ledgerMode {
+			m.neverallowLedger = pathForModuleOut(ctx, stem+"_neverallow_ledger.txt")
+			wrapSecilcWithLedger(secilcCmd, pathForModuleOut(ctx, stem+"_diagnostics.json"), m.neverallowLedger, allowlist)
+		}
+		secilcCmd.BuiltTool("secilc").
 			Flag("-m").
 			FlagWithArg("-M ", "true").
-			Flag("-G").
-			Flag("-N").
-			FlagWithArg("-c ", strconv.Itoa(PolicyVers)).
+			Flag("-G")
+		if !ledgerMode {
+			secilcCmd.Flag("-N")
+		}
+		secilcCmd.FlagWithArg("-c ", strconv.Itoa(PolicyVers)).
 			Inputs(android.PathsForModuleSrc(ctx, m.properties.Dependent_cils)).
 			Text(out.String()).
 			FlagWithArg("-o ", os.DevNull).
 			FlagWithArg("-f ", os.DevNull)
+	} else if m.properties.Neverallow_allowlist != nil {
+		ctx.PropertyErrorf("neverallow_allowlist", "can't be set without dependent_cils")
 	}
 
 	rule.Build("mapping", "Versioning mapping file "+ctx.ModuleName())
@@ -164,6 +181,9 @@ func (m *versionedPolicy) GenerateAndroidBuildActions(ctx android.ModuleContext)
 	ctx.InstallFile(m.installPath, m.installSource.Base(), m.installSource)
 
 	ctx.SetOutputFiles(android.Paths{m.installSource}, "")
+	if m.neverallowLedger != nil {
+		ctx.SetOutputFiles(android.Paths{m.neverallowLedger}, ".neverallow_ledger")
+	}
 }
 
 func (m *versionedPolicy) AndroidMkEntries() []android.AndroidMkEntries {
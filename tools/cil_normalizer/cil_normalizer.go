@@ -0,0 +1,73 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cil_normalizer removes line markers from a CIL file and writes its statements in canonical order
+// and whitespace, so that two builds of the same policy give byte-identical CIL. The removed line
+// markers can be kept in a separate JSON source map.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/cil"
+)
+
+var (
+	input     = flag.String("i", "", "input CIL file")
+	output    = flag.String("o", "", "output CIL file. May be the same as the input file")
+	sourceMap = flag.String("source_map", "", "if set, write the origin of each output line as JSON")
+)
+
+func main() {
+	flag.Parse()
+	if *input == "" || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: cil_normalizer -i <input.cil> -o <output.cil> [-source_map <map.json>]")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	stmts, err := cil.ParseNodes(f, *input)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Write to a buffer first, as the input and the output may be the same file.
+	var buf bytes.Buffer
+	m, err := cil.Normalize(&buf, stmts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *sourceMap != "" {
+		m.Output = *output
+		if err := m.WriteFile(*sourceMap); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
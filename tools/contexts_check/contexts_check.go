@@ -0,0 +1,164 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// contexts_check runs a contexts test and writes its result as JSON, with a failure for each
+// failing entry. It either wraps checkers such as checkfc, whose output lines are the failures if
+// they fail, or checks keystore2_key_contexts files itself. Checkers are separated by "--", and
+// all of them run even if one fails. It fails if the test fails.
+//
+//	contexts_check -module plat_file_contexts_test -contexts file_contexts -src plat_file_contexts \
+//	    -o result.json -- checkfc sepolicy plat_file_contexts -- fc_shadowing -i plat_file_contexts \
+//	    -o shadowing.txt
+//	contexts_check -module plat_keystore2_key_contexts_test -contexts keystore2_key_contexts \
+//	    -src plat_keystore2_key_contexts -keystore2_key_types types.txt -o result.json
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"android/soong/selinux/ctxcheck"
+)
+
+var (
+	module   = flag.String("module", "", "name of the test module")
+	contexts = flag.String("contexts", "", "type of the tested contexts, e.g. file_contexts")
+	output   = flag.String("o", "", "result file")
+	keyTypes = flag.String("keystore2_key_types", "", "file listing the keystore2_key_type types, one per line. "+
+		"If set, srcs are checked as keystore2_key_contexts files")
+
+	srcs []string
+)
+
+func init() {
+	flag.Func("src", "tested contexts file. Can be repeated", func(s string) error {
+		srcs = append(srcs, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func checkKeystoreKeyContexts() []ctxcheck.Failure {
+	data, err := os.ReadFile(*keyTypes)
+	if err != nil {
+		fail(err)
+	}
+	types := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if t := strings.TrimSpace(scanner.Text()); t != "" {
+			types[t] = true
+		}
+	}
+
+	var entries []ctxcheck.KeystoreKeyEntry
+	var failures []ctxcheck.Failure
+	for _, src := range srcs {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			fail(err)
+		}
+		e, f, err := ctxcheck.ParseKeystoreKeyContexts(bytes.NewReader(data), src)
+		if err != nil {
+			fail(err)
+		}
+		entries = append(entries, e...)
+		failures = append(failures, f...)
+	}
+	return append(failures, ctxcheck.CheckKeystoreKeyContexts(entries, types)...)
+}
+
+// runChecker runs a checker, returning its failures and whether it passed.
+func runChecker(args []string) ([]ctxcheck.Failure, bool) {
+	cmd := exec.Command(args[0], args[1:]...)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Stderr.Write(out)
+		failures := ctxcheck.FailuresFromOutput(out)
+		if len(failures) == 0 {
+			failures = []ctxcheck.Failure{{Message: fmt.Sprintf("%s failed: %s", args[0], err)}}
+		}
+		return failures, false
+	} else if err != nil {
+		fail(err)
+	}
+	return nil, true
+}
+
+// splitCheckers returns the commands of the checkers in args, separated by "--".
+func splitCheckers(args []string) [][]string {
+	var ret [][]string
+	start := 0
+	for i, arg := range args {
+		if arg == "--" {
+			if i > start {
+				ret = append(ret, args[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(args) {
+		ret = append(ret, args[start:])
+	}
+	return ret
+}
+
+func main() {
+	flag.Parse()
+	if *module == "" || *contexts == "" || *output == "" || (*keyTypes != "" && flag.NArg() > 0) {
+		fmt.Fprintln(os.Stderr, "usage: contexts_check -module <name> -contexts <type> [-src <contexts>]... -o <result.json> "+
+			"[-keystore2_key_types <types.txt> | -- <checker> [args]... [-- <checker> [args]...]...]")
+		os.Exit(1)
+	}
+
+	r := &ctxcheck.Result{Module: *module, Contexts: *contexts, Srcs: srcs, Passed: true}
+	if *keyTypes != "" {
+		r.Failures = checkKeystoreKeyContexts()
+		r.Passed = len(r.Failures) == 0
+	} else {
+		for _, args := range splitCheckers(flag.Args()) {
+			failures, passed := runChecker(args)
+			r.Failures = append(r.Failures, failures...)
+			r.Passed = r.Passed && passed
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+	if !r.Passed {
+		fmt.Fprintf(os.Stderr, "%s: %d failures, see %s\n", *module, len(r.Failures), *output)
+		if *keyTypes != "" {
+			for _, f := range r.Failures {
+				fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Source, f.Message)
+			}
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fc_labeling labels every path of a filesystem manifest with the file_contexts files of every
+// partition, merged as the device loads them, and writes the label of each path to a report. It
+// fails if a checked path, by default one under /vendor or /odm, gets one of the disallowed types,
+// by default default_file and unlabeled, the type of paths which no entry matches. Each failing
+// path is printed as a line, prefixed with the "file:line" of its entry if any, as contexts_check
+// expects.
+//
+//	fc_labeling -i plat_file_contexts -i vendor_file_contexts -manifest vendor.txt -root /vendor \
+//	    -o report.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"android/soong/selinux/fcsort"
+)
+
+// unlabeled is the type of paths which no entry matches.
+const unlabeled = "unlabeled"
+
+var (
+	manifest = flag.String("manifest", "", "filesystem manifest, with a path and a file type per line")
+	root     = flag.String("root", "/", "directory of the relative paths of the manifest")
+	output   = flag.String("o", "", "report file")
+
+	inputs           []string
+	checkPrefixes    []string
+	disallowedTypes  []string
+	defaultPrefixes  = []string{"/vendor/", "/odm/"}
+	defaultDisallows = []string{"default_file", unlabeled}
+)
+
+func init() {
+	flag.Func("i", "file_contexts file, in the order the device loads them. Can be repeated", func(s string) error {
+		inputs = append(inputs, s)
+		return nil
+	})
+	flag.Func("check_prefix", "prefix of the checked paths. Can be repeated. Defaults to /vendor/ and /odm/", func(s string) error {
+		checkPrefixes = append(checkPrefixes, s)
+		return nil
+	})
+	flag.Func("disallowed_type", "type checked paths must not get. Can be repeated. Defaults to default_file and unlabeled", func(s string) error {
+		disallowedTypes = append(disallowedTypes, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func checked(path string) bool {
+	for _, prefix := range checkPrefixes {
+		// A prefix also matches the directory itself, e.g. /vendor for /vendor/.
+		if strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	flag.Parse()
+	if len(inputs) == 0 || *manifest == "" || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: fc_labeling -i <file_contexts>... -manifest <manifest> [-root <dir>] "+
+			"[-check_prefix <prefix>]... [-disallowed_type <type>]... -o <report>")
+		os.Exit(1)
+	}
+	if checkPrefixes == nil {
+		checkPrefixes = defaultPrefixes
+	}
+	if disallowedTypes == nil {
+		disallowedTypes = defaultDisallows
+	}
+
+	var files [][]fcsort.Entry
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fail(err)
+		}
+		entries, err := fcsort.Parse(bytes.NewReader(data), input)
+		if err != nil {
+			fail(err)
+		}
+		files = append(files, entries)
+	}
+	labeler := fcsort.NewLabeler(fcsort.Merge(files...))
+
+	data, err := os.ReadFile(*manifest)
+	if err != nil {
+		fail(err)
+	}
+	paths, err := fcsort.ParseManifest(bytes.NewReader(data), *manifest, *root)
+	if err != nil {
+		fail(err)
+	}
+
+	var report bytes.Buffer
+	var failures []string
+	for _, p := range paths {
+		context, source, typ := "-", "-", unlabeled
+		if e, ok := labeler.Lookup(p.Path, p.FileType); ok {
+			context, source, typ = e.Context, e.Source, fcsort.Type(e.Context)
+		}
+		line := fmt.Sprintf("%s %s %s %s", p.Path, p.FileType, context, source)
+		fmt.Fprintln(&report, line)
+		if !checked(p.Path) {
+			continue
+		}
+		for _, t := range disallowedTypes {
+			if typ != t {
+				continue
+			}
+			failure := fmt.Sprintf("%s %s gets disallowed type %s", p.Path, p.FileType, typ)
+			if source != "-" {
+				failure = fmt.Sprintf("%s: %s from %s", source, failure, context)
+			}
+			failures = append(failures, failure)
+			break
+		}
+	}
+	if err := os.WriteFile(*output, report.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Fprintln(os.Stderr, f)
+		}
+		os.Exit(1)
+	}
+}
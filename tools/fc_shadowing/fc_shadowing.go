@@ -0,0 +1,94 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fc_shadowing checks the file_contexts files of every partition, merged as the device loads them,
+// for entries which can never match a path: entries shadowed by an entry which is checked first,
+// and entries whose path can't be a labeled path. It also reports entries whose file type
+// contradicts the file type of a broader entry. Findings are written to a report, and make
+// fc_shadowing fail, with a "file:line: message" line per finding as contexts_check expects.
+//
+//	fc_shadowing -i plat_file_contexts -i vendor_file_contexts -o report.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/fcsort"
+)
+
+var (
+	output = flag.String("o", "", "report file")
+
+	inputs []string
+)
+
+func init() {
+	flag.Func("i", "file_contexts file, in the order the device loads them. Can be repeated", func(s string) error {
+		inputs = append(inputs, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	if len(inputs) == 0 || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: fc_shadowing -i <file_contexts>... -o <report>")
+		os.Exit(1)
+	}
+
+	var files [][]fcsort.Entry
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fail(err)
+		}
+		entries, err := fcsort.Parse(bytes.NewReader(data), input)
+		if err != nil {
+			fail(err)
+		}
+		files = append(files, entries)
+	}
+	merged := fcsort.Merge(files...)
+
+	var findings []fmt.Stringer
+	for _, u := range fcsort.FindUnmatchable(merged) {
+		findings = append(findings, u)
+	}
+	for _, s := range fcsort.Shadowed(merged) {
+		findings = append(findings, s)
+	}
+	for _, c := range fcsort.TypeConflicts(merged) {
+		findings = append(findings, c)
+	}
+
+	var report bytes.Buffer
+	for _, f := range findings {
+		fmt.Fprintln(&report, f.String())
+	}
+	if err := os.WriteFile(*output, report.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+	if len(findings) > 0 {
+		os.Stderr.Write(report.Bytes())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fc_sort sorts file_contexts files from the least to the most specific entry, so that the last
+// matching entry, which libselinux uses, is the most specific one. Comments are dropped. It can
+// also report the entries which are shadowed by a more specific entry.
+//
+//	fc_sort -i file_contexts [-i more_file_contexts]... -o file_contexts.sorted [-shadowed report.txt]
+//
+// Further arguments are inputs as well, and flags may follow them, as with the former python
+// fc_sort:
+//
+//	fc_sort -i file_contexts more_file_contexts -o file_contexts.sorted
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/fcsort"
+)
+
+var (
+	output   = flag.String("o", "", "output file. Defaults to stdout")
+	shadowed = flag.String("shadowed", "", "file to write the shadowed entries to")
+
+	inputs []string
+)
+
+func init() {
+	flag.Func("i", "file_contexts file. Can be repeated", func(s string) error {
+		inputs = append(inputs, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// parseArgs parses the flags of args, which may be interspersed with arguments, and returns the
+// arguments. Arguments following "--" aren't parsed as flags.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var ret []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return ret, nil
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(ret, rest...), nil
+		}
+		ret = append(ret, rest[0])
+		args = rest[1:]
+	}
+}
+
+func main() {
+	args, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fail(err)
+	}
+	inputs = append(inputs, args...)
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: fc_sort -i <file_contexts>... [-o <output>] [-shadowed <report>]")
+		os.Exit(1)
+	}
+
+	var entries []fcsort.Entry
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fail(err)
+		}
+		e, err := fcsort.Parse(bytes.NewReader(data), input)
+		if err != nil {
+			fail(err)
+		}
+		entries = append(entries, e...)
+	}
+	fcsort.Sort(entries)
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintln(&buf, e.Line)
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+	} else if err := os.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+
+	if *shadowed != "" {
+		var report bytes.Buffer
+		for _, s := range fcsort.Shadowed(entries) {
+			fmt.Fprintln(&report, s.String())
+		}
+		if err := os.WriteFile(*shadowed, report.Bytes(), 0666); err != nil {
+			fail(err)
+		}
+	}
+}
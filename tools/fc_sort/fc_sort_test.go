@@ -0,0 +1,75 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		args           []string
+		expectedArgs   []string
+		expectedInputs []string
+		expectedOutput string
+	}{
+		{
+			name:           "flags",
+			args:           []string{"-i", "a", "-i", "b", "-o", "out"},
+			expectedInputs: []string{"a", "b"},
+			expectedOutput: "out",
+		},
+		{
+			name:           "python style",
+			args:           []string{"-i", "a", "b", "c", "-o", "out"},
+			expectedArgs:   []string{"b", "c"},
+			expectedInputs: []string{"a"},
+			expectedOutput: "out",
+		},
+		{
+			name:           "after --",
+			args:           []string{"-o", "out", "a", "--", "-b"},
+			expectedArgs:   []string{"a", "-b"},
+			expectedOutput: "out",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var inputs []string
+			fs := flag.NewFlagSet("fc_sort", flag.ContinueOnError)
+			fs.Func("i", "", func(s string) error {
+				inputs = append(inputs, s)
+				return nil
+			})
+			output := fs.String("o", "", "")
+			args, err := parseArgs(fs, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tc.expectedArgs) || !reflect.DeepEqual(inputs, tc.expectedInputs) || *output != tc.expectedOutput {
+				t.Errorf("expected args %q, inputs %q and output %q, got %q, %q and %q",
+					tc.expectedArgs, tc.expectedInputs, tc.expectedOutput, args, inputs, *output)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// merged_contexts writes the contexts files of every partition as the device combines them: the
+// entries of every file, in the order the device uses them, each annotated with the file and line
+// it comes from. Entries of different files labeling the same thing are reported as duplicates,
+// or as conflicts if they give different labels. Files are named after their base name.
+//
+//	merged_contexts -type file_contexts -i plat_file_contexts -vendor vendor_file_contexts \
+//	    -o merged_file_contexts -report report.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"android/soong/selinux/ctxmerge"
+)
+
+var (
+	typ    = flag.String("type", "", "type of the contexts files: "+strings.Join(ctxmerge.Types, ", "))
+	output = flag.String("o", "", "merged contexts file")
+	report = flag.String("report", "", "report of duplicates and conflicts")
+
+	files []ctxmerge.File
+)
+
+func addFile(path string, vendor bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	origin := filepath.Base(path)
+	for _, f := range files {
+		if f.Origin == origin {
+			return fmt.Errorf("more than one file named %s", origin)
+		}
+	}
+	files = append(files, ctxmerge.File{Origin: origin, Vendor: vendor, Data: data})
+	return nil
+}
+
+func init() {
+	flag.Func("i", "contexts file of the system, system_ext or product partition, in the order the device loads them. Can be repeated", func(s string) error {
+		return addFile(s, false)
+	})
+	flag.Func("vendor", "contexts file of the vendor or odm partition, in the order the device loads them. Can be repeated", func(s string) error {
+		return addFile(s, true)
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func knownType(typ string) bool {
+	for _, t := range ctxmerge.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	flag.Parse()
+	if !knownType(*typ) || len(files) == 0 || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: merged_contexts -type <type> [-i <contexts>]... [-vendor <contexts>]... -o <output> [-report <report>]")
+		os.Exit(1)
+	}
+
+	entries, err := ctxmerge.Merge(*typ, files)
+	if err != nil {
+		fail(err)
+	}
+
+	var merged bytes.Buffer
+	fmt.Fprintf(&merged, "# %s merged from:\n", *typ)
+	for _, f := range files {
+		fmt.Fprintf(&merged, "#   %s\n", f.Origin)
+	}
+	for _, e := range entries {
+		fmt.Fprintln(&merged, e.String())
+	}
+	if err := os.WriteFile(*output, merged.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+
+	if *report != "" {
+		var buf bytes.Buffer
+		for _, f := range ctxmerge.Find(entries) {
+			fmt.Fprintln(&buf, f.String())
+		}
+		if err := os.WriteFile(*report, buf.Bytes(), 0666); err != nil {
+			fail(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// neverallow_coverage reports which neverallow assertions of a policy.conf file constrain anything:
+// an assertion is meaningful if an allow rule of the compiled policy overlaps with it on source
+// and target types, and vacuous otherwise.
+//
+//	neverallow_coverage -policy policy.cil -conf policy.conf \
+//	    -source_map policy.conf.source_map.json -o coverage.txt -json coverage.json
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/cil"
+	"android/soong/selinux/neverallow"
+	"android/soong/selinux/srcmap"
+)
+
+var (
+	policy    = flag.String("policy", "", "compiled policy as CIL, e.g. decompiled with checkpolicy -b -C")
+	conf      = flag.String("conf", "", "policy.conf file with the neverallow assertions")
+	sourceMap = flag.String("source_map", "", "source map of the policy.conf file. Defaults to the sync lines of the policy.conf file")
+	output    = flag.String("o", "", "output text report")
+	jsonOut   = flag.String("json", "", "output JSON report")
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func writeFile(path string, write func(*bytes.Buffer) error) {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *policy == "" || *conf == "" || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: neverallow_coverage -policy <policy.cil> -conf <policy.conf> "+
+			"[-source_map <map.json>] -o <coverage.txt> [-json <coverage.json>]")
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(*conf)
+	if err != nil {
+		fail(err)
+	}
+	var m *srcmap.Map
+	if *sourceMap != "" {
+		m, err = srcmap.ReadFile(*sourceMap)
+	} else {
+		m, err = srcmap.FromSyncLines(bytes.NewReader(data), *conf)
+	}
+	if err != nil {
+		fail(err)
+	}
+	assertions, err := neverallow.Extract(bytes.NewReader(data), m)
+	if err != nil {
+		fail(err)
+	}
+	p, err := cil.ParseFiles(*policy)
+	if err != nil {
+		fail(err)
+	}
+
+	coverage := neverallow.ComputeCoverage(assertions, p)
+	writeFile(*output, func(buf *bytes.Buffer) error {
+		return neverallow.WriteCoverageReport(buf, coverage)
+	})
+	if *jsonOut != "" {
+		writeFile(*jsonOut, func(buf *bytes.Buffer) error {
+			return neverallow.WriteCoverageJSON(buf, coverage)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// neverallow_groups splits the neverallow assertions of a policy.conf file into groups, by source
+// file or by named group, tests each group separately with sepolicy-analyze and writes the results
+// as a JUnit XML report.
+//
+//	neverallow_groups -sepolicy_analyze sepolicy-analyze -policy policy -conf policy.conf \
+//	    -source_map policy.conf.source_map.json -group vendor=vendor/ -junit results.xml
+//
+// With -cache_out, the assertions which passed are written to a cache, by a hash of their inputs:
+// their text, the types they refer to and the allow rules of the policy overlapping with them,
+// read from the CIL given with -policy_cil. The cache of an earlier run can be given with -cache,
+// and only the assertions whose hash isn't in it are checked. -cache may be missing, e.g. on the
+// first run, and may be the same file as -cache_out to keep the cache of the last run. Keys of
+// assertions which no longer exist or whose inputs changed are dropped. -full ignores -cache.
+//
+//	neverallow_groups ... -policy_cil policy.cil -cache cache.txt -cache_out cache.txt \
+//	    -junit results.xml
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"android/soong/selinux/cil"
+	"android/soong/selinux/neverallow"
+	"android/soong/selinux/srcmap"
+)
+
+var (
+	sepolicyAnalyze = flag.String("sepolicy_analyze", "", "path to sepolicy-analyze")
+	policy          = flag.String("policy", "", "binary policy to test")
+	conf            = flag.String("conf", "", "policy.conf file with the neverallow assertions")
+	sourceMap       = flag.String("source_map", "", "source map of the policy.conf file. Defaults to the sync lines of the policy.conf file")
+	junit           = flag.String("junit", "", "output JUnit XML report")
+	suite           = flag.String("suite", "neverallow", "name of the test suite")
+	workDir         = flag.String("work_dir", "", "directory for the assertions of each group. Defaults to a temporary directory")
+	policyCil       = flag.String("policy_cil", "", "the binary policy decompiled to CIL, to compute the cache keys of assertions")
+	cache           = flag.String("cache", "", "cache of an earlier run, with the keys of assertions which passed. May be missing")
+	cacheOut        = flag.String("cache_out", "", "output cache, with the keys of assertions which passed")
+	full            = flag.Bool("full", false, "check every assertion, even if it is in the cache")
+
+	groups      []neverallow.GroupSpec
+	nonBlocking = make(map[string]bool)
+
+	// keys are the cache keys of the assertions, and passed the keys read from the cache.
+	keys   = make(map[neverallow.Assertion]string)
+	passed = make(map[string]bool)
+)
+
+const hint = "sepolicy-analyze failed. This is most likely due to the use\n" +
+	"of an expanded attribute in a neverallow assertion. Please fix\n" +
+	"the policy."
+
+func init() {
+	flag.Func("group", "named group as name=pattern[,pattern...]. Can be repeated", func(s string) error {
+		name, patterns, ok := strings.Cut(s, "=")
+		if !ok || name == "" || patterns == "" {
+			return fmt.Errorf("expected name=pattern[,pattern...], got %q", s)
+		}
+		groups = append(groups, neverallow.GroupSpec{Name: name, Patterns: strings.Split(patterns, ",")})
+		return nil
+	})
+	flag.Func("non_blocking", "group whose failures are reported without failing. Can be repeated", func(s string) error {
+		nonBlocking[s] = true
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// testGroup runs sepolicy-analyze over the assertions of g which aren't known to pass, written to
+// file. It also returns the keys of the assertions of g known to pass.
+func testGroup(g neverallow.Group, file string) (neverallow.TestResult, []string) {
+	result := neverallow.TestResult{Name: g.Name}
+	var checked, cached []string
+	var sb strings.Builder
+	for _, a := range g.Assertions {
+		key := keys[a]
+		if key != "" && passed[key] && !*full {
+			cached = append(cached, key)
+			continue
+		}
+		checked = append(checked, key)
+		if a.File != "" {
+			fmt.Fprintf(&sb, "# %s:%d\n", a.File, a.SourceLine)
+		}
+		sb.WriteString(a.Text)
+		sb.WriteString("\n")
+	}
+	if len(checked) == 0 {
+		return result, cached
+	}
+	if err := os.WriteFile(file, []byte(sb.String()), 0666); err != nil {
+		result.Failure = err.Error()
+		return result, cached
+	}
+
+	start := time.Now()
+	var output bytes.Buffer
+	cmd := exec.Command(*sepolicyAnalyze, *policy, "neverallow", "-w", "-f", file)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Failure = strings.TrimSpace(output.String()) + "\n" + hint
+		if output.Len() == 0 {
+			result.Failure = err.Error() + "\n" + hint
+		}
+		result.Skipped = nonBlocking[g.Name]
+		return result, cached
+	}
+	return result, append(cached, checked...)
+}
+
+// readCache computes the cache keys of assertions, and reads the keys known to pass from -cache,
+// unless -full is given.
+func readCache(assertions []neverallow.Assertion) error {
+	p, err := cil.ParseFiles(*policyCil)
+	if err != nil {
+		return err
+	}
+	for i, key := range neverallow.Keys(assertions, p) {
+		keys[assertions[i]] = key
+	}
+	if *cache == "" || *full {
+		return nil
+	}
+
+	passed, err = neverallow.ReadCacheFile(*cache)
+	return err
+}
+
+func writeCache(passedKeys [][]string) error {
+	var all []string
+	for _, k := range passedKeys {
+		all = append(all, k...)
+	}
+	var sb strings.Builder
+	if err := neverallow.WriteCache(&sb, all); err != nil {
+		return err
+	}
+	return os.WriteFile(*cacheOut, []byte(sb.String()), 0666)
+}
+
+func main() {
+	flag.Parse()
+	if *sepolicyAnalyze == "" || *policy == "" || *conf == "" || *junit == "" || flag.NArg() > 0 ||
+		(*cache != "" && *cacheOut == "") || (*cacheOut == "") != (*policyCil == "") {
+		fmt.Fprintln(os.Stderr, "usage: neverallow_groups -sepolicy_analyze <sepolicy-analyze> -policy <policy> "+
+			"-conf <policy.conf> [-source_map <map.json>] [-group name=pattern,...]... "+
+			"[-non_blocking name]... [-suite name] [-policy_cil <policy.cil> [-cache <cache.txt>] -cache_out <cache.txt> [-full]] "+
+			"-junit <results.xml>")
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(*conf)
+	if err != nil {
+		fail(err)
+	}
+	var m *srcmap.Map
+	if *sourceMap != "" {
+		m, err = srcmap.ReadFile(*sourceMap)
+	} else {
+		// Without a source map, use the sync lines of the conf file itself.
+		m, err = srcmap.FromSyncLines(bytes.NewReader(data), *conf)
+	}
+	if err != nil {
+		fail(err)
+	}
+	assertions, err := neverallow.Extract(bytes.NewReader(data), m)
+	if err != nil {
+		fail(err)
+	}
+	if *cacheOut != "" {
+		if err := readCache(assertions); err != nil {
+			fail(err)
+		}
+	}
+
+	dir := *workDir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "neverallow_groups"); err != nil {
+			fail(err)
+		}
+	} else if err := os.MkdirAll(dir, 0777); err != nil {
+		fail(err)
+	}
+
+	// Each sepolicy-analyze run loads the whole policy, so test the groups in parallel.
+	testGroups := neverallow.GroupAssertions(assertions, groups)
+	results := make([]neverallow.TestResult, len(testGroups))
+	passedKeys := make([][]string, len(testGroups))
+	sem := make(chan bool, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, g := range testGroups {
+		wg.Add(1)
+		go func(i int, g neverallow.Group) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+			results[i], passedKeys[i] = testGroup(g, filepath.Join(dir, fmt.Sprintf("group_%d.conf", i)))
+		}(i, g)
+	}
+	wg.Wait()
+	if *workDir == "" {
+		os.RemoveAll(dir)
+	}
+	if *cacheOut != "" {
+		if err := writeCache(passedKeys); err != nil {
+			fail(err)
+		}
+	}
+
+	out, err := os.Create(*junit)
+	if err != nil {
+		fail(err)
+	}
+	if err := neverallow.WriteJUnit(out, *suite, results); err != nil {
+		out.Close()
+		fail(err)
+	}
+	if err := out.Close(); err != nil {
+		fail(err)
+	}
+
+	failed := false
+	for _, r := range results {
+		if r.Failure == "" {
+			continue
+		}
+		if r.Skipped {
+			fmt.Fprintf(os.Stderr, "neverallow group %q failed (non-blocking):\n%s\n\n", r.Name, r.Failure)
+		} else {
+			fmt.Fprintf(os.Stderr, "neverallow group %q failed:\n%s\n\n", r.Name, r.Failure)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// policy_diff reports the semantic difference between two CIL policies: added and removed types
+// and attributes, allow rules grouped by source domain, and changed type transitions. Binary
+// policies must be decompiled to CIL with checkpolicy -b -C first.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/cil"
+)
+
+var (
+	base       = flag.String("base", "", "CIL policy to compare against")
+	target     = flag.String("target", "", "CIL policy to compare with the base policy")
+	output     = flag.String("o", "", "if set, write the human readable report to this file instead of stdout")
+	jsonOutput = flag.String("json", "", "if set, write the report as JSON to this file")
+)
+
+func writeReport(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	flag.Parse()
+	if *base == "" || *target == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: policy_diff -base <base.cil> -target <target.cil> [-o <report.txt>] [-json <report.json>]")
+		os.Exit(1)
+	}
+
+	basePolicy, err := cil.ParseFiles(*base)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	targetPolicy, err := cil.ParseFiles(*target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	d := cil.DiffPolicies(basePolicy, targetPolicy)
+
+	if *output == "" {
+		err = d.WriteText(os.Stdout)
+	} else {
+		err = writeReport(*output, func(f *os.File) error { return d.WriteText(f) })
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput != "" {
+		if err := writeReport(*jsonOutput, func(f *os.File) error { return d.WriteJSON(f) }); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
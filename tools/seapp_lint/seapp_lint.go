@@ -0,0 +1,95 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// seapp_lint checks seapp_contexts files for problems checkseapp doesn't find: entries which are
+// never used because of the precedence of libselinux, vendor entries overriding platform entries,
+// app entries with a domain of the system server, and levelFrom= values which break the MLS
+// isolation of apps. Findings are written to a report. With -fatal, findings make seapp_lint
+// fail.
+//
+//	seapp_lint -platform plat_seapp_contexts -vendor vendor_seapp_contexts -o report.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"android/soong/selinux/seapp"
+)
+
+var (
+	output = flag.String("o", "", "report file")
+	fatal  = flag.Bool("fatal", false, "fail if anything is found")
+
+	platformInputs []string
+	vendorInputs   []string
+)
+
+func init() {
+	flag.Func("platform", "platform seapp_contexts file. Can be repeated", func(s string) error {
+		platformInputs = append(platformInputs, s)
+		return nil
+	})
+	flag.Func("vendor", "vendor seapp_contexts file. Can be repeated", func(s string) error {
+		vendorInputs = append(vendorInputs, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func parse(inputs []string, vendor bool) []seapp.Entry {
+	var ret []seapp.Entry
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fail(err)
+		}
+		entries, err := seapp.Parse(bytes.NewReader(data), input, vendor)
+		if err != nil {
+			fail(err)
+		}
+		ret = append(ret, entries...)
+	}
+	return ret
+}
+
+func main() {
+	flag.Parse()
+	if len(platformInputs)+len(vendorInputs) == 0 || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: seapp_lint [-platform <seapp_contexts>]... [-vendor <seapp_contexts>]... -o <report> [-fatal]")
+		os.Exit(1)
+	}
+
+	entries := append(parse(platformInputs, false), parse(vendorInputs, true)...)
+	findings := seapp.Lint(entries)
+
+	var report bytes.Buffer
+	for _, f := range findings {
+		fmt.Fprintln(&report, f.String())
+	}
+	if err := os.WriteFile(*output, report.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+	if *fatal && len(findings) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems found in seapp_contexts:\n", len(findings))
+		os.Stderr.Write(report.Bytes())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// seapp_resolve explains how apps are labeled by seapp_contexts files: for each app, it prints
+// the entries giving its domain and type, with the precedence libselinux uses, and its levels.
+// Apps are described by seapp_contexts style selectors, with the UID giving the categories, and
+// optionally the expected domain=, type= and level=. seapp_resolve fails if a result differs from
+// the expected one.
+//
+//	seapp_resolve -platform plat_seapp_contexts -vendor vendor_seapp_contexts \
+//	    -app "user=_app seinfo=platform isPrivApp=true uid=10123 domain=priv_app"
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"android/soong/selinux/seapp"
+)
+
+var (
+	output = flag.String("o", "", "output file. Defaults to stdout")
+
+	platformInputs []string
+	vendorInputs   []string
+	appFiles       []string
+	apps           []string
+)
+
+func init() {
+	flag.Func("platform", "platform seapp_contexts file. Can be repeated", func(s string) error {
+		platformInputs = append(platformInputs, s)
+		return nil
+	})
+	flag.Func("vendor", "vendor seapp_contexts file. Can be repeated", func(s string) error {
+		vendorInputs = append(vendorInputs, s)
+		return nil
+	})
+	flag.Func("app", "app to resolve, e.g. \"user=_app name=com.foo uid=10123\". Can be repeated", func(s string) error {
+		apps = append(apps, s)
+		return nil
+	})
+	flag.Func("apps", "file of apps to resolve, one per line. Can be repeated", func(s string) error {
+		appFiles = append(appFiles, s)
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func parse(inputs []string, vendor bool) []seapp.Entry {
+	var ret []seapp.Entry
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fail(err)
+		}
+		entries, err := seapp.Parse(bytes.NewReader(data), input, vendor)
+		if err != nil {
+			fail(err)
+		}
+		ret = append(ret, entries...)
+	}
+	return ret
+}
+
+func main() {
+	flag.Parse()
+	if len(platformInputs)+len(vendorInputs) == 0 || len(apps)+len(appFiles) == 0 || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: seapp_resolve [-platform <seapp_contexts>]... [-vendor <seapp_contexts>]... "+
+			"[-app <app>]... [-apps <file>]... [-o <output>]")
+		os.Exit(1)
+	}
+
+	entries := append(parse(platformInputs, false), parse(vendorInputs, true)...)
+	seapp.Sort(entries)
+
+	var queries []seapp.Query
+	for i, app := range apps {
+		q, err := seapp.ParseQuery(app, "-app #"+strconv.Itoa(i+1))
+		if err != nil {
+			fail(err)
+		}
+		queries = append(queries, q)
+	}
+	for _, file := range appFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fail(err)
+		}
+		q, err := seapp.ParseQueries(bytes.NewReader(data), file)
+		if err != nil {
+			fail(err)
+		}
+		queries = append(queries, q...)
+	}
+
+	var report bytes.Buffer
+	failures := 0
+	for _, q := range queries {
+		x := seapp.Explain(entries, q)
+		report.WriteString(x.String())
+		if len(x.Mismatches()) > 0 {
+			failures++
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		if err := os.WriteFile(*output, report.Bytes(), 0666); err != nil {
+			fail(err)
+		}
+		w = io.Discard
+		if failures > 0 {
+			w = os.Stderr
+		}
+	}
+	w.Write(report.Bytes())
+	if failures > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d apps aren't resolved as expected\n", failures, len(queries))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// secilc_diagnostics runs secilc and writes its errors as JSON diagnostics, tracing CIL lines back
+// to .te files through line markers, and prints a summary grouped by offending domain.
+//
+//	secilc_diagnostics -o diagnostics.json [-ignore_neverallow] -- secilc ... plat.cil vendor.cil
+//
+// With -ignore_neverallow, secilc is run with -N. If that succeeds, secilc is run again without
+// -N and without writing any output, so that the neverallow failures which were ignored are
+// reported as well, without failing the build. The ignored violations can be written to a ledger
+// with -ledger, and checked against an allowlist with -allowlist, failing on violations which
+// aren't allowlisted, and on neverallow failures whose violations can't be parsed:
+//
+//	secilc_diagnostics -o diagnostics.json -ignore_neverallow -ledger ledger.txt \
+//	    -allowlist allowlist.txt -- secilc ...
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"android/soong/selinux/cil"
+	"android/soong/selinux/srcmap"
+)
+
+var (
+	output           = flag.String("o", "", "output JSON diagnostics")
+	ignoreNeverallow = flag.Bool("ignore_neverallow", false, "run secilc with -N, and report the ignored neverallow failures")
+	ledger           = flag.String("ledger", "", "with -ignore_neverallow, write the ignored neverallow violations")
+	allowlist        = flag.String("allowlist", "", "with -ignore_neverallow, fail on ignored neverallow violations not listed in this ledger")
+)
+
+// secilcFlagsWithArg are the flags of secilc taking an argument.
+var secilcFlagsWithArg = map[string]bool{
+	"-o": true, "--output": true,
+	"-f": true, "--filecontext": true,
+	"-t": true, "--target": true,
+	"-M": true, "--mls": true,
+	"-c": true, "--policyvers": true,
+	"-X": true, "--expand-size": true,
+}
+
+// cilInputs returns the CIL files given to secilc.
+func cilInputs(args []string) []string {
+	var ret []string
+	for i := 1; i < len(args); i++ {
+		if secilcFlagsWithArg[args[i]] {
+			i++
+		} else if !strings.HasPrefix(args[i], "-") {
+			ret = append(ret, args[i])
+		}
+	}
+	return ret
+}
+
+// withoutOutputs returns args with the outputs of secilc replaced by /dev/null.
+func withoutOutputs(args []string) []string {
+	ret := append([]string(nil), args...)
+	for i := 1; i+1 < len(ret); i++ {
+		switch ret[i] {
+		case "-o", "--output", "-f", "--filecontext":
+			ret[i+1] = os.DevNull
+			i++
+		}
+	}
+	return ret
+}
+
+// run runs the command and returns its error output and exit code.
+func run(args []string) ([]byte, int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stderr.Bytes(), exitErr.ExitCode(), nil
+		}
+		return nil, 0, err
+	}
+	return stderr.Bytes(), 0, nil
+}
+
+// lineMarkerMaps returns the source maps of the given CIL files keyed by file name.
+func lineMarkerMaps(files []string) (map[string]*srcmap.Map, error) {
+	ret := make(map[string]*srcmap.Map)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		m, err := cil.LineMarkerMap(f, file)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ret[file] = m
+	}
+	return ret, nil
+}
+
+// fillRules sets the rule of diagnostics that secilc didn't print to the line of the CIL file.
+func fillRules(diags []*cil.Diagnostic) error {
+	wanted := make(map[string]map[int][]*cil.Diagnostic)
+	for _, d := range diags {
+		if d.Rule != "" {
+			continue
+		}
+		if wanted[d.File] == nil {
+			wanted[d.File] = make(map[int][]*cil.Diagnostic)
+		}
+		wanted[d.File][d.Line] = append(wanted[d.File][d.Line], d)
+	}
+	for file, lines := range wanted {
+		f, err := os.Open(file)
+		if err != nil {
+			// secilc may refer to files it wasn't given directly; leave the rule empty.
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			for _, d := range lines[line] {
+				d.Rule = strings.TrimSpace(scanner.Text())
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diagnose(stderr []byte, maps map[string]*srcmap.Map) ([]*cil.Diagnostic, []string, error) {
+	diags, other, err := cil.ParseSecilcOutput(bytes.NewReader(stderr))
+	if err != nil {
+		return nil, nil, err
+	}
+	cil.ResolveOrigins(diags, maps)
+	if err := fillRules(diags); err != nil {
+		return nil, nil, err
+	}
+	return diags, other, nil
+}
+
+func main() {
+	flag.Parse()
+	if *output == "" || flag.NArg() == 0 || (!*ignoreNeverallow && (*ledger != "" || *allowlist != "")) {
+		fmt.Fprintln(os.Stderr, "usage: secilc_diagnostics -o <diagnostics.json> "+
+			"[-ignore_neverallow [-ledger <ledger.txt>] [-allowlist <allowlist.txt>]] -- secilc [args...]")
+		os.Exit(1)
+	}
+	os.Exit(secilcDiagnostics(flag.Args()))
+}
+
+func secilcDiagnostics(args []string) int {
+	maps, err := lineMarkerMaps(cilInputs(args))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	secilcArgs := args
+	if *ignoreNeverallow {
+		secilcArgs = append(append([]string(nil), args...), "-N")
+	}
+	stderr, exitCode, err := run(secilcArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	diags, other, err := diagnose(stderr, maps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// unparsed is true if neverallows were ignored, but secilc reported no neverallow failure.
+	unparsed := false
+	if exitCode != 0 {
+		fmt.Fprintf(os.Stderr, "secilc failed; %d diagnostics written to %s\n", len(diags), *output)
+	} else if *ignoreNeverallow {
+		// Find out which neverallows were ignored.
+		stderr, checkExitCode, err := run(withoutOutputs(args))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		ignored, checkOther, err := diagnose(stderr, maps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		unparsed = checkExitCode != 0
+		for _, d := range ignored {
+			if d.Kind == "neverallow" {
+				unparsed = false
+				break
+			}
+		}
+		if unparsed {
+			other = append(other, checkOther...)
+		}
+		neverallows := 0
+		for _, d := range ignored {
+			if d.Kind == "neverallow" {
+				d.Ignored = true
+				diags = append(diags, d)
+				neverallows++
+			}
+		}
+		if neverallows > 0 {
+			fmt.Fprintf(os.Stderr, "%d neverallow failures ignored by -N; see %s for details\n", neverallows, *output)
+		}
+	}
+	if len(diags) > 0 {
+		cil.WriteSummary(os.Stderr, diags)
+	}
+	for _, line := range other {
+		fmt.Fprintln(os.Stderr, line)
+	}
+
+	if diags == nil {
+		diags = []*cil.Diagnostic{}
+	}
+	data, err := json.MarshalIndent(diags, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(*output, append(data, '\n'), 0666); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *ledger != "" {
+		var buf bytes.Buffer
+		if err := cil.WriteLedger(&buf, diags); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := os.WriteFile(*ledger, buf.Bytes(), 0666); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if exitCode == 0 && *allowlist != "" {
+		return checkAllowlist(diags, unparsed)
+	}
+	return exitCode
+}
+
+// checkAllowlist returns 1 if there are neverallow violations which aren't in the allowlist.
+// Neverallow failures whose violations couldn't be parsed can't be allowlisted, and neither can
+// an ignored failure of secilc without any neverallow diagnostic (unparsed).
+func checkAllowlist(diags []*cil.Diagnostic, unparsed bool) int {
+	if unparsed {
+		fmt.Fprintln(os.Stderr, "secilc failed without -N, but no neverallow failure could be parsed; "+
+			"violations can't be checked against "+*allowlist)
+		return 1
+	}
+	f, err := os.Open(*allowlist)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	allowed, err := cil.ReadLedger(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var unlisted []string
+	for _, d := range diags {
+		if d.Kind == "neverallow" && len(d.LedgerEntries()) == 0 {
+			// The violations of the neverallow are unknown, so they can't be allowlisted.
+			failure := d.Rule
+			if failure == "" {
+				failure = fmt.Sprintf("%s:%d", d.File, d.Line)
+			}
+			failure += "  # violations could not be parsed"
+			if d.Origin != nil {
+				failure += ", " + d.Origin.String()
+			}
+			unlisted = append(unlisted, failure)
+			continue
+		}
+		for _, e := range d.LedgerEntries() {
+			if allowed[e.Key] {
+				continue
+			}
+			if e.Origin != nil {
+				unlisted = append(unlisted, e.Key+"  # "+e.Origin.String())
+			} else {
+				unlisted = append(unlisted, e.Key)
+			}
+		}
+	}
+	if len(unlisted) == 0 {
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "%d neverallow violations are not in %s:\n", len(unlisted), *allowlist)
+	for _, e := range unlisted {
+		fmt.Fprintln(os.Stderr, "  "+e)
+	}
+	return 1
+}
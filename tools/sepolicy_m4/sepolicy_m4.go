@@ -0,0 +1,125 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sepolicy_m4 is a hermetic replacement of the prebuilt m4 for policy and contexts files. It
+// supports the subset of GNU m4 used by sepolicy, and can additionally warn about undefined macros
+// and dump the macro table.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"android/soong/selinux/m4"
+)
+
+type defines []string
+
+func (d *defines) String() string {
+	return strings.Join(*d, " ")
+}
+
+func (d *defines) Set(v string) error {
+	*d = append(*d, v)
+	return nil
+}
+
+var (
+	defs          defines
+	syncLines     = flag.Bool("s", false, "emit #line sync lines, like m4 -s")
+	fatalWarnings = flag.Bool("fatal-warnings", false, "exit with an error if any warning is reported")
+	warnUndefined = flag.Bool("warn_undefined", false, "warn about names followed by '(' that aren't defined macros")
+	output        = flag.String("o", "", "output file. Defaults to stdout")
+	dumpMacros    = flag.String("dump_macros", "", "if set, write the macro table at the end of input as JSON")
+)
+
+func init() {
+	flag.Var(&defs, "D", "define a macro, as name=value. Can be repeated")
+}
+
+func dumpMacroTable(p *m4.Processor, path string) error {
+	data, err := json.MarshalIndent(p.Macros(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0666)
+}
+
+func run() error {
+	p := m4.New()
+	p.SyncLines = *syncLines
+	p.WarnUndefined = *warnUndefined
+	for _, d := range defs {
+		name, value, _ := strings.Cut(d, "=")
+		p.Define(name, value)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	if flag.NArg() == 0 {
+		if err := p.Process(os.Stdin, "stdin", w); err != nil {
+			return err
+		}
+	}
+	for _, file := range flag.Args() {
+		if err := p.ProcessFile(file, w); err != nil {
+			return err
+		}
+	}
+	if err := p.Finish(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *dumpMacros != "" {
+		if err := dumpMacroTable(p, *dumpMacros); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range p.Warnings() {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	if *fatalWarnings && len(p.Warnings()) > 0 {
+		return fmt.Errorf("%d warnings reported with -fatal-warnings", len(p.Warnings()))
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sepolicy_m4 [-s] [-fatal-warnings] [-warn_undefined] [-D name=value]... [-o output] [-dump_macros macros.json] [files...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
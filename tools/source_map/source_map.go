@@ -0,0 +1,220 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// source_map generates source maps of policy.conf files from m4 sync lines, and rewrites error
+// messages of policy tools so that they point at the original .te files.
+//
+//	source_map generate -i policy.conf -o policy.conf.source_map.json
+//	source_map rewrite -m policy.conf.source_map.json -- checkpolicy ... policy.conf
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"android/soong/selinux/srcmap"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  source_map generate -i <policy.conf> -o <source_map.json>")
+	fmt.Fprintln(os.Stderr, "  source_map rewrite -m <source_map.json> -- <command> [args...]")
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "generate":
+		generate(os.Args[2:])
+	case "rewrite":
+		os.Exit(rewrite(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func generate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	input := fs.String("i", "", "policy.conf file generated by m4 -s")
+	output := fs.String("o", "", "output JSON source map")
+	fs.Parse(args)
+	if *input == "" || *output == "" {
+		usage()
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	m, err := srcmap.FromSyncLines(f, *input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := m.WriteFile(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// rewriter appends the source location to every reference to a mapped output line.
+type rewriter struct {
+	maps    []*srcmap.Map
+	regexes []*regexp.Regexp
+}
+
+// onLineRegex matches checkpolicy's "on line N" which always refers to the policy.conf line.
+var onLineRegex = regexp.MustCompile(`on line (\d+)`)
+
+func newRewriter(maps []*srcmap.Map) *rewriter {
+	r := &rewriter{maps: maps}
+	for _, m := range maps {
+		name := regexp.QuoteMeta(filepath.Base(m.Output))
+		r.regexes = append(r.regexes, regexp.MustCompile(`(?:\S*/)?`+name+`:(\d+)`))
+	}
+	return r
+}
+
+func annotate(line string, re *regexp.Regexp, m *srcmap.Map) string {
+	return re.ReplaceAllStringFunc(line, func(match string) string {
+		n, err := strconv.Atoi(re.FindStringSubmatch(match)[1])
+		if err != nil {
+			return match
+		}
+		if loc, ok := m.Lookup(n); ok {
+			return match + " [" + loc.String() + "]"
+		}
+		return match
+	})
+}
+
+func (r *rewriter) rewrite(line string) string {
+	for i, re := range r.regexes {
+		line = annotate(line, re, r.maps[i])
+	}
+	if len(r.maps) == 1 {
+		line = annotate(line, onLineRegex, r.maps[0])
+	}
+	return line
+}
+
+// copy copies the lines of rd to w, rewritten. Lines may be of any length, so that rd is always
+// drained until its end or an error.
+func (r *rewriter) copy(w io.Writer, rd io.Reader) error {
+	br := bufio.NewReader(rd)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			text, newline := strings.CutSuffix(line, "\n")
+			io.WriteString(w, r.rewrite(text))
+			if newline {
+				io.WriteString(w, "\n")
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// rewrite runs the given command, annotating its output with source locations, and returns the
+// exit code of the command.
+func rewrite(args []string) int {
+	var mapFiles []string
+	fs := flag.NewFlagSet("rewrite", flag.ExitOnError)
+	fs.Func("m", "JSON source map. Can be repeated", func(s string) error {
+		mapFiles = append(mapFiles, s)
+		return nil
+	})
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	var maps []*srcmap.Map
+	for _, f := range mapFiles {
+		m, err := srcmap.ReadFile(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		maps = append(maps, m)
+	}
+	r := newRewriter(maps)
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var wg sync.WaitGroup
+	copyErrs := make([]error, 2)
+	for i, pipe := range []struct {
+		w  io.Writer
+		rd io.Reader
+	}{{os.Stdout, stdout}, {os.Stderr, stderr}} {
+		wg.Add(1)
+		go func(i int, w io.Writer, rd io.Reader) {
+			defer wg.Done()
+			if copyErrs[i] = r.copy(w, rd); copyErrs[i] != nil {
+				// Keep draining, so that the command doesn't block on a full pipe.
+				io.Copy(io.Discard, rd)
+			}
+		}(i, pipe.w, pipe.rd)
+	}
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(err.Error()))
+		return 1
+	}
+	if err := errors.Join(copyErrs...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sysprop_contexts generates property_contexts entries for the properties of sysprop_library API
+// files, and appends those for properties which a handwritten property_contexts file doesn't label.
+// It fails if entries generated for the same property disagree.
+//
+//	sysprop_contexts -api Foo-current.txt -owner_context Platform=u:object_r:system_prop:s0 \
+//	    -contexts property_contexts -o property_contexts.generated
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"android/soong/selinux/propctx"
+)
+
+var (
+	contexts = flag.String("contexts", "", "handwritten property_contexts file")
+	output   = flag.String("o", "", "output property_contexts file")
+
+	apis          []string
+	ownerContexts = make(map[string]string)
+)
+
+func init() {
+	flag.Func("api", "sysprop_library API file. Can be repeated", func(s string) error {
+		apis = append(apis, s)
+		return nil
+	})
+	flag.Func("owner_context", "context of the properties of an owner, as owner=context. Can be repeated", func(s string) error {
+		owner, context, ok := strings.Cut(s, "=")
+		if !ok || owner == "" || context == "" {
+			return fmt.Errorf("expected owner=context, got %q", s)
+		}
+		ownerContexts[owner] = context
+		return nil
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	if *contexts == "" || *output == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: sysprop_contexts [-api <api.txt>]... [-owner_context owner=context]... "+
+			"-contexts <property_contexts> -o <output>")
+		os.Exit(1)
+	}
+
+	var sysprops []propctx.Sysprop
+	for _, api := range apis {
+		data, err := os.ReadFile(api)
+		if err != nil {
+			fail(err)
+		}
+		s, err := propctx.ParseSyspropApi(bytes.NewReader(data), api)
+		if err != nil {
+			fail(err)
+		}
+		sysprops = append(sysprops, s...)
+	}
+	generated, err := propctx.Generate(sysprops, ownerContexts)
+	if err != nil {
+		fail(err)
+	}
+
+	data, err := os.ReadFile(*contexts)
+	if err != nil {
+		fail(err)
+	}
+	handwritten, err := propctx.ParseContexts(bytes.NewReader(data), *contexts)
+	if err != nil {
+		fail(err)
+	}
+	added, conflicts := propctx.Merge(handwritten, generated)
+	if len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "%d generated property_contexts entries for properties unlabeled by %s conflict:\n", len(conflicts), *contexts)
+		for _, c := range conflicts {
+			fmt.Fprintln(os.Stderr, "  "+c.String())
+		}
+		os.Exit(1)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if len(added) > 0 {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("# Generated from sysprop_library APIs\n")
+		module := ""
+		for _, e := range added {
+			// property_contexts only has whole line comments.
+			if e.Source != module {
+				module = e.Source
+				fmt.Fprintf(&buf, "# %s\n", module)
+			}
+			fmt.Fprintln(&buf, e.String())
+		}
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		fail(err)
+	}
+}